@@ -1,18 +1,26 @@
 create table `t_msg_record` (
                                    `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                    `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
                                    `source_id`             varchar(256)      not null                comment '业务ID',
                                    `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
+                                   `delivered_channel`                  int(10)   not null DEFAULT 0    comment '最终投递成功的渠道',
                                    `subject`             varchar(256)      not null                comment '消息主题',
                                     `to`             varchar(256)      not null                comment '发给哪个用户',
                                     `template_id`             varchar(256)      not null                comment '模板ID',
                                    `template_data`             varchar(4096)      not null                comment '模板传入参数',
-                                   `status`                  int(10)   comment '状态, 1: 等待中, 2: 成功, 3: 失败',
+                                   `status`                  int(10)   comment '状态, 1: 等待中, 2: 成功, 3: 失败, 4: 已过期, 5: 已取消',
                                    `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                    `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                    `retry_count`                  int(10)   comment '重试次数',
+                                   `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次重试时间（Unix毫秒），0表示没有待重试',
+                                   `error_category`             varchar(32)      not null DEFAULT ''     comment '最近一次投递失败的错误分类: transient, permanent, rate_limited, auth',
+                                   `error_code`             varchar(128)      not null DEFAULT ''     comment '最近一次投递失败的原因码',
+                                   `last_error`             varchar(1024)      not null DEFAULT ''     comment '最近一次投递失败的错误信息',
+                                   `notify_url`             varchar(1024)      not null DEFAULT ''     comment '最终状态回调地址',
                                    PRIMARY KEY (`id`),
-                                   UNIQUE KEY `idx_msgid` (`msg_id`)
+                                   UNIQUE KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_batch_id` (`batch_id`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '消息记录表' ;
 
 
@@ -28,6 +36,7 @@ create table `t_msg_template` (
                                 `content`             varchar(4096)      not null                comment '消息文本模板',
                                 `status`                  int(10)   comment '模板状态, 1: 等待审核, 2: 正常',
                                 `ext`             varchar(256)      comment '扩展字段',
+                                `fallback`             varchar(256)      DEFAULT NULL     comment '渠道降级策略(JSON)',
                                 `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                 `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                 PRIMARY KEY (`id`),
@@ -38,33 +47,53 @@ create table `t_msg_template` (
 create table `t_msg_queue_low` (
                                 `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                 `msg_id`             varchar(256)      not null                comment '消息ID',
+                                `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
                                 `to`             varchar(256)      not null                comment '发给哪个用户',
                                 `subject`             varchar(256)      not null                comment '消息主题',
                                 `priority`                  int(10)   comment '优先级',
                                 `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
                                 `template_id`             varchar(256)      not null                comment '模板ID',
                                 `template_data`             varchar(4096)      not null                comment '模板传入参数',
+                                `content`             text                                     comment '消息内容（直接发送模式）',
+                                `fallback`             varchar(1024)      DEFAULT NULL     comment '渠道降级进度(JSON)',
+                                `expire_at`             bigint(20)      not null DEFAULT 0      comment '过期时间（Unix秒），0表示不过期',
+                                `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次尝试时间（Unix毫秒），0表示立即',
+                                `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                `trace_context`             varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                `owner`             varchar(128)      not null DEFAULT ''     comment '最后认领该消息的节点',
                                 `status`                  int(10)   comment '状态',
                                 `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                 `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                 PRIMARY KEY (`id`),
-                                UNIQUE KEY `idx_msgid` (`msg_id`)
+                                UNIQUE KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_status_create_time` (`status`, `create_time`),
+                                   KEY `idx_status_modify_time` (`status`, `modify_time`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '低优先级消息队列表' ;
 
 create table `t_msg_queue_middle` (
                                    `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                    `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
                                    `to`             varchar(256)      not null                comment '发给哪个用户',
                                    `subject`             varchar(256)      not null                comment '消息主题',
                                    `priority`                  int(10)   comment '优先级',
                                    `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
                                    `template_id`             varchar(256)      not null                comment '模板ID',
                                    `template_data`             varchar(4096)      not null                comment '模板传入参数',
+                                   `content`             text                                     comment '消息内容（直接发送模式）',
+                                   `fallback`             varchar(1024)      DEFAULT NULL     comment '渠道降级进度(JSON)',
+                                   `expire_at`             bigint(20)      not null DEFAULT 0      comment '过期时间（Unix秒），0表示不过期',
+                                   `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次尝试时间（Unix毫秒），0表示立即',
+                                   `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                   `trace_context`             varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                   `owner`             varchar(128)      not null DEFAULT ''     comment '最后认领该消息的节点',
                                    `status`                  int(10)   comment '状态',
                                    `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                    `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                    PRIMARY KEY (`id`),
-                                   UNIQUE KEY `idx_msgid` (`msg_id`)
+                                   UNIQUE KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_status_create_time` (`status`, `create_time`),
+                                   KEY `idx_status_modify_time` (`status`, `modify_time`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '中优先级消息队列表' ;
 
 
@@ -72,50 +101,249 @@ create table `t_msg_queue_middle` (
 create table `t_msg_queue_high` (
                                    `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                    `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
                                    `to`             varchar(256)      not null                comment '发给哪个用户',
                                    `subject`             varchar(256)      not null                comment '消息主题',
                                    `priority`                  int(10)   comment '优先级',
                                    `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
                                    `template_id`             varchar(256)      not null                comment '模板ID',
                                    `template_data`             varchar(4096)      not null                comment '模板传入参数',
+                                   `content`             text                                     comment '消息内容（直接发送模式）',
+                                   `fallback`             varchar(1024)      DEFAULT NULL     comment '渠道降级进度(JSON)',
+                                   `expire_at`             bigint(20)      not null DEFAULT 0      comment '过期时间（Unix秒），0表示不过期',
+                                   `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次尝试时间（Unix毫秒），0表示立即',
+                                   `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                   `trace_context`             varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                   `owner`             varchar(128)      not null DEFAULT ''     comment '最后认领该消息的节点',
                                    `status`                  int(10)   comment '状态',
                                    `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                    `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                    PRIMARY KEY (`id`),
-                                   UNIQUE KEY `idx_msgid` (`msg_id`)
+                                   UNIQUE KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_status_create_time` (`status`, `create_time`),
+                                   KEY `idx_status_modify_time` (`status`, `modify_time`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '高优先级消息队列表' ;
 
 create table `t_msg_queue_retry` (
                                    `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                    `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
                                    `to`             varchar(256)      not null                comment '发给哪个用户',
                                    `subject`             varchar(256)      not null                comment '消息主题',
                                    `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
                                    `template_id`             varchar(256)      not null                comment '模板ID',
                                    `template_data`             varchar(4096)      not null                comment '模板传入参数',
+                                   `content`             text                                     comment '消息内容（直接发送模式）',
+                                   `fallback`             varchar(1024)      DEFAULT NULL     comment '渠道降级进度(JSON)',
+                                   `expire_at`             bigint(20)      not null DEFAULT 0      comment '过期时间（Unix秒），0表示不过期',
+                                   `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次尝试时间（Unix毫秒），0表示立即',
+                                   `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                   `trace_context`             varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                   `owner`             varchar(128)      not null DEFAULT ''     comment '最后认领该消息的节点',
                                    `priority`                  int(10)   comment '优先级',
                                    `status`                  int(10)   comment '状态',
                                    `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                    `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                    PRIMARY KEY (`id`),
-                                   UNIQUE KEY `idx_msg_id` (`msg_id`)
+                                   UNIQUE KEY `idx_msg_id` (`msg_id`),
+                                   KEY `idx_status_next_attempt` (`status`, `next_attempt_at`),
+                                   KEY `idx_status_modify_time` (`status`, `modify_time`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '重试消息队列表' ;
 
 
+create table `t_msg_queue_dead` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
+                                   `to`             varchar(256)      not null                comment '发给哪个用户',
+                                   `channel`                  int(10)   comment '最后尝试的推送渠道',
+                                   `priority`                  int(10)   comment '优先级，重放时投递到该优先级队列',
+                                   `req`             text      not null                comment '消息请求(send_msg.Req)',
+                                   `last_error`             varchar(1024)      not null DEFAULT ''     comment '最后一次投递失败原因',
+                                   `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                   `retry_count`                  int(10)   not null DEFAULT 0    comment '进入死信时的重试次数',
+                                   `status`                  int(10)   not null                comment '状态, 1: 待处理, 2: 已重放',
+                                   `replay_count`                  int(10)   not null DEFAULT 0    comment '重放次数',
+                                   `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `idx_msg_id` (`msg_id`),
+                                   KEY `idx_status_create_time` (`status`, `create_time`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '死信消息表' ;
+
+
 create table `t_msg_tmp_queue_timer` (
                                    `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                                    `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `batch_id`            varchar(64)      not null DEFAULT ''     comment '批次ID',
                                    `req`                 varchar(4096)      not null                comment 'send_msg.Req',
+                                   `trace_context`       varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
                                    `send_timestamp`      bigint(10)   comment '定时发送时间',
                                    `status`              int(10)      comment '状态',
                                    `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
                                    `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
                                    PRIMARY KEY (`id`),
                                    UNIQUE KEY `idx_msgid` (`msg_id`),
-                                   INDEX `idx_send_timestamp_status` (`send_timestamp`,`status`)
+                                   INDEX `idx_send_timestamp_status` (`send_timestamp`,`status`),
+                                   KEY `idx_batch_id` (`batch_id`),
+                                   KEY `idx_status_modify_time` (`status`, `modify_time`)
 )ENGINE=InnoDB  default CHARSET=utf8mb4 comment '定时消息队列表' ;
 
 
+create table `t_msg_queue_history` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`             varchar(256)      not null                comment '消息ID',
+                                   `batch_id`             varchar(64)      not null DEFAULT ''     comment '批次ID',
+                                   `to`             varchar(256)      not null                comment '发给哪个用户',
+                                   `subject`             varchar(256)      not null                comment '消息主题',
+                                   `priority`                  int(10)   comment '优先级，区分来自哪张队列表',
+                                   `channel`                  int(10)   comment '推送渠道，1：邮件，2:短信',
+                                   `template_id`             varchar(256)      not null                comment '模板ID',
+                                   `template_data`             varchar(4096)      not null                comment '模板传入参数',
+                                   `content`             text                                     comment '消息内容（直接发送模式）',
+                                   `fallback`             varchar(1024)      DEFAULT NULL     comment '渠道降级进度(JSON)',
+                                   `expire_at`             bigint(20)      not null DEFAULT 0      comment '过期时间（Unix秒），0表示不过期',
+                                   `next_attempt_at`             bigint(20)      not null DEFAULT 0      comment '下次尝试时间（Unix毫秒），0表示立即',
+                                   `attempt_history`             text                                     comment '失败投递历史(JSON)',
+                                   `trace_context`             varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                   `status`                  int(10)   comment '归档时的状态',
+                                   `create_time`         datetime     not null                comment '入队时间',
+                                   `modify_time`         datetime     not null                comment '最后更新时间',
+                                   `archive_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '归档时间',
+                                   PRIMARY KEY (`id`),
+                                   KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_create_time` (`create_time`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '已结束队列消息归档表，超过table_max_rows后按时间后缀拆分' ;
+
+create table `t_msg_tmp_queue_timer_history` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `batch_id`            varchar(64)      not null DEFAULT ''     comment '批次ID',
+                                   `req`                 varchar(4096)      not null                comment 'send_msg.Req',
+                                   `trace_context`       varchar(512)      not null DEFAULT ''     comment '链路追踪上下文(W3C Trace Context, JSON)',
+                                   `send_timestamp`      bigint(10)   comment '定时发送时间',
+                                   `status`              int(10)      comment '归档时的状态',
+                                   `create_time`         datetime     not null                comment '创建时间',
+                                   `modify_time`         datetime     not null                comment '最后更新时间',
+                                   `archive_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '归档时间',
+                                   PRIMARY KEY (`id`),
+                                   KEY `idx_msgid` (`msg_id`),
+                                   KEY `idx_create_time` (`create_time`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '已结束定时消息归档表，超过table_max_rows后按时间后缀拆分' ;
+
+
+create table `t_msg_outbox` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `priority`            int(10)      not null                comment '优先级，决定投递的Kafka主题',
+                                   `payload`             text         not null                comment '投递到Kafka的消息体',
+                                   `trace_context`       varchar(512)      not null DEFAULT ''     comment '链路追踪上下文，投递时写入Kafka消息头',
+                                   `status`              int(10)      not null                comment '状态, 1: 待投递, 2: 已投递',
+                                   `retry_count`         int(10)      not null DEFAULT 0      comment '投递失败次数',
+                                   `last_error`          varchar(1024)      not null DEFAULT ''     comment '最近一次投递失败原因',
+                                   `next_attempt_at`     bigint(20)      not null DEFAULT 0      comment '下次投递时间（Unix毫秒），0表示立即',
+                                   `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `idx_msgid` (`msg_id`),
+                                   INDEX `idx_status_create_time` (`status`,`create_time`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '消息发件箱表' ;
+
+
+create table `t_msg_notify_log` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `notify_url`          varchar(1024)      not null                comment '回调地址',
+                                   `status`              int(10)      not null                comment '回调通知的消息状态, 2: 成功, 3: 失败',
+                                   `attempt`             int(10)      not null                comment '第几次回调',
+                                   `http_code`           int(10)      not null DEFAULT 0      comment '回调地址返回的HTTP状态码',
+                                   `error`               varchar(1024)      not null DEFAULT ''     comment '回调失败原因',
+                                   `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
+                                   PRIMARY KEY (`id`),
+                                   KEY `idx_msgid` (`msg_id`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '投递回调记录表' ;
+
+
+create table `t_msg_notify_task` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `notify_url`          varchar(1024)      not null                comment '回调地址',
+                                   `msg_status`          int(10)      not null                comment '回调通知的消息状态, 2: 成功, 3: 失败, 4: 已过期',
+                                   `payload`             text         not null                comment '回调请求体',
+                                   `status`              int(10)      not null                comment '状态, 1: 待回调, 2: 回调成功, 3: 回调失败',
+                                   `attempt`             int(10)      not null DEFAULT 0      comment '已回调次数',
+                                   `next_attempt_at`     bigint(20)      not null DEFAULT 0      comment '下次回调时间（Unix毫秒），0表示立即',
+                                   `last_error`          varchar(1024)      not null DEFAULT ''     comment '最近一次回调失败原因',
+                                   `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   KEY `idx_msgid` (`msg_id`),
+                                   INDEX `idx_status_next_attempt_at` (`status`,`next_attempt_at`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '待投递回调表' ;
+
+
+create table `t_msg_attempt` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `msg_id`              varchar(256)      not null                comment '消息ID',
+                                   `attempt`             int(10)      not null                comment '第几轮投递，从1开始',
+                                   `channel`             int(10)      not null                comment '渠道',
+                                   `provider`            varchar(64)      not null DEFAULT ''     comment '渠道供应商，如smtp、aliyun_sms、lark',
+                                   `to`                  varchar(256)      not null DEFAULT ''     comment '接收者',
+                                   `status`              int(10)      not null                comment '状态, 1: 成功, 2: 失败',
+                                   `latency_ms`          bigint(20)      not null DEFAULT 0      comment '调用渠道供应商的耗时（毫秒）',
+                                   `error_category`      varchar(32)      not null DEFAULT ''     comment '错误分类',
+                                   `error_code`          varchar(128)      not null DEFAULT ''     comment '原因码',
+                                   `response`            varchar(1024)      not null DEFAULT ''     comment '失败时为错误信息',
+                                   `provider_msg_id`     varchar(256)      not null DEFAULT ''     comment '渠道供应商返回的消息ID',
+                                   `worker_node`         varchar(256)      not null DEFAULT ''     comment '执行投递的节点',
+                                   `create_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP                             comment '创建时间',
+                                   PRIMARY KEY (`id`),
+                                   KEY `idx_msgid` (`msg_id`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '投递尝试日志表' ;
+
+
+create table `t_msg_stats_minute` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `bucket_time`         datetime     not null                comment '统计桶的起始时间，按消息创建时间分桶',
+                                   `channel`             int(10)      not null DEFAULT 0      comment '渠道',
+                                   `source_id`           varchar(256)      not null DEFAULT ''     comment '业务ID',
+                                   `template_id`         varchar(256)      not null DEFAULT ''     comment '模板ID',
+                                   `status`              int(10)      not null                comment '最终状态, 2: 成功, 3: 失败, 4: 已过期, 5: 已取消',
+                                   `count`               bigint(20)      not null DEFAULT 0      comment '消息数',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `idx_bucket_dims` (`bucket_time`,`channel`,`source_id`,`template_id`,`status`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '消息统计按分钟汇总表' ;
+
+
+create table `t_msg_stats_hour` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `bucket_time`         datetime     not null                comment '统计桶的起始时间，按消息创建时间分桶',
+                                   `channel`             int(10)      not null DEFAULT 0      comment '渠道',
+                                   `source_id`           varchar(256)      not null DEFAULT ''     comment '业务ID',
+                                   `template_id`         varchar(256)      not null DEFAULT ''     comment '模板ID',
+                                   `status`              int(10)      not null                comment '最终状态, 2: 成功, 3: 失败, 4: 已过期, 5: 已取消',
+                                   `count`               bigint(20)      not null DEFAULT 0      comment '消息数',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `idx_bucket_dims` (`bucket_time`,`channel`,`source_id`,`template_id`,`status`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '消息统计按小时汇总表' ;
+
+
+create table `t_msg_stats_day` (
+                                   `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
+                                   `bucket_time`         datetime     not null                comment '统计桶的起始时间，按消息创建时间分桶',
+                                   `channel`             int(10)      not null DEFAULT 0      comment '渠道',
+                                   `source_id`           varchar(256)      not null DEFAULT ''     comment '业务ID',
+                                   `template_id`         varchar(256)      not null DEFAULT ''     comment '模板ID',
+                                   `status`              int(10)      not null                comment '最终状态, 2: 成功, 3: 失败, 4: 已过期, 5: 已取消',
+                                   `count`               bigint(20)      not null DEFAULT 0      comment '消息数',
+                                   `modify_time`         datetime     not null DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP comment '修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `idx_bucket_dims` (`bucket_time`,`channel`,`source_id`,`template_id`,`status`)
+)ENGINE=InnoDB  default CHARSET=utf8mb4 comment '消息统计按天汇总表' ;
+
+
 create table `t_global_quota` (
                            `id`                  bigint(20)       not null AUTO_INCREMENT comment 'ID',
                            `num`                 int(10)      not null                comment '限额',
@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -31,18 +32,35 @@ type TomlConfig struct {
 }
 
 type commonConfig struct {
-	Port            int    `toml:"port"`
-	OpenTLS         bool   `toml:"open_tls"`
-	MySQLAsMq       bool   `toml:"mysql_as_mq"`
-	AliAppID        string `toml:"ali_app_id"`
-	AliAppSecret    string `toml:"ali_app_secret"`
-	EmailAccount    string `toml:"email_account"`
-	EmailAuthCode   string `toml:"email_auth_code"`
-	LarkAppID       string `toml:"lark_app_id"`     // 飞书应用ID
-	LarkAppSecret   string `toml:"lark_app_secret"` // 飞书应用密钥
-	ConsumePriority int    `toml:"consume_priority"`
-	OpenCache       bool   `toml:"open_cache"`
-	MaxRetryCount   int    `toml:"max_retry_count"` // 最大重试次数，默认20次
+	Port                int            `toml:"port"`
+	OpenTLS             bool           `toml:"open_tls"`
+	MySQLAsMq           bool           `toml:"mysql_as_mq"`
+	AliAppID            string         `toml:"ali_app_id"`
+	AliAppSecret        string         `toml:"ali_app_secret"`
+	EmailAccount        string         `toml:"email_account"`
+	EmailAuthCode       string         `toml:"email_auth_code"`
+	LarkAppID           string         `toml:"lark_app_id"`     // 飞书应用ID
+	LarkAppSecret       string         `toml:"lark_app_secret"` // 飞书应用密钥
+	ConsumePriority     int            `toml:"consume_priority"`
+	OpenCache           bool           `toml:"open_cache"`
+	MaxRetryCount       int            `toml:"max_retry_count"`       // 最大重试次数，默认20次
+	IdempotencyWindow   int            `toml:"idempotency_window"`    // 幂等键保留时长（秒），默认86400秒
+	OutboxRelayDelay    int            `toml:"outbox_relay_delay"`    // 发件箱中继接管未投递消息的等待时长（秒），默认5秒
+	OutboxRetention     int            `toml:"outbox_retention"`      // 已投递的发件箱消息保留时长（秒），之后由中继删除，默认86400秒
+	NotifySecret        string         `toml:"notify_secret"`         // 投递回调的签名密钥
+	NotifyMaxRetry      int            `toml:"notify_max_retry"`      // 投递回调的最大尝试次数，默认5次
+	RetryBackoffBase    int            `toml:"retry_backoff_base_ms"` // 投递失败后首次重试的等待时长（毫秒），之后每次翻倍，默认1000毫秒
+	RetryBackoffMax     int            `toml:"retry_backoff_max_ms"`  // 重试等待时长上限（毫秒），默认300000毫秒
+	RetryBackoffJitter  float64        `toml:"retry_backoff_jitter"`  // 重试等待时长的随机浮动比例，取值0~1，默认0.2
+	OtlpEndpoint        string         `toml:"otlp_endpoint"`         // 链路追踪OTLP/HTTP上报地址，如 localhost:4318，为空时不上报
+	OtlpInsecure        bool           `toml:"otlp_insecure"`         // 是否使用http上报链路追踪数据
+	TraceSampleRatio    float64        `toml:"trace_sample_ratio"`    // 链路追踪采样比例，取值0~1，默认1
+	ShutdownTimeout     int            `toml:"shutdown_timeout"`      // 优雅退出时等待处理中请求和消息的时长（秒），默认30秒
+	MySQLConsumeWorkers int            `toml:"mysql_consume_workers"` // MySQL队列模式下每个节点同时发送的消息数，默认20
+	PriorityWeights     map[string]int `toml:"priority_weights"`      // MySQL队列各优先级的调度权重，默认high 60、middle 30、low 10、retry 10
+	PriorityMinShare    float64        `toml:"priority_min_share"`    // MySQL队列每个优先级每轮至少分得的发送份额，取值0~0.25，默认0.05
+	ChannelWorkers      map[string]int `toml:"channel_workers"`       // Kafka模式下各渠道同时发送的消息数，key为email、sms、lark，默认各10
+	ChannelMaxInflight  map[string]int `toml:"channel_max_inflight"`  // Kafka模式下各渠道已拉取未发送完的消息上限，达到后该渠道的新消息停放到重试队列稍后投递，默认为发送数的10倍
 }
 
 type mysqlConfig struct {
@@ -69,22 +87,54 @@ type kafkaConfig struct {
 }
 
 type TopicConfig struct {
-	Name      string `toml:"name"`
-	Priority  int    `toml:"priority"`
-	Ack       int    `toml:"ack"`
-	Async     bool   `toml:"async"`
-	Offset    int64  `toml:"offset"`
-	GroupID   string `toml:"group_id"`
-	Partition int    `toml:"partition"`
+	Name          string `toml:"name"`
+	Priority      int    `toml:"priority"`
+	Ack           int    `toml:"ack"`
+	Async         bool   `toml:"async"`
+	Offset        int64  `toml:"offset"`
+	InitialOffset string `toml:"initial_offset"` // 消费者组在分区上没有提交过位移时开始消费的位置：oldest、newest或explicit(从offset开始)
+	GroupID       string `toml:"group_id"`
+	Partition     int    `toml:"partition"`
+}
+
+// StartOffset 消费者组在分区上没有提交过位移时开始消费的位置：-1从最新消息开始，-2从最早的消息开始，大于等于0从该位移开始
+// 未配置initial_offset时沿用offset：-2从最早的消息开始，大于0从该位移开始，其他从最新消息开始
+func (t TopicConfig) StartOffset() int64 {
+	switch t.InitialOffset {
+	case "oldest":
+		return -2
+	case "newest":
+		return -1
+	case "explicit":
+		return t.Offset
+	}
+	if t.Offset == -2 || t.Offset > 0 {
+		return t.Offset
+	}
+	return -1
+}
+
+// validate 检查初始位移配置
+func (t TopicConfig) validate() error {
+	switch t.InitialOffset {
+	case "", "oldest", "newest":
+		return nil
+	case "explicit":
+		if t.Offset < 0 {
+			return fmt.Errorf("initial_offset is explicit but offset is %d", t.Offset)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown initial_offset %q, want oldest, newest or explicit", t.InitialOffset)
 }
 
 type TaskConfig struct {
-	TableMaxRows        int   `toml:"table_max_rows"`
-	AliveThreshold      int   `toml:"alive_threshold"`
-	SplitInterval       int   `toml:"split_interval"`
-	LongProcessInterval int   `toml:"long_process_interval"`
-	MoveInterval        int   `toml:"move_interval"`
-	MaxProcessTime      int64 `toml:"max_process_time"`
+	TableMaxRows        int   `toml:"table_max_rows"`        // 归档表超过该行数后按时间后缀拆分，0表示不拆分
+	AliveThreshold      int   `toml:"alive_threshold"`       // 结束的消息在队列表中保留的时长（秒），之后移入归档表，默认86400秒
+	SplitInterval       int   `toml:"split_interval"`        // 检查归档表是否需要拆分的间隔（秒），默认3600秒
+	LongProcessInterval int   `toml:"long_process_interval"` // 回收处理中超时消息的扫描间隔（秒），默认60秒
+	MoveInterval        int   `toml:"move_interval"`         // 归档结束消息的间隔（秒），默认300秒
+	MaxProcessTime      int64 `toml:"max_process_time"`      // 消息处于处理中的最长时间（秒），超过后放回待处理，默认300秒
 }
 
 // LoadConfig 导入配置
@@ -126,10 +176,109 @@ func (c *TomlConfig) LoadConfig(env string) {
 		panic(err)
 	}
 
+	// 检查各主题的初始位移配置
+	for name, topic := range c.Kafka.Topics {
+		if err := topic.validate(); err != nil {
+			log.Errorf("主题%s的配置错误: %s", name, err)
+			panic(err)
+		}
+	}
+
+	// 以下参数未配置或配置为非正数时使用默认值，避免负数的间隔导致定时器panic
+
 	// 设置最大重试次数(默认20次)
-	if c.Common.MaxRetryCount == 0 {
+	if c.Common.MaxRetryCount <= 0 {
 		c.Common.MaxRetryCount = 20
 	}
+
+	// 设置幂等键保留时长(默认1天)
+	if c.Common.IdempotencyWindow <= 0 {
+		c.Common.IdempotencyWindow = 86400
+	}
+
+	// 设置发件箱中继等待时长(默认5秒)
+	if c.Common.OutboxRelayDelay <= 0 {
+		c.Common.OutboxRelayDelay = 5
+	}
+
+	// 设置已投递发件箱消息保留时长(默认1天)
+	if c.Common.OutboxRetention <= 0 {
+		c.Common.OutboxRetention = 86400
+	}
+
+	// 设置投递回调最大尝试次数(默认5次)
+	if c.Common.NotifyMaxRetry <= 0 {
+		c.Common.NotifyMaxRetry = 5
+	}
+
+	// 设置重试退避参数(默认首次1秒，上限5分钟，浮动20%)
+	if c.Common.RetryBackoffBase <= 0 {
+		c.Common.RetryBackoffBase = 1000
+	}
+	if c.Common.RetryBackoffMax <= 0 {
+		c.Common.RetryBackoffMax = 300000
+	}
+	if c.Common.RetryBackoffJitter <= 0 {
+		c.Common.RetryBackoffJitter = 0.2
+	}
+
+	// 设置链路追踪采样比例(默认全部采样)
+	if c.Common.TraceSampleRatio <= 0 {
+		c.Common.TraceSampleRatio = 1
+	}
+
+	// 设置优雅退出等待时长(默认30秒)
+	if c.Common.ShutdownTimeout <= 0 {
+		c.Common.ShutdownTimeout = 30
+	}
+
+	// 设置MySQL队列每个节点的发送协程数(默认20)
+	if c.Common.MySQLConsumeWorkers <= 0 {
+		c.Common.MySQLConsumeWorkers = 20
+	}
+
+	// 设置MySQL队列各优先级的调度权重(默认60:30:10:10，每个优先级至少5%)
+	if len(c.Common.PriorityWeights) == 0 {
+		c.Common.PriorityWeights = map[string]int{"high": 60, "middle": 30, "low": 10, "retry": 10}
+	}
+	if c.Common.PriorityMinShare <= 0 {
+		c.Common.PriorityMinShare = 0.05
+	}
+
+	// 设置Kafka模式下各渠道的发送协程数和积压上限(默认各10个协程，积压为协程数的10倍)
+	if c.Common.ChannelWorkers == nil {
+		c.Common.ChannelWorkers = make(map[string]int)
+	}
+	if c.Common.ChannelMaxInflight == nil {
+		c.Common.ChannelMaxInflight = make(map[string]int)
+	}
+	for _, channel := range []string{"email", "sms", "lark"} {
+		if c.Common.ChannelWorkers[channel] <= 0 {
+			c.Common.ChannelWorkers[channel] = 10
+		}
+		if c.Common.ChannelMaxInflight[channel] < c.Common.ChannelWorkers[channel] {
+			c.Common.ChannelMaxInflight[channel] = c.Common.ChannelWorkers[channel] * 10
+		}
+	}
+
+	// 设置处理中超时消息的回收参数(默认处理中超过5分钟放回，每分钟扫描一次)
+	if c.Task.MaxProcessTime <= 0 {
+		c.Task.MaxProcessTime = 300
+	}
+	if c.Task.LongProcessInterval <= 0 {
+		c.Task.LongProcessInterval = 60
+	}
+
+	// 设置队列表归档参数(默认结束1天后归档，每5分钟归档一次，每小时检查一次拆分)
+	if c.Task.AliveThreshold <= 0 {
+		c.Task.AliveThreshold = 86400
+	}
+	if c.Task.MoveInterval <= 0 {
+		c.Task.MoveInterval = 300
+	}
+	if c.Task.SplitInterval <= 0 {
+		c.Task.SplitInterval = 3600
+	}
 }
 
 const (
@@ -28,6 +28,10 @@ var (
 	ERR_SET_USER_PRIORITY        = 8045
 	ERR_GET_TASK_CFG_FROM_DB     = 8039
 	ERR_INSERT_TIMER             = 8047
+	ERR_IDEMPOTENCY_CONFLICT     = 8048
+	ERR_MSG_NOT_CANCELLABLE      = 8049
+	ERR_DEAD_LETTER_NOT_FOUND    = 8050
+	ERR_SERVICE_NOT_READY        = 8051
 
 	// 用户管理相关错误码
 	ERR_USER_ALREADY_EXISTS = 9001
@@ -54,6 +58,10 @@ var errMsgDic = map[int]string{
 	ERR_SET_USER_PRIORITY:        "set user priority failed",
 	ERR_GET_TASK_CFG_FROM_DB:     "get msg cfg failed",
 	ERR_INSERT_TIMER:             "数据库插入失败",
+	ERR_IDEMPOTENCY_CONFLICT:     "相同幂等键的请求正在处理中，请稍后重试",
+	ERR_MSG_NOT_CANCELLABLE:      "消息不存在或已投递，无法取消",
+	ERR_DEAD_LETTER_NOT_FOUND:    "死信不存在",
+	ERR_SERVICE_NOT_READY:        "服务未就绪",
 
 	// 用户管理错误描述
 	ERR_USER_ALREADY_EXISTS: "用户已存在",
@@ -1,5 +1,10 @@
 package constant
 
 const (
-	HEADER_USERID = "Source-Id"
+	HEADER_USERID          = "Source-Id"
+	HEADER_IDEMPOTENCY_KEY = "Idempotency-Key"
+
+	// 投递回调的签名请求头
+	HEADER_NOTIFY_SIGNATURE = "X-Msg-Signature"
+	HEADER_NOTIFY_TIMESTAMP = "X-Msg-Timestamp"
 )
@@ -3,4 +3,5 @@ package constant
 const (
 	MAX_TASK_LIST_LIMIT     = 1000
 	DEFAULT_TASK_LIST_LIMIT = 1000
+	MAX_MSG_RECORDS_LIMIT   = 100 // 批量查询消息记录单次最多的消息ID数
 )
@@ -0,0 +1,191 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+)
+
+// QueueArchiver 队列表归档任务
+// 每隔MoveInterval将结束超过AliveThreshold的消息从队列表移入归档表，保持队列表较小；
+// 配置了TableMaxRows时，每隔SplitInterval检查归档表，超过后按时间后缀拆分
+type QueueArchiver struct {
+	// 分布式锁，保证只有一个节点在归档
+	lock *lock.RedisLock
+	// 是否是主节点的标志
+	isLeader bool
+	// 退出时取消
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	// 锁的key
+	LOCK_ARCHIVER_KEY = "QUEUE_ARCHIVER_LEADER"
+
+	// 锁的过期时间（秒）
+	LOCK_ARCHIVER_EXPIRE_SECONDS = 5
+
+	// 每批归档的最大消息数，每批一个事务
+	ARCHIVE_BATCH_SIZE = 500
+)
+
+// archiveQueueStatus 可以归档的队列消息状态
+var archiveQueueStatus = []int{
+	int(data.TASK_STATUS_SUCC),
+	int(data.TASK_STATUS_FAILED),
+	int(data.TASK_STATUS_EXPIRED),
+	int(data.TASK_STATUS_CANCELLED),
+}
+
+// archiveTimerStatus 可以归档的定时消息状态
+var archiveTimerStatus = []int{
+	int(data.TIMER_MSG_STATUS_SUCC),
+	int(data.TIMER_MSG_STATUS_FAILED),
+	int(data.TIMER_MSG_STATUS_CANCELLED),
+}
+
+// Start 启动归档任务
+func (s *QueueArchiver) Start() {
+	// 初始化锁和领导状态
+	s.lock = lock.NewRedisLock(LOCK_ARCHIVER_KEY,
+		lock.WithExpireSeconds(LOCK_ARCHIVER_EXPIRE_SECONDS),
+		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	s.isLeader = false
+	metrics.SetLeader(LOCK_ARCHIVER_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.archiveLoop(ctx)
+}
+
+// Stop 停止归档任务并释放主节点锁，等待进行中的一批完成
+func (s *QueueArchiver) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("队列归档任务解锁失败: %v", err)
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_ARCHIVER_KEY, false)
+	}
+}
+
+func (s *QueueArchiver) archiveLoop(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("queue_archiver")
+	defer health.WorkerStopped("queue_archiver")
+	moveTicker := time.NewTicker(time.Duration(config.Conf.Task.MoveInterval) * time.Second)
+	defer moveTicker.Stop()
+	splitTicker := time.NewTicker(time.Duration(config.Conf.Task.SplitInterval) * time.Second)
+	defer splitTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-moveTicker.C:
+			if s.checkLeader(ctx) {
+				s.archive(ctx)
+			}
+		case <-splitTicker.C:
+			if config.Conf.Task.TableMaxRows > 0 && s.checkLeader(ctx) {
+				s.split()
+			}
+		}
+	}
+}
+
+// checkLeader 非主节点时尝试获取锁，返回本节点是否为主节点
+// 归档间隔较长，每次到期时尝试一次即可，不需要单独轮询锁
+func (s *QueueArchiver) checkLeader(ctx context.Context) bool {
+	if s.isLeader {
+		return true
+	}
+	if err := s.lock.Lock(ctx); err != nil {
+		log.Infof("队列归档任务未能获取到主节点锁: %v", err)
+		return false
+	}
+	log.Infof("队列归档任务成功获取主节点锁，成为主节点")
+	s.isLeader = true
+	metrics.SetLeader(LOCK_ARCHIVER_KEY, true)
+	return true
+}
+
+// archive 将各队列表中结束超过AliveThreshold的消息分批移入归档表，Kafka模式下只有定时队列表
+func (s *QueueArchiver) archive(ctx context.Context) {
+	db := data.GetData().GetDB()
+	before := time.Now().Add(-time.Duration(config.Conf.Task.AliveThreshold) * time.Second)
+	if config.Conf.Common.MySQLAsMq {
+		for _, priority := range consumePriority {
+			priorityStr := data.GetPriorityStr(priority)
+			s.archiveTable(ctx, data.MsgQueueNsp.TableName()+"_"+priorityStr, func() (int64, error) {
+				return data.MsgQueueNsp.Archive(db, priorityStr, archiveQueueStatus, before, ARCHIVE_BATCH_SIZE)
+			})
+		}
+	}
+	s.archiveTable(ctx, data.MsgTmpQueueTimerNsp.TableName(), func() (int64, error) {
+		return data.MsgTmpQueueTimerNsp.Archive(db, archiveTimerStatus, before, ARCHIVE_BATCH_SIZE)
+	})
+}
+
+// archiveTable 反复执行一批归档，直到不足一批或退出
+func (s *QueueArchiver) archiveTable(ctx context.Context, table string, archiveBatch func() (int64, error)) {
+	var total int64
+	for ctx.Err() == nil {
+		moved, err := archiveBatch()
+		if err != nil {
+			log.Errorf("归档%s失败: %s", table, err.Error())
+			break
+		}
+		total += moved
+		if moved < ARCHIVE_BATCH_SIZE {
+			break
+		}
+	}
+	if total > 0 {
+		log.Infof("已将%s中 %d 条结束的消息移入归档表", table, total)
+	}
+}
+
+// split 归档表超过TableMaxRows时按时间后缀拆分，队列表超过时只告警，待处理的消息不能移走
+func (s *QueueArchiver) split() {
+	db := data.GetData().GetDB()
+	maxRows := int64(config.Conf.Task.TableMaxRows)
+	for _, table := range []string{data.MsgQueueNsp.HistoryTableName(), data.MsgTmpQueueTimerNsp.HistoryTableName()} {
+		rows, err := data.TableRows(db, table)
+		if err != nil {
+			log.Errorf("查询%s行数失败: %s", table, err.Error())
+			continue
+		}
+		if rows < maxRows {
+			continue
+		}
+		rotated, err := data.RotateTable(db, table, time.Now())
+		if err != nil {
+			log.Errorf("拆分%s失败: %s", table, err.Error())
+			continue
+		}
+		log.Infof("%s约 %d 行，超过 %d 行，已拆分为%s", table, rows, maxRows, rotated)
+	}
+
+	if !config.Conf.Common.MySQLAsMq {
+		return
+	}
+	for _, priority := range consumePriority {
+		table := data.MsgQueueNsp.TableName() + "_" + data.GetPriorityStr(priority)
+		rows, err := data.TableRows(db, table)
+		if err == nil && rows >= maxRows {
+			log.Warnf("%s约 %d 行，超过 %d 行，积压的消息过多", table, rows, maxRows)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msgpush"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+)
+
+// logAttempt 记录一次渠道发送的投递尝试，写入失败只记录日志，不影响投递
+func logAttempt(req *ctrlmodel.SendMsgReq, handler *MsgHandler, proc MsgIntf, latency time.Duration, sendErr error) {
+	attempt := &data.MsgAttempt{
+		MsgId:      req.MsgID,
+		Attempt:    len(req.AttemptHistory) + 1,
+		Channel:    handler.Channel,
+		Provider:   handler.Provider,
+		To:         req.To,
+		Status:     int(data.ATTEMPT_STATUS_SUCC),
+		LatencyMs:  latency.Milliseconds(),
+		WorkerNode: tools.NodeName(),
+	}
+	if sendErr != nil {
+		attempt.Status = int(data.ATTEMPT_STATUS_FAILED)
+		attempt.ErrorCategory, attempt.ErrorCode = msgpush.ClassifyError(sendErr)
+		attempt.Response = sendErr.Error()
+		if len(attempt.Response) > 1024 {
+			attempt.Response = attempt.Response[:1024]
+		}
+	} else {
+		attempt.ProviderMsgID = proc.Base().ProviderMsgID
+	}
+	outcome := "success"
+	if sendErr != nil {
+		outcome = attempt.ErrorCategory
+	}
+	metrics.SendDuration.WithLabelValues(data.GetChannelStr(handler.Channel), outcome).Observe(latency.Seconds())
+
+	if err := data.MsgAttemptNsp.Create(data.GetData().GetDB(), attempt); err != nil {
+		log.Errorf("记录消息 %s 的投递尝试失败: %s", req.MsgID, err.Error())
+	}
+}
@@ -0,0 +1,151 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+)
+
+const (
+	// 未单独配置的渠道的发送协程数
+	CHANNEL_POOL_FALLBACK_WORKERS = 2
+
+	// 渠道积压达到上限时消息停放的时长（毫秒），到期后经重试主题重新投递
+	CHANNEL_DEFER_DELAY_MS = 1000
+)
+
+// channelPool 一个渠道的发送协程池
+// workers个协程发送，已交给协程池、尚未发送完的消息不超过maxInflight，达到上限时不再接收
+type channelPool struct {
+	name     string
+	tasks    chan func()
+	inflight chan struct{}
+}
+
+// newChannelPool 创建渠道的发送协程池
+func newChannelPool(name string, workers, maxInflight int) *channelPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if maxInflight < workers {
+		maxInflight = workers
+	}
+	p := &channelPool{
+		name:     name,
+		tasks:    make(chan func(), maxInflight),
+		inflight: make(chan struct{}, maxInflight),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *channelPool) work() {
+	for task := range p.tasks {
+		p.run(task)
+	}
+}
+
+// run 执行一个任务，任务崩溃时记录日志，积压照常释放，不影响进程和其他消息
+func (p *channelPool) run(task func()) {
+	defer func() {
+		<-p.inflight
+		metrics.ChannelInflight.WithLabelValues(p.name).Dec()
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("%s渠道发送任务发生崩溃: %v", p.name, r)
+		}
+	}()
+	task()
+}
+
+// trySubmit 提交任务，积压达到上限时不提交并返回false，不阻塞调用方
+func (p *channelPool) trySubmit(task func()) bool {
+	select {
+	case p.inflight <- struct{}{}:
+	default:
+		return false
+	}
+	metrics.ChannelInflight.WithLabelValues(p.name).Inc()
+	// tasks与inflight容量相同，占到积压名额后写入不会阻塞
+	p.tasks <- task
+	return true
+}
+
+// channelPools Kafka模式下各渠道的发送协程池
+// 某个渠道积压达到上限时只停放该渠道的新消息，继续拉取和发送其他渠道的消息，
+// 一个渠道的服务商变慢时不会无限拉取消息占满内存，也不会拖慢其他渠道
+type channelPools struct {
+	pools    map[int]*channelPool
+	fallback *channelPool // 未单独配置的渠道
+}
+
+// sendChannels 单独配置发送协程池的渠道
+var sendChannels = []data.ChannelEnum{
+	data.Channel_EMAIL,
+	data.Channel_SMS,
+	data.Channel_LARK,
+}
+
+// newChannelPools 按配置为各渠道创建发送协程池
+func newChannelPools() *channelPools {
+	c := &channelPools{
+		pools: make(map[int]*channelPool, len(sendChannels)),
+	}
+	for _, channel := range sendChannels {
+		name := data.GetChannelStr(int(channel))
+		workers := config.Conf.Common.ChannelWorkers[name]
+		maxInflight := config.Conf.Common.ChannelMaxInflight[name]
+		log.Infof("%s渠道发送协程数: %d，积压上限: %d", name, workers, maxInflight)
+		c.pools[int(channel)] = newChannelPool(name, workers, maxInflight)
+	}
+	c.fallback = newChannelPool("other", CHANNEL_POOL_FALLBACK_WORKERS, CHANNEL_POOL_FALLBACK_WORKERS*10)
+	return c
+}
+
+// trySubmit 将消息交给对应渠道的协程池，该渠道积压达到上限时返回false和渠道名
+func (c *channelPools) trySubmit(channel int, task func()) (bool, string) {
+	pool, ok := c.pools[channel]
+	if !ok {
+		pool = c.fallback
+	}
+	return pool.trySubmit(task), pool.name
+}
+
+// deferToRetry 渠道积压时将消息停放到重试队列，CHANNEL_DEFER_DELAY_MS后经重试主题重新投递
+// 停放不计入重试次数，返回nil时可以提交该消息的位移
+func deferToRetry(ctx context.Context, req *ctrlmodel.SendMsgReq, pool string) error {
+	req.NextAttemptAt = time.Now().UnixMilli() + CHANNEL_DEFER_DELAY_MS
+	if err := parkForRetry(ctx, req); err != nil {
+		return err
+	}
+	metrics.ChannelDeferred.WithLabelValues(pool).Inc()
+	log.InfoContextf(ctx, "%s渠道积压达到上限，消息 %s 停放 %dms 后重新投递", pool, req.MsgID, CHANNEL_DEFER_DELAY_MS)
+	return nil
+}
+
+// sendChannel 消息实际投递的渠道，决定交给哪个渠道的协程池
+// 扇出后的消息带有渠道，模板消息取模板的渠道，直接发送多个渠道时按第一个渠道计
+func sendChannel(ctx context.Context, req *ctrlmodel.SendMsgReq) int {
+	if req.Channel != 0 {
+		return req.Channel
+	}
+	if req.TemplateID != "" {
+		tp, err := data.GetData().GetMsgTemplate(ctx, req.TemplateID)
+		if err != nil {
+			return 0
+		}
+		return tp.Channel
+	}
+	if len(req.Channels) > 0 {
+		return req.Channels[0]
+	}
+	return 0
+}
@@ -6,35 +6,39 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/lvdashuaibi/MsgPushSystem/src/config"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msgpush"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
-	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/mq"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
 type MsgConsume struct {
-	// 分布式锁映射，每个优先级一个锁
-	locks map[data.PriorityEnum]*lock.RedisLock
-	// 是否是主节点的标志，每个优先级一个标志
-	isLeader map[data.PriorityEnum]bool
+	// MySQL作为消息队列时发送消息的协程池，各优先级共用
+	pool *workerPool
+	// 消息队列模式下各渠道的发送协程池，各优先级共用
+	channels *channelPools
+	// 退出时取消，停止拉取新消息
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 const (
-	// 锁的前缀
-	LOCK_KEY_PREFIX = "MSG_LEADER_CONSUMER"
+	// MySQL队列没有到期消息时的查询间隔（毫秒），实际间隔上下浮动四分之一
+	DISPATCH_IDLE_INTERVAL_MS = 200
 
-	// 锁的过期时间（秒）
-	LOCK_EXPIRE_SECONDS = 30
-
-	// 非主节点尝试获取锁的间隔（秒）
-	LOCK_RETRY_INTERVAL_SECONDS = 30
+	// 协程池已满时等待空闲的间隔
+	DISPATCH_BUSY_INTERVAL = 20 * time.Millisecond
 )
 
 var consumePriority = []data.PriorityEnum{
@@ -46,27 +50,35 @@ var consumePriority = []data.PriorityEnum{
 
 // NewMsgConsume 创建一个新的消息消费实例
 func NewMsgConsume() *MsgConsume {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &MsgConsume{
-		locks:    make(map[data.PriorityEnum]*lock.RedisLock),
-		isLeader: make(map[data.PriorityEnum]bool),
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
+// Stop 停止拉取新消息，处理中的消息由WaitInflight等待
+func (s *MsgConsume) Stop() {
+	s.cancel()
+}
+
 // Consume 方法用于启动消息消费
 func (s *MsgConsume) Consume() {
-	// 初始化锁和领导状态
-	for _, priority := range consumePriority {
-		priorityStr := data.GetPriorityStr(priority)
-		lockKey := fmt.Sprintf("%s_%s", LOCK_KEY_PREFIX, priorityStr)
+	// MySQL作为消息队列时各节点都消费，由一个调度协程按权重认领各优先级的消息，交给协程池并发发送
+	if config.Conf.Common.MySQLAsMq {
+		s.pool = newWorkerPool(config.Conf.Common.MySQLConsumeWorkers)
+		log.Infof("启动MySQL消息调度，发送协程数: %d", config.Conf.Common.MySQLConsumeWorkers)
+		go s.startDispatcher()
+		return
+	}
 
-		// 如果使用MySQL作为消息队列，则使用分布式锁
-		if config.Conf.Common.MySQLAsMq {
-			s.locks[priority] = lock.NewRedisLock(lockKey,
-				lock.WithExpireSeconds(LOCK_EXPIRE_SECONDS),
-				lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	// 各优先级的消息按渠道交给发送协程池，某个渠道积压时只停放该渠道的消息
+	for _, priority := range consumePriority {
+		if consumer := data.GetData().GetConsumer(priority); consumer != nil {
+			consumer.SetRebalanceHooks(rebalanceHooks(priority))
 		}
-		s.isLeader[priority] = false
 	}
+	s.channels = newChannelPools()
 
 	// 同时启动高、中、低三个优先级的消费者
 	for _, priority := range consumePriority {
@@ -75,24 +87,49 @@ func (s *MsgConsume) Consume() {
 	}
 }
 
-// tryBeLeader 尝试成为主节点
-func (s *MsgConsume) tryBeLeader(ctx context.Context, priority data.PriorityEnum) bool {
+// rebalanceHooks 分区重新分配时记录本节点分到的分区
+func rebalanceHooks(priority data.PriorityEnum) mq.RebalanceHooks {
 	priorityStr := data.GetPriorityStr(priority)
-	redisLock := s.locks[priority]
-
-	// 尝试获取锁
-	err := redisLock.Lock(ctx)
-	if err != nil {
-		log.Infof("%s优先级消费者未能获取到主节点锁: %v", priorityStr, err)
-		return false
+	return mq.RebalanceHooks{
+		Setup: func(claims map[string][]int32) {
+			for topic, partitions := range claims {
+				log.Infof("%s优先级消费者分到主题%s的分区: %v", priorityStr, topic, partitions)
+				metrics.KafkaAssignedPartitions.WithLabelValues(topic).Set(float64(len(partitions)))
+			}
+		},
+		Cleanup: func(claims map[string][]int32) {
+			for topic := range claims {
+				log.Infof("%s优先级消费者交出主题%s的分区，提交已处理的位移", priorityStr, topic)
+				metrics.KafkaAssignedPartitions.WithLabelValues(topic).Set(0)
+			}
+		},
 	}
+}
+
+// consumerWorkerName 消费者在就绪检查中展示的名称
+func consumerWorkerName(priority data.PriorityEnum) string {
+	return "msg_consumer_" + data.GetPriorityStr(priority)
+}
+
+// startDispatcher 启动MySQL消息调度，崩溃后重启
+func (s *MsgConsume) startDispatcher() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("MySQL消息调度发生崩溃: %v，5秒后尝试重启", r)
+
+			// 在一段时间后重新启动调度，退出过程中不再重启
+			if sleepCtx(s.ctx, time.Second*5) {
+				go s.startDispatcher()
+			}
+		}
+	}()
 
-	log.Infof("%s优先级消费者成功获取主节点锁，成为主消费者", priorityStr)
-	return true
+	health.WorkerStarted("msg_dispatcher")
+	defer health.WorkerStopped("msg_dispatcher")
+	s.dispatchFromMySQL()
 }
 
-// startConsumer 启动指定优先级的消费者
-// 根据配置决定是从MySQL还是消息队列中消费
+// startConsumer 启动指定优先级的消息队列消费者
 func (s *MsgConsume) startConsumer(priority data.PriorityEnum) {
 	var consumer mq.Consumer
 	priorityStr := data.GetPriorityStr(priority)
@@ -106,140 +143,103 @@ func (s *MsgConsume) startConsumer(priority data.PriorityEnum) {
 			if r := recover(); r != nil {
 				log.Errorf("%s优先级消费者发生崩溃: %v，5秒后尝试重启", priorityStr, r)
 
-				// 如果是leader，在崩溃时尝试释放锁
-				if s.isLeader[priority] && s.locks[priority] != nil {
-					err := s.locks[priority].Unlock()
-					if err != nil {
-						log.Errorf("%s优先级消费者崩溃时解锁失败: %v", priorityStr, err)
-					} else {
-						log.Infof("%s优先级消费者崩溃时成功释放主节点锁", priorityStr)
-					}
-					s.isLeader[priority] = false
+				// 在一段时间后重新启动消费者，退出过程中不再重启
+				if sleepCtx(s.ctx, time.Second*5) {
+					go s.startConsumer(priority)
 				}
-
-				// 在一段时间后重新启动消费者
-				time.Sleep(time.Second * 5)
-				go s.startConsumer(priority)
 			}
 		}()
 
 		// 启动实际的消费流程
 		log.Infof("开始消费%s优先级消息", priorityStr)
-		if config.Conf.Common.MySQLAsMq {
-			// 使用MySQL作为消息中转站时，需要使用分布式锁
-			s.consumeFromMySQLWithLock(priority)
-		} else {
-			s.consumeFromMQ(consumer, priority)
-		}
+		s.consumeFromMQ(consumer, priority)
 	}()
 }
 
-// consumeFromMySQLWithLock 使用分布式锁从MySQL消费消息
-func (s *MsgConsume) consumeFromMySQLWithLock(priority data.PriorityEnum) {
+// consumeFromMQ 从消息队列中消费消息，按渠道交给发送协程池处理
+// 消息交出后继续拉取下一条，发送完成后才提交位移；渠道积压达到上限时该渠道的消息停放到重试队列
+func (s *MsgConsume) consumeFromMQ(consumer mq.Consumer, priority data.PriorityEnum) {
 	priorityStr := data.GetPriorityStr(priority)
-	ctx := context.Background()
-
-	// 确保函数退出时释放锁
-	defer func() {
-		if s.isLeader[priority] && s.locks[priority] != nil {
-			err := s.locks[priority].Unlock()
-			if err != nil {
-				log.Errorf("%s优先级消费者函数退出时解锁失败: %v", priorityStr, err)
-			} else {
-				log.Infof("%s优先级消费者函数退出时成功释放主节点锁", priorityStr)
-			}
-			s.isLeader[priority] = false
+	health.WorkerStarted(consumerWorkerName(priority))
+	defer health.WorkerStopped(consumerWorkerName(priority))
+	// 消费消息，退出时取消
+	consumer.ConsumeMessagesAsync(s.ctx, func(ctx context.Context, message []byte, ack func(error)) {
+		// 退出过程中不再处理新消息，不提交位移，由其他消费者重新消费
+		if !sends.begin() {
+			ack(errConsumerStopping)
+			return
 		}
-	}()
+		// ctx携带消息头中恢复的链路上下文
+		log.InfoContextf(ctx, "📨 [%s] 收到消息: %s", priorityStr, string(message))
 
-	// 首先尝试获取锁(消费者启动时，尝试获取锁)
-	s.isLeader[priority] = s.tryBeLeader(ctx, priority)
-
-	for {
-		if s.isLeader[priority] {
-			// 作为主节点，正常消费消息
-			log.Debugf("%s优先级消费者作为主节点消费消息", priorityStr)
-			s.consumeMySQLMsg(priority)
-
-			// 对于重试队列，使用更长的消费间隔
-			var step int64
-			if priority == data.PRIORITY_RETRY {
-				// 重试队列使用1000-2000ms的随机间隔
-				step = RandNum(1000) + 1000
-			} else {
-				// 其他队列使用0-500ms的随机间隔
-				step = RandNum(500)
+		var req = new(ctrlmodel.SendMsgReq)
+		if err := json.Unmarshal(message, &req); err != nil {
+			// 无法解析的消息重新消费也无法处理，直接跳过
+			log.ErrorContextf(ctx, "❌ [%s] 消息反序列化失败，跳过: %s, 原始消息: %s", priorityStr, err.Error(), string(message))
+			sends.end()
+			ack(nil)
+			return
+		}
+		log.InfoContextf(ctx, "✅ [%s] 消息反序列化成功，MsgID: %s, To: %s, TemplateID: %s", priorityStr, req.MsgID, req.To, req.TemplateID)
+
+		submitted, pool := s.channels.trySubmit(sendChannel(ctx, req), func() {
+			defer sends.end()
+			// 转入重试、死信时仍然崩溃的消息不提交位移，由重新消费时再次处理，该分区的位移不会一直卡住
+			defer func() {
+				if r := recover(); r != nil {
+					log.ErrorContextf(ctx, "❌ [%s] 消息处理发生崩溃，MsgID: %s: %v", priorityStr, req.MsgID, r)
+					ack(fmt.Errorf("message handler panicked: %v", r))
+				}
+			}()
+			// 退出时还未开始发送的消息不提交位移
+			if s.ctx.Err() != nil {
+				ack(errConsumerStopping)
+				return
 			}
+			ack(s.dealMQMsg(ctx, req, message, priorityStr))
+		})
+		if !submitted {
+			// 该渠道积压达到上限，停放后继续处理其他渠道的消息；停放失败时不提交位移，重新消费
+			sends.end()
+			ack(deferToRetry(ctx, req, pool))
+		}
+	})
+}
 
-			internelTime := time.Duration(step) * time.Millisecond
-			time.Sleep(internelTime)
-		} else {
-			// 作为备用节点，定期尝试获取锁
-			log.Debugf("%s优先级消费者作为备用节点，等待成为主节点", priorityStr)
-			time.Sleep(time.Second * LOCK_RETRY_INTERVAL_SECONDS)
-			s.isLeader[priority] = s.tryBeLeader(ctx, priority)
+// dealMQMsg 处理一条从消息队列中收到的消息，返回nil时提交位移
+func (s *MsgConsume) dealMQMsg(ctx context.Context, req *ctrlmodel.SendMsgReq, message []byte, priorityStr string) (err error) {
+	// 继续发送请求的链路，投递失败时span记录失败原因
+	ctx, span := startConsumeSpan(ctx, req, priorityStr)
+	defer func() { tracing.End(span, err) }()
 
-			if s.isLeader[priority] {
-				log.Infof("%s优先级消费者从备用节点升级为主节点", priorityStr)
-			}
-		}
+	// 已取消的消息直接跳过，消息记录已由取消接口更新
+	if data.GetData().IsCancelled(ctx, req.MsgID) {
+		log.InfoContextf(ctx, "[%s] 消息 %s 已取消，跳过", priorityStr, req.MsgID)
+		return nil
+	}
+	// 过期消息直接丢弃，不再投递
+	if isExpired(req) {
+		expireMsg(data.GetData().GetDB(), req, priorityStr)
+		return nil
 	}
-}
 
-// consumeFromMQ 从消息队列中消费消息并处理
-func (s *MsgConsume) consumeFromMQ(consumer mq.Consumer, priority data.PriorityEnum) {
-	priorityStr := data.GetPriorityStr(priority)
-	forNum := 1
-	if priority == data.PRIORITY_HIGH {
-		forNum = 6
-	} else if priority == data.PRIORITY_MIDDLE {
-		forNum = 3
-	} else if priority == data.PRIORITY_LOW {
-		forNum = 1
-	} else if priority == data.PRIORITY_RETRY {
-		forNum = 1
-	}
-	for i := 0; i < forNum; i++ {
-		// 使用匿名函数启动一个新的 goroutine
-		go func() {
-			log.Infof("🚀 启动%s优先级消费者goroutine", priorityStr)
-			// 消费消息
-			ctx := context.Background()
-			consumer.ConsumeMessages(ctx, func(message []byte) error {
-				// 创建一个新的上下文
-				ctx := context.Background()
-				// 记录日志
-				log.InfoContextf(ctx, "📨 [%s] 收到消息: %s", priorityStr, string(message))
-
-				// 创建一个新的 SendMsgReq 实例
-				var req = new(ctrlmodel.SendMsgReq)
-				// 反序列化消息
-				err := json.Unmarshal(message, &req)
-				if err != nil {
-					log.ErrorContextf(ctx, "❌ [%s] 消息反序列化失败: %s, 原始消息: %s", priorityStr, err.Error(), string(message))
-					return err
-				}
-				log.InfoContextf(ctx, "✅ [%s] 消息反序列化成功，MsgID: %s, To: %s, TemplateID: %s", priorityStr, req.MsgID, req.To, req.TemplateID)
-
-				// 处理消息
-				log.InfoContextf(ctx, "🔄 [%s] 开始处理消息，MsgID: %s", priorityStr, req.MsgID)
-				err = dealOneMsg(ctx, req)
-				if err != nil {
-					log.ErrorContextf(ctx, "❌ [%s] 消息处理失败，MsgID: %s, 错误: %s", priorityStr, req.MsgID, err.Error())
-					// 进入重试
-					return s.handleMqRetryAfterFailure(ctx, req, message, priorityStr)
-				}
-				log.InfoContextf(ctx, "✅ [%s] 消息处理成功，MsgID: %s", priorityStr, req.MsgID)
-				return nil
-			})
-		}()
+	// 处理消息
+	log.InfoContextf(ctx, "🔄 [%s] 开始处理消息，MsgID: %s", priorityStr, req.MsgID)
+	err = dealOneMsgSafely(ctx, req)
+	if err != nil {
+		log.ErrorContextf(ctx, "❌ [%s] 消息处理失败，MsgID: %s, 错误: %s", priorityStr, req.MsgID, err.Error())
+		// 进入重试
+		return s.handleMqRetryAfterFailure(ctx, req, message, priorityStr, err)
 	}
+	log.InfoContextf(ctx, "✅ [%s] 消息处理成功，MsgID: %s", priorityStr, req.MsgID)
+	return nil
 }
 
 // handleMqRetryAfterFailure 处理mq消息处理失败后的重试逻辑
-func (s *MsgConsume) handleMqRetryAfterFailure(ctx context.Context, req *ctrlmodel.SendMsgReq, message []byte, priorityStr string) error {
+func (s *MsgConsume) handleMqRetryAfterFailure(ctx context.Context, req *ctrlmodel.SendMsgReq, message []byte, priorityStr string, sendErr error) error {
 	// 获取数据实例
 	dt := data.GetData()
+	category := recordAttempt(dt.GetDB(), req, sendErr)
 
 	// 增加重试次数并检查是否达到上限
 	newCount, retryErr := data.MsgRecordNsp.IncrementRetryCount(dt.GetDB(), req.MsgID)
@@ -248,22 +248,73 @@ func (s *MsgConsume) handleMqRetryAfterFailure(ctx context.Context, req *ctrlmod
 		// 即使更新失败也要继续重试
 	}
 
-	// 检查重试次数是否达到上限
-	if newCount >= config.Conf.Common.MaxRetryCount {
-		log.Infof("消息 %s 已达到最大重试次数 %d，不再重试",
-			req.MsgID, config.Conf.Common.MaxRetryCount)
-		// 更新消息状态为最终失败
-		data.MsgRecordNsp.UpdateStatus(dt.GetDB(), req.MsgID, int(data.MSG_STATUS_FAILED))
+	// 当前渠道用尽（永久错误、重试次数达到上限或超时）时切换到下一个降级渠道，否则判断是否最终失败
+	permanent := category == msgpush.ERR_CATEGORY_PERMANENT
+	if hasFallback(req) && (permanent || channelExhausted(req, newCount)) {
+		switchToFallback(dt.GetDB(), req)
+		newCount = 0
+	} else if permanent || newCount >= config.Conf.Common.MaxRetryCount {
+		if permanent {
+			log.Infof("消息 %s 投递遇到永久错误，不再重试: %s", req.MsgID, sendErr.Error())
+		} else {
+			log.Infof("消息 %s 已达到最大重试次数 %d，不再重试",
+				req.MsgID, config.Conf.Common.MaxRetryCount)
+		}
+		// 先转入死信，死信主题和死信表都写入失败时不提交位移，由重新消费时再次处理
+		if err := deadLetter(dt.GetDB(), req, newCount, sendErr); err != nil {
+			return err
+		}
+		// 更新消息状态为最终失败，处理过程中被取消的消息保持取消状态
+		cancelled := errors.Is(data.MsgRecordNsp.UpdateStatus(dt.GetDB(), req.MsgID, int(data.MSG_STATUS_FAILED)), data.ErrMsgCancelled)
+		if !cancelled {
+			publishStatus(ctx, req, data.MSG_EVENT_FAILED, newCount, sendErr)
+		}
 		// 更新队列状态为最终失败
 		data.MsgQueueNsp.SetStatus(dt.GetDB(), priorityStr, req.MsgID, int(data.TASK_STATUS_FAILED))
+		// 回调通知最终失败
+		if !cancelled {
+			tools.NotifyFinalStatus(dt.GetDB(), req.MsgID, int(data.MSG_STATUS_FAILED), req.Channel, len(req.AttemptHistory), sendErr.Error())
+		}
 		return nil
 	}
 
-	log.InfoContextf(ctx, "消息 %s 当前重试次数: %d/%d，加入重试队列",
-		req.MsgID, newCount, config.Conf.Common.MaxRetryCount)
-	// 扔进重试主题处理
-	data.GetData().GetRetryMQProducer().SendMessage("", message)
-	return nil // 返回nil，避免消息被重复消费
+	// 按退避时间停放到Redis，到期后由重试调度器投递到重试主题
+	// 失败历史和降级进度（渠道、接收者、截止时间）随消息一起停放
+	req.NextAttemptAt = nextAttemptAt(newCount, category)
+	if err := data.MsgRecordNsp.UpdateNextAttemptAt(dt.GetDB(), req.MsgID, req.NextAttemptAt); err != nil {
+		log.Errorf("更新消息 %s 下次重试时间失败: %s", req.MsgID, err.Error())
+	}
+	publishStatus(ctx, req, data.MSG_EVENT_RETRYING, newCount, sendErr)
+	metrics.MsgRetries.WithLabelValues(data.GetChannelStr(req.Channel), category).Inc()
+	log.InfoContextf(ctx, "消息 %s 当前重试次数: %d/%d，%s 后重试",
+		req.MsgID, newCount, config.Conf.Common.MaxRetryCount,
+		time.Until(time.UnixMilli(req.NextAttemptAt)).Round(time.Millisecond))
+	if err := parkForRetry(ctx, req); err != nil {
+		log.ErrorContextf(ctx, "消息 %s 停放到重试集合失败，直接投递到重试主题: %s", req.MsgID, err.Error())
+		msgJson, err := json.Marshal(req)
+		if err != nil {
+			log.ErrorContextf(ctx, "json marshal err %s", err.Error())
+		} else {
+			message = msgJson
+		}
+		// 扔进重试主题处理，投递失败时不提交位移，由重新消费时再次处理
+		if err := data.GetData().GetRetryMQProducer().SendMessage(ctx, "", message); err != nil {
+			log.ErrorContextf(ctx, "消息 %s 投递到重试主题失败: %s", req.MsgID, err.Error())
+			return err
+		}
+	}
+	return nil // 已停放或转入重试主题，提交位移
+}
+
+// dealOneMsgSafely 处理一条消息，发送过程中崩溃时按发送失败返回，由重试、死信流程处理
+func dealOneMsgSafely(ctx context.Context, req *ctrlmodel.SendMsgReq) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ErrorContextf(ctx, "❌ 消息发送发生崩溃，MsgID: %s: %v", req.MsgID, r)
+			err = fmt.Errorf("send panicked: %v", r)
+		}
+	}()
+	return dealOneMsg(ctx, req)
 }
 
 // dealOneMsg 处理一条消息
@@ -273,6 +324,7 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 
 	// 获取数据实例
 	dt := data.GetData()
+	publishStatus(ctx, req, data.MSG_EVENT_PROCESSING, len(req.AttemptHistory), nil)
 
 	var tp *data.MsgTemplate
 	var content string
@@ -284,49 +336,70 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 	if req.TemplateID != "" {
 		// 模板模式
 		log.InfoContextf(ctx, "📋 模板模式：获取消息模板，TemplateID: %s", req.TemplateID)
-		tp, err = dt.GetMsgTemplate(ctx, req.TemplateID)
+		fetchCtx, span := tracing.Start(ctx, "template.fetch", attribute.String("msg.template_id", req.TemplateID))
+		tp, err = dt.GetMsgTemplate(fetchCtx, req.TemplateID)
+		tracing.End(span, err)
 		if err != nil {
 			log.ErrorContextf(ctx, "❌ 获取消息模板失败: %s", err.Error())
+			// 模板已删除时重试没有意义
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return msgpush.NewSendError(msgpush.ERR_CATEGORY_PERMANENT, "template_not_found", err)
+			}
 			return err
 		}
 		log.InfoContextf(ctx, "✅ 获取消息模板成功，Channel: %d, Subject: %s, Content长度: %d",
 			tp.Channel, tp.Subject, len(tp.Content))
 
+		// 降级后的消息使用降级渠道发送模板内容
+		channel := tp.Channel
+		if req.Channel != 0 {
+			channel = req.Channel
+		}
+
 		// 替换模板中的变量
-		if tp.Channel == int(data.Channel_EMAIL) || tp.Channel == int(data.Channel_LARK) {
+		if channel == int(data.Channel_EMAIL) || channel == int(data.Channel_LARK) {
 			log.InfoContextf(ctx, "🔄 开始模板变量替换，原内容: %s", tp.Content)
+			_, span := tracing.Start(ctx, "template.render", attribute.String("msg.template_id", req.TemplateID))
 			content, err = tools.TemplateReplace(tp.Content, req.TemplateData)
+			tracing.End(span, err)
 			if err != nil {
 				log.ErrorContextf(ctx, "❌ 模板变量替换失败: %s", err.Error())
-				return err
+				return msgpush.NewSendError(msgpush.ERR_CATEGORY_PERMANENT, "template_render_failed", err)
 			}
 			log.InfoContextf(ctx, "✅ 模板变量替换成功，替换后内容: %s", content)
 		}
 		subject = tp.Subject
-		channels = []int{tp.Channel}
-	} else if req.Content != "" && len(req.Channels) > 0 {
+		channels = []int{channel}
+	} else if req.Content != "" && (req.Channel != 0 || len(req.Channels) > 0) {
 		// 直接发送模式
 		log.InfoContextf(ctx, "📝 直接发送模式：使用请求中的内容和渠道")
 		content = req.Content
 		subject = req.Subject
 		channels = req.Channels
+		// 按(接收者, 渠道)扇出的消息只投递自己的渠道，接收者就是该渠道的联系方式
+		if req.Channel != 0 {
+			channels = []int{req.Channel}
+		}
 		log.InfoContextf(ctx, "✅ 直接发送参数：Channels: %v, Subject: %s, Content: %s",
 			channels, subject, content)
 	} else {
 		log.ErrorContextf(ctx, "❌ 既没有模板ID也没有直接发送内容")
-		return errors.New("neither template nor direct content provided")
+		return msgpush.NewSendError(msgpush.ERR_CATEGORY_PERMANENT, "invalid_request",
+			errors.New("neither template nor direct content provided"))
 	}
 
 	// 遍历所有渠道发送消息
 	var lastErr error
 	successCount := 0
+	deliveredChannel := 0
 	for _, channel := range channels {
 		// 根据通道类型获取消息处理器
 		log.InfoContextf(ctx, "🔍 查找消息处理器，Channel: %d", channel)
 		handler, ok := msgProcMap[channel]
 		if !ok {
 			log.ErrorContextf(ctx, "❌ 不支持的渠道类型: %d", channel)
-			lastErr = fmt.Errorf("channel %d not support", channel)
+			lastErr = msgpush.NewSendError(msgpush.ERR_CATEGORY_PERMANENT, "channel_not_supported",
+				fmt.Errorf("channel %d not support", channel))
 			continue
 		}
 		log.InfoContextf(ctx, "✅ 找到消息处理器，Channel: %d", channel)
@@ -340,12 +413,19 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 		t.Base().Priority = req.Priority
 		t.Base().TemplateID = req.TemplateID
 		t.Base().TemplateData = req.TemplateData
+		t.Base().NotifyURL = req.NotifyURL
 
 		log.InfoContextf(ctx, "📧 准备发送消息，Channel: %d, To: %s, Subject: %s, Content: %s",
 			channel, req.To, subject, content)
 
-		// 发送消息
+		// 发送消息，每次发送记录一条投递尝试
+		_, span := tracing.Start(ctx, "channel.send",
+			attribute.String("msg.channel", data.GetChannelStr(channel)),
+			attribute.String("msg.provider", handler.Provider))
+		start := time.Now()
 		err = t.SendMsg()
+		tracing.End(span, err)
+		logAttempt(req, handler, t, time.Since(start), err)
 		if err != nil {
 			log.ErrorContextf(ctx, "❌ 渠道 %d 发送消息失败: %s", channel, err.Error())
 			lastErr = err
@@ -353,6 +433,9 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 		}
 		log.InfoContextf(ctx, "✅ 渠道 %d 发送消息成功", channel)
 		successCount++
+		if deliveredChannel == 0 {
+			deliveredChannel = channel
+		}
 	}
 
 	// 如果所有渠道都失败，返回错误
@@ -364,10 +447,21 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 	// 使用通用函数创建或更新消息记录
 	// 如果记录存在则更新状态，如果不存在则创建新记录
 	err = tools.CreateOrUpdateMsgRecord(dt.GetDB(), req.MsgID, req, tp, int(data.MSG_STATUS_SUCC))
-	if err != nil {
+	cancelled := errors.Is(err, data.ErrMsgCancelled)
+	if err != nil && !cancelled {
 		log.ErrorContextf(ctx, "创建或更新消息记录失败: %s", err.Error())
 		// 消息记录操作失败不应影响消息队列状态更新
 	}
+	// 处理过程中被取消的消息保持取消状态，不再记录投递渠道和回调
+	if !cancelled {
+		// 记录最终投递成功的渠道
+		if err = data.MsgRecordNsp.UpdateDeliveredChannel(dt.GetDB(), req.MsgID, deliveredChannel); err != nil {
+			log.ErrorContextf(ctx, "更新消息 %s 投递渠道失败: %s", req.MsgID, err.Error())
+		}
+		// 回调通知投递成功，尝试次数包含失败历史和本次成功的投递
+		tools.NotifyFinalStatus(dt.GetDB(), req.MsgID, int(data.MSG_STATUS_SUCC), deliveredChannel,
+			len(req.AttemptHistory)+1, "")
+	}
 
 	// 更新消息状态为成功
 	priorityStr := data.GetPriorityStr(data.PriorityEnum(req.Priority))
@@ -383,7 +477,9 @@ func dealOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 }
 
 // dealRetryMysqlQueue 将消息发送到重试队列
-func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
+// ctx中的链路上下文随重试消息保存，重试消费时继续同一条链路
+func dealRetryMysqlQueue(ctx context.Context, db *gorm.DB, req *ctrlmodel.SendMsgReq, sendErr error) error {
+	category := recordAttempt(db, req, sendErr)
 
 	// 增加重试次数
 	newCount, retryErr := data.MsgRecordNsp.IncrementRetryCount(db, req.MsgID)
@@ -395,29 +491,70 @@ func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 			req.MsgID, newCount, config.Conf.Common.MaxRetryCount)
 	}
 
-	// 检查重试次数是否达到上限
-	if newCount >= config.Conf.Common.MaxRetryCount {
-		log.Infof("消息 %s 已达到最大重试次数 %d，不再重试",
-			req.MsgID, config.Conf.Common.MaxRetryCount)
-		// 更新消息状态为最终失败
-		data.MsgRecordNsp.UpdateStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED))
+	// 当前渠道用尽（永久错误、重试次数达到上限或超时）时切换到下一个降级渠道，否则判断是否最终失败
+	permanent := category == msgpush.ERR_CATEGORY_PERMANENT
+	if hasFallback(req) && (permanent || channelExhausted(req, newCount)) {
+		switchToFallback(db, req)
+		newCount = 0
+	} else if permanent || newCount >= config.Conf.Common.MaxRetryCount {
+		if permanent {
+			log.Infof("消息 %s 投递遇到永久错误，不再重试: %s", req.MsgID, sendErr.Error())
+		} else {
+			log.Infof("消息 %s 已达到最大重试次数 %d，不再重试",
+				req.MsgID, config.Conf.Common.MaxRetryCount)
+		}
+		// 先转入死信，写入失败时队列中的消息保持处理中，由卡住消息的回收放回后再次处理
+		if err := deadLetter(db, req, newCount, sendErr); err != nil {
+			return err
+		}
+		// 更新消息状态为最终失败，处理过程中被取消的消息保持取消状态
+		cancelled := errors.Is(data.MsgRecordNsp.UpdateStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED)), data.ErrMsgCancelled)
+		if !cancelled {
+			publishStatus(ctx, req, data.MSG_EVENT_FAILED, newCount, sendErr)
+		}
 		// 更新队列状态为最终失败
 		priorityStr := data.GetPriorityStr(data.PriorityEnum(req.Priority))
 		data.MsgQueueNsp.SetStatus(db, priorityStr, req.MsgID, int(data.TASK_STATUS_FAILED))
+		// 回调通知最终失败
+		if !cancelled {
+			tools.NotifyFinalStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED), req.Channel, len(req.AttemptHistory), sendErr.Error())
+		}
 		return nil
 	}
 
 	// 生成唯一的消息ID
 	msgID := req.MsgID
 
+	// 按退避时间设置下次尝试时间，重试表只消费到期的消息
+	req.NextAttemptAt = nextAttemptAt(newCount, category)
+	if err := data.MsgRecordNsp.UpdateNextAttemptAt(db, msgID, req.NextAttemptAt); err != nil {
+		log.Errorf("更新消息 %s 下次重试时间失败: %s", msgID, err.Error())
+	}
+	publishStatus(ctx, req, data.MSG_EVENT_RETRYING, newCount, sendErr)
+	metrics.MsgRetries.WithLabelValues(data.GetChannelStr(req.Channel), category).Inc()
+
 	// 检查消息是否已存在于重试队列
 	retryPriorityStr := data.GetPriorityStr(data.PRIORITY_RETRY)
 	existingMsg, err := data.MsgQueueNsp.Find(db, retryPriorityStr, msgID)
 
 	if existingMsg != nil && existingMsg.ID != 0 && err != gorm.ErrRecordNotFound {
 		log.Infof("消息 %s 已存在于重试队列，更新状态为待处理", msgID)
-		// 更新状态为待处理，而不是创建新记录
-		return data.MsgQueueNsp.SetStatus(db, retryPriorityStr, msgID, int(data.TASK_STATUS_PENDING))
+		// 更新状态为待处理，而不是创建新记录，同时更新失败历史
+		var dic = map[string]interface{}{
+			"status":          int(data.TASK_STATUS_PENDING),
+			"attempt_history": req.AttemptHistory,
+			"next_attempt_at": req.NextAttemptAt,
+			"trace_context":   tracing.Marshal(ctx),
+		}
+		// 带降级进度的消息同时更新渠道、接收者、降级渠道的模板和降级进度
+		if req.FallbackState != nil {
+			dic["to"] = req.To
+			dic["channel"] = req.Channel
+			dic["template_id"] = req.TemplateID
+			dic["content"] = req.Content
+			dic["fallback"] = req.FallbackState
+		}
+		return data.MsgQueueNsp.Updates(db, retryPriorityStr, msgID, dic)
 	}
 
 	// 创建一个新的消息队列实例
@@ -425,6 +562,7 @@ func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 
 	// 设置消息的主题
 	md.Subject = req.Subject
+	md.BatchID = req.BatchID
 
 	// 设置消息的模板ID
 	md.TemplateID = req.TemplateID
@@ -438,8 +576,15 @@ func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 	// 设置消息的模板数据
 	md.TemplateData = string(td)
 
-	// 设置消息的接收者
+	// 设置消息的接收者、渠道和内容
 	md.To = req.To
+	md.Channel = req.Channel
+	md.Content = req.Content
+	md.Fallback = req.FallbackState
+	md.ExpireAt = req.ExpireAt
+	md.AttemptHistory = req.AttemptHistory
+	md.NextAttemptAt = req.NextAttemptAt
+	md.TraceContext = tracing.Marshal(ctx)
 
 	// 设置消息的ID
 	md.MsgId = msgID
@@ -454,7 +599,7 @@ func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 	err = data.MsgQueueNsp.Create(db, retryPriorityStr, md)
 	if err != nil {
 		// 处理可能的重复键错误
-		if strings.Contains(err.Error(), "Duplicate entry") {
+		if data.IsDuplicateEntry(err) {
 			log.Warnf("消息 %s 在重试队列中已存在（并发处理）", msgID)
 			return nil
 		}
@@ -466,96 +611,194 @@ func dealRetryMysqlQueue(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 	return nil
 }
 
-// consumeFromMySQL 从MySQL消费消息（不使用分布式锁，已废弃）
-func (s *MsgConsume) consumeFromMySQL(priority data.PriorityEnum) {
-	priorityStr := data.GetPriorityStr(priority)
-	log.Infof("开始从MySQL消费%s优先级消息", priorityStr)
+// dispatchFromMySQL 从MySQL队列调度消息
+// 单个调度协程按权重从各优先级的队列表中认领消息，数量以协程池的空闲数为准，认领后交给协程池发送；
+// 各节点同时拉取，消息用SELECT ... FOR UPDATE SKIP LOCKED认领，不会被多个节点重复处理，
+// 节点崩溃后认领的消息一直处于处理中，由ProcessingReaper超时后放回
+func (s *MsgConsume) dispatchFromMySQL() {
+	log.Infof("开始从MySQL调度消息")
+	scheduler := newPriorityScheduler()
 
 	for {
-		// 对于重试队列，使用更长的消费间隔
-		var step int64
-		if priority == data.PRIORITY_RETRY {
-			// 重试队列使用1000-2000ms的随机间隔
-			step = RandNum(1000) + 1000
-		} else {
-			// 其他队列使用0-500ms的随机间隔
-			step = RandNum(500)
+		scheduler.refresh(s.ctx)
+		claimed := s.dispatchRound(scheduler)
+
+		var interval time.Duration
+		if s.pool.free() == 0 {
+			// 协程池已满，等待有消息发送完成
+			interval = DISPATCH_BUSY_INTERVAL
+		} else if claimed == 0 {
+			// 各队列都没有到期的消息，随机间隔避免各节点同时查询
+			interval = time.Duration(DISPATCH_IDLE_INTERVAL_MS+RandNum(DISPATCH_IDLE_INTERVAL_MS/4)) * time.Millisecond
+		}
+		if !sleepCtx(s.ctx, interval) {
+			log.Infof("MySQL消息调度停止拉取消息")
+			return
 		}
-
-		internelTime := time.Duration(step) * time.Millisecond
-		t := time.NewTimer(internelTime)
-		// 等待定时器触发
-		<-t.C
-		// 消费MySQL消息
-		s.consumeMySQLMsg(priority)
 	}
 }
 
-func (s *MsgConsume) consumeMySQLMsg(priority data.PriorityEnum) {
+// dispatchRound 按权重将协程池的空闲数分给各优先级并认领消息，返回认领的消息数
+// 某个优先级的到期消息不足分得的数量时，本轮剩余的空闲数再按权重分给其他优先级
+func (s *MsgConsume) dispatchRound(scheduler *priorityScheduler) int {
+	capacity := s.pool.free()
+	candidates := consumePriority
+	total := 0
+	for capacity > 0 && len(candidates) > 0 && s.ctx.Err() == nil {
+		plan := scheduler.plan(capacity, candidates)
+		next := make([]data.PriorityEnum, 0, len(candidates))
+		for _, priority := range candidates {
+			n := plan[priority]
+			if n == 0 {
+				next = append(next, priority)
+				continue
+			}
+			claimed := s.claimMySQLMsg(priority, n)
+			total += claimed
+			capacity -= claimed
+			if claimed == n {
+				next = append(next, priority)
+			}
+		}
+		candidates = next
+	}
+	return total
+}
 
+// claimMySQLMsg 认领指定优先级最多limit条消息，交给协程池发送，返回认领的消息数
+func (s *MsgConsume) claimMySQLMsg(priority data.PriorityEnum, limit int) int {
 	dt := data.GetData()
 	priorityStr := data.GetPriorityStr(priority)
-	pullNum := 60
-	if priority == data.PRIORITY_MIDDLE {
-		pullNum = 30
-	} else if priority == data.PRIORITY_LOW {
-		pullNum = 10
-	}
-	msgList, err := data.MsgQueueNsp.GetMsgList(dt.GetDB(),
-		priorityStr, int(data.TASK_STATUS_PENDING), pullNum)
-	// 如果获取消息列表时发生错误，则返回
+	msgList, err := data.MsgQueueNsp.ClaimMsgList(dt.GetDB(), priorityStr, tools.NodeName(), limit)
 	if err != nil {
-		return
+		log.Errorf("认领%s优先级消息失败: %s", priorityStr, err.Error())
+		return 0
+	}
+	if len(msgList) == 0 {
+		return 0
 	}
-	// 创建一个字符串切片，用于存储消息ID
 	msgIdList := make([]string, len(msgList))
-	// 遍历消息列表，将每个消息的ID添加到msgIdList中
 	for i, dbMsg := range msgList {
 		msgIdList[i] = dbMsg.MsgId
 	}
-	// 如果msgIdList不为空，则批量设置消息状态为处理中
-	if len(msgIdList) != 0 {
-		err = data.MsgQueueNsp.BatchSetStatus(dt.GetDB(), priorityStr, msgIdList,
-			int(data.TASK_STATUS_PROCESSING))
-		// 如果批量设置消息状态时发生错误，则返回
-		if err != nil {
-			return
-		}
+	claimQueueMsgs(priorityStr, msgIdList)
+	metrics.MsgDispatched.WithLabelValues(priorityStr).Add(float64(len(msgList)))
+
+	for _, dbMsg := range msgList {
+		dbMsg := dbMsg
+		s.pool.submit(func() {
+			s.dealQueueMsg(priority, dbMsg)
+		})
+	}
+	return len(msgList)
+}
+
+// dealQueueMsg 处理一条认领的队列消息
+func (s *MsgConsume) dealQueueMsg(priority data.PriorityEnum, dbMsg *data.MsgQueue) {
+	// 退出时未开始处理的消息由RequeueClaimed放回待处理
+	if s.ctx.Err() != nil || !sends.begin() {
+		return
 	}
+	defer sends.end()
+
+	dt := data.GetData()
+	priorityStr := data.GetPriorityStr(priority)
+	defer releaseQueueMsg(priorityStr, dbMsg.MsgId)
 	ctx := context.Background()
-	// 遍历消息列表，处理每个消息
-	for _, dbMsg := range msgList {
-		// 创建一个新的SendMsgReq实例
-		var req = new(ctrlmodel.SendMsgReq)
-		req.MsgID = dbMsg.MsgId
-		req.Priority = dbMsg.Priority
-		// 设置消息的接收者
-		req.To = dbMsg.To
-		// 设置消息的主题
-		req.Subject = dbMsg.Subject
-		// 设置消息的模板ID
-		req.TemplateID = dbMsg.TemplateID
-		// 反序列化消息的模板数据
-		req.TemplateData = make(map[string]string, 0)
-		err := json.Unmarshal([]byte(dbMsg.TemplateData), &req.TemplateData)
-		// 如果反序列化时发生错误，则返回
-		if err != nil {
-			log.ErrorContextf(ctx, "unmarshal template data err %s", err.Error())
+	req, err := queueMsgToReq(dbMsg)
+	if err != nil {
+		failInvalidQueueMsg(ctx, priorityStr, req, err)
+		return
+	}
+	// 继续入队时保存的链路
+	msgCtx, span := startConsumeSpan(tracing.Unmarshal(ctx, dbMsg.TraceContext), req, priorityStr)
+	// 已取消的消息直接跳过（取消时已在处理中的消息）
+	if dt.IsCancelled(msgCtx, req.MsgID) {
+		log.InfoContextf(msgCtx, "消息 %s 已取消，跳过", req.MsgID)
+		data.MsgQueueNsp.SetStatus(dt.GetDB(), priorityStr, req.MsgID, int(data.TASK_STATUS_CANCELLED))
+		span.End()
+		return
+	}
+	// 过期消息直接丢弃，不再投递
+	if isExpired(req) {
+		expireMsg(dt.GetDB(), req, priorityStr)
+		span.End()
+		return
+	}
+	// 处理单个消息
+	err = dealOneMsg(msgCtx, req)
+	tracing.End(span, err)
+	if err != nil {
+		// 如果处理失败，则将消息发送到重试队列
+		log.ErrorContextf(msgCtx, "处理消息 %s 失败，准备加入重试队列: %s", req.MsgID, err.Error())
+
+		if err := dealRetryMysqlQueue(msgCtx, dt.GetDB(), req, err); err != nil {
+			log.ErrorContextf(msgCtx, "发送消息 %s 到重试队列失败: %s", req.MsgID, err.Error())
 			return
 		}
-		// 处理单个消息
-		if err := dealOneMsg(ctx, req); err != nil {
-			// 如果处理失败，则将消息发送到重试队列
-			log.ErrorContextf(ctx, "处理消息 %s 失败，准备加入重试队列: %s", req.MsgID, err.Error())
-
-			if err := dealRetryMysqlQueue(dt.GetDB(), req); err != nil {
-				log.ErrorContextf(ctx, "发送消息 %s 到重试队列失败: %s", req.MsgID, err.Error())
-				return
-			}
+		// 消息已转入重试队列，原队列中的这一条结束处理，避免一直处于处理中被当作卡住的消息放回
+		if priority != data.PRIORITY_RETRY {
+			data.MsgQueueNsp.CompareAndSetStatus(dt.GetDB(), priorityStr, req.MsgID,
+				int(data.TASK_STATUS_PROCESSING), int(data.TASK_STATUS_FAILED))
 		}
 	}
 }
 
+// failInvalidQueueMsg 无法还原的队列消息重试也不会成功，直接转入死信并标记为最终失败
+// 转入死信失败时保持处理中，由卡住消息的回收超时后转入死信
+func failInvalidQueueMsg(ctx context.Context, priorityStr string, req *ctrlmodel.SendMsgReq, decodeErr error) {
+	db := data.GetData().GetDB()
+	log.ErrorContextf(ctx, "%s优先级消息 %s 无法还原，转入死信: %s", priorityStr, req.MsgID, decodeErr.Error())
+	if err := deadLetter(db, req, 0, decodeErr); err != nil {
+		return
+	}
+	data.MsgQueueNsp.CompareAndSetStatus(db, priorityStr, req.MsgID,
+		int(data.TASK_STATUS_PROCESSING), int(data.TASK_STATUS_FAILED))
+	if errors.Is(data.MsgRecordNsp.UpdateStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED)), data.ErrMsgCancelled) {
+		return
+	}
+	publishStatus(ctx, req, data.MSG_EVENT_FAILED, 0, decodeErr)
+	tools.NotifyFinalStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED), req.Channel,
+		len(req.AttemptHistory), decodeErr.Error())
+}
+
+// queueMsgToReq 将MySQL队列中的消息还原为发送请求
+// 模板数据无法解析时返回错误，同时返回不含模板数据的请求，用于转入死信
+func queueMsgToReq(dbMsg *data.MsgQueue) (*ctrlmodel.SendMsgReq, error) {
+	// 创建一个新的SendMsgReq实例
+	var req = new(ctrlmodel.SendMsgReq)
+	req.MsgID = dbMsg.MsgId
+	req.BatchID = dbMsg.BatchID
+	req.Priority = dbMsg.Priority
+	// 设置消息的接收者、渠道和内容
+	req.To = dbMsg.To
+	req.Channel = dbMsg.Channel
+	req.Content = dbMsg.Content
+	req.FallbackState = dbMsg.Fallback
+	req.ExpireAt = dbMsg.ExpireAt
+	req.AttemptHistory = dbMsg.AttemptHistory
+	// 设置消息的主题
+	req.Subject = dbMsg.Subject
+	// 设置消息的模板ID
+	req.TemplateID = dbMsg.TemplateID
+	// 反序列化消息的模板数据
+	req.TemplateData = make(map[string]string, 0)
+	if err := json.Unmarshal([]byte(dbMsg.TemplateData), &req.TemplateData); err != nil {
+		req.TemplateData = nil
+		return req, fmt.Errorf("invalid template data %q: %w", dbMsg.TemplateData, err)
+	}
+	return req, nil
+}
+
+// startConsumeSpan 以消息携带的链路上下文为父span创建消费span
+func startConsumeSpan(ctx context.Context, req *ctrlmodel.SendMsgReq, priorityStr string) (context.Context, trace.Span) {
+	return tracing.StartConsumer(ctx, "msg.consume",
+		attribute.String("msg.id", req.MsgID),
+		attribute.String("msg.priority", priorityStr),
+		attribute.String("msg.channel", data.GetChannelStr(req.Channel)),
+		attribute.Int("msg.attempt", len(req.AttemptHistory)+1))
+}
+
 // RandNum func for rand num
 func RandNum(num int64) int64 {
 	step := rand.Int63n(num) + int64(1)
@@ -565,21 +808,3 @@ func RandNum(num int64) int64 {
 	}
 	return step
 }
-
-// UnlockAll 释放所有持有的分布式锁
-func (s *MsgConsume) UnlockAll() {
-	for priority, isLeader := range s.isLeader {
-		// 只需要解锁自己是leader的锁
-		if isLeader && s.locks[priority] != nil {
-			priorityStr := data.GetPriorityStr(priority)
-			err := s.locks[priority].Unlock()
-			if err != nil {
-				log.Errorf("%s优先级消费者解锁失败: %v", priorityStr, err)
-			} else {
-				log.Infof("%s优先级消费者成功释放主节点锁", priorityStr)
-			}
-			// 更新状态
-			s.isLeader[priority] = false
-		}
-	}
-}
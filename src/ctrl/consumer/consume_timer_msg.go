@@ -3,6 +3,7 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"strconv"
 	"time"
 
@@ -13,7 +14,13 @@ import (
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
 )
 
 type TimerMsgConsume struct {
@@ -21,6 +28,11 @@ type TimerMsgConsume struct {
 	lock *lock.RedisLock
 	// 是否是主节点的标志，每个优先级一个标志
 	isLeader bool
+	// 退出时取消，停止扫描定时消息
+	cancel context.CancelFunc
+	done   chan struct{}
+	// 投递到期定时消息的协程池
+	pool *workerPool
 }
 
 const (
@@ -32,6 +44,9 @@ const (
 
 	// 非主节点尝试获取锁的间隔（秒）
 	LOCK_TIMER_RETRY_INTERVAL_SECONDS = 5
+
+	// 同时投递的到期定时消息数，协程池满时暂停扫描
+	TIMER_DISPATCH_WORKERS = 20
 )
 
 // Consume 方法用于启动消息消费
@@ -41,22 +56,56 @@ func (s *TimerMsgConsume) Consume() {
 		lock.WithExpireSeconds(LOCK_TIMER_EXPIRE_SECONDS),
 		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
 	s.isLeader = false
-	ctx := context.Background()
+	metrics.SetLeader(LOCK_TIMER_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.pool = newWorkerPool(TIMER_DISPATCH_WORKERS)
 	// 启动处理定时消息
 	go s.consumeFromTimer(ctx)
 }
 
+// Stop 停止扫描定时消息并释放主节点锁，已开始投递的定时消息由WaitInflight等待
+func (s *TimerMsgConsume) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("定时消费者解锁失败: %v", err)
+		} else {
+			log.Infof("定时消费者成功释放主节点锁")
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_TIMER_KEY, false)
+	}
+}
+
 func (s *TimerMsgConsume) consumeFromTimer(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("timer_consumer")
+	defer health.WorkerStopped("timer_consumer")
 	ticker := time.NewTicker(time.Duration(100) * time.Millisecond)
 	defer ticker.Stop()
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("定时消费者停止扫描")
+			return
+		case <-ticker.C:
+		}
 		if s.isLeader {
 			s.consumeTimerMsg()
 		} else {
 			// 作为备用节点，定期尝试获取锁
 			log.Debugf("定时消费者作为备用节点，等待成为主节点")
-			time.Sleep(time.Second * LOCK_TIMER_RETRY_INTERVAL_SECONDS)
+			if !sleepCtx(ctx, time.Second*LOCK_TIMER_RETRY_INTERVAL_SECONDS) {
+				return
+			}
 			s.isLeader = s.tryBeLeader(ctx)
+			metrics.SetLeader(LOCK_TIMER_KEY, s.isLeader)
 			if s.isLeader {
 				log.Infof("定时消费者从备用节点升级为主节点")
 			}
@@ -115,6 +164,7 @@ func (s *TimerMsgConsume) consumeTimerMsg() {
 		if err != nil {
 			return
 		}
+		claimTimerMsgs(msgIdList)
 	}
 
 	// 遍历消息列表，处理每个消息
@@ -126,25 +176,51 @@ func (s *TimerMsgConsume) consumeTimerMsg() {
 			log.ErrorContextf(ctx, "unmarshal message err %s", err.Error())
 			return
 		}
-		// 处理消息
+		// 处理消息，继续发送请求时保存的链路
 		req.MsgID = dbMsg.MsgId
-		go func() {
+		traceContext := dbMsg.TraceContext
+		// 退出过程中剩余的消息不再投递，由RequeueClaimed放回待处理
+		if !sends.begin() {
+			return
+		}
+		s.pool.submit(func() {
+			defer sends.end()
+			ctx, span := tracing.Start(tracing.Unmarshal(ctx, traceContext), "timer.dispatch",
+				attribute.String("msg.id", req.MsgID))
 			status := int(data.TIMER_MSG_STATUS_SUCC)
-			err = reSendOneMsg(ctx, req)
-			if err != nil {
+			err := reSendOneMsg(ctx, req)
+			if err != nil && !errors.Is(err, data.ErrMsgCancelled) {
 				// 重试一次消息
 				err = reSendOneMsg(ctx, req)
-				if err != nil {
-					log.ErrorContextf(ctx, "reSendOneMsg err %s", err.Error())
-					status = int(data.TIMER_MSG_STATUS_FAILED)
-				}
 			}
+			if errors.Is(err, data.ErrMsgCancelled) {
+				// 处理中被取消的定时消息不再入队
+				log.InfoContextf(ctx, "定时消息 %s 已取消，不再入队", req.MsgID)
+				status = int(data.TIMER_MSG_STATUS_CANCELLED)
+				err = nil
+			} else if err != nil {
+				log.ErrorContextf(ctx, "reSendOneMsg err %s", err.Error())
+				status = int(data.TIMER_MSG_STATUS_FAILED)
+			}
+			tracing.End(span, err)
 			err = data.MsgTmpQueueTimerNsp.SetStatus(dt.GetDB(), req.MsgID, status)
+			releaseTimerMsg(req.MsgID)
 			if err != nil {
 				log.ErrorContextf(ctx, "更新定时消息状态失败 err %s", err.Error())
 				return
 			}
-		}()
+		})
+	}
+}
+
+// rearmTimerMsgs 定时消费者只在Timer_Msgs中有到期时间点时扫描，
+// 放回待处理的定时消息需要重新登记一个当前时间点才会被再次扫描到
+func rearmTimerMsgs(ctx context.Context) {
+	now := time.Now().Unix()
+	err := data.GetData().GetCache().ZAdd(ctx, "Timer_Msgs",
+		redis.Z{Score: float64(now), Member: strconv.FormatInt(now, 10)})
+	if err != nil {
+		log.ErrorContextf(ctx, "登记放回的定时消息失败: %s", err.Error())
 	}
 }
 
@@ -158,52 +234,63 @@ func reSendOneMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 		log.ErrorContextf(ctx, "获取消息模板失败: %s", err.Error())
 	}
 
-	var sendErr error
-	if config.Conf.Common.MySQLAsMq {
-		sendErr = sendToMySQL(ctx, req)
-		if sendErr != nil {
-			log.Errorf(" timer sendToMySQL err %s", sendErr.Error())
+	// 消息和消息记录在同一个事务中持久化，Kafka模式下消息先写入发件箱
+	var outbox *data.MsgOutbox
+	sendErr := dt.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		if config.Conf.Common.MySQLAsMq {
+			err = sendToMySQL(ctx, tx, req)
+		} else {
+			outbox, err = sendToOutbox(ctx, tx, req)
 		}
-	} else {
-		sendErr = sendToMQ(ctx, req)
-		if sendErr != nil {
-			log.Errorf(" timer sendToMQ err %s", sendErr.Error())
+		if err != nil {
+			return err
 		}
+		// 发送成功，消息记录标记为待处理
+		return tools.CreateOrUpdateMsgRecord(tx, req.MsgID, req, tp, int(data.MSG_STATUS_PENDING))
+	})
+
+	// 消息ID已在队列或发件箱中：上次入队的事务已提交，节点在更新定时消息状态前崩溃，
+	// 定时消息被回收后再次入队，按已入队处理，不覆盖可能已发送成功的消息记录
+	if data.IsDuplicateEntry(sendErr) {
+		log.InfoContextf(ctx, "定时消息 %s 已入队，跳过重复入队", req.MsgID)
+		return nil
 	}
 
-	// 不管发送是否成功，都更新消息记录状态
-	// 如果发送成功，标记为"待处理"；如果发送失败，标记为失败或错误状态
-	var status int
-	if sendErr != nil {
-		status = int(data.MSG_STATUS_FAILED) // 使用负数表示错误状态
-	} else {
-		status = int(data.MSG_STATUS_PENDING) // 发送成功，标记为待处理
-	}
-
-	// 使用通用函数更新消息记录状态
-	updateErr := tools.CreateOrUpdateMsgRecord(dt.GetDB(), req.MsgID, req, tp, status)
-	if updateErr != nil {
-		log.ErrorContextf(ctx, "更新定时消息记录状态失败: %s", updateErr.Error())
-		// 更新状态失败不影响主流程
+	// 消息记录已取消，事务回滚，消息不入队
+	if errors.Is(sendErr, data.ErrMsgCancelled) {
+		return sendErr
 	}
 
-	// 如果发送失败，返回错误
+	// 如果发送失败，标记为失败状态并返回错误
 	if sendErr != nil {
+		log.Errorf(" timer send err %s", sendErr.Error())
+		updateErr := tools.CreateOrUpdateMsgRecord(dt.GetDB(), req.MsgID, req, tp, int(data.MSG_STATUS_FAILED))
+		if updateErr != nil {
+			log.ErrorContextf(ctx, "更新定时消息记录状态失败: %s", updateErr.Error())
+		}
 		return sendErr
 	}
 
+	metrics.MsgEnqueued.WithLabelValues(data.GetPriorityStr(data.PriorityEnum(req.Priority))).Inc()
+
+	// 事务提交后立即投递，投递失败时由发件箱中继补偿
+	if outbox != nil {
+		if err := tools.PublishOutboxMsg(dt.GetDB(), outbox); err != nil {
+			log.Warnf("定时消息 %s 投递到MQ失败，等待发件箱中继重试: %s", req.MsgID, err.Error())
+		}
+	}
+
 	return nil
 }
 
-func sendToMySQL(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
-	// 获取数据实例
-	dt := data.GetData()
-
+func sendToMySQL(ctx context.Context, db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
 	// 创建一个新的消息队列实例
 	var md = new(data.MsgQueue)
 
 	// 设置消息的主题
 	md.Subject = req.Subject
+	md.BatchID = req.BatchID
 
 	// 设置消息的模板ID
 	md.TemplateID = req.TemplateID
@@ -217,18 +304,23 @@ func sendToMySQL(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 	// 设置消息的模板数据
 	md.TemplateData = string(td)
 
-	// 设置消息的接收者
+	// 设置消息的接收者、渠道和内容
 	md.To = req.To
+	md.Channel = req.Channel
+	md.Content = req.Content
+	md.Fallback = req.FallbackState
+	md.ExpireAt = req.ExpireAt
 
-	// 设置消息的ID
+	// 设置消息的ID和链路上下文
 	md.MsgId = req.MsgID
+	md.TraceContext = tracing.Marshal(ctx)
 
 	// 设置消息的初始状态
 	md.Status = int(data.TASK_STATUS_PENDING)
 	md.Priority = req.Priority
 
 	// 将消息插入到MySQL数据库中
-	err = data.MsgQueueNsp.Create(dt.GetDB(),
+	err = data.MsgQueueNsp.Create(db,
 		data.GetPriorityStr(data.PriorityEnum(req.Priority)), md)
 	if err != nil {
 		return err
@@ -237,35 +329,24 @@ func sendToMySQL(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
 	return nil
 }
 
-func sendToMQ(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
-	// 获取数据实例
-	log.Infof("into sendToMQ")
-	dt := data.GetData()
-
+// sendToOutbox 将消息写入发件箱，db为调用方的事务
+func sendToOutbox(ctx context.Context, db *gorm.DB, req *ctrlmodel.SendMsgReq) (*data.MsgOutbox, error) {
 	// 将请求结构体转换为JSON格式
 	msgJson, err := json.Marshal(req)
 	if err != nil {
-		log.ErrorContextf(context.Background(), "json marshal err %s", err.Error())
-		return err
+		log.ErrorContextf(ctx, "json marshal err %s", err.Error())
+		return nil, err
 	}
 
-	// 根据消息优先级选择对应的消息队列生产者
-	if req.Priority == int(data.PRIORITY_LOW) {
-		// 获取低优先级消息队列生产者
-		producer := dt.GetLowMQProducer()
-		// 发送消息到低优先级消息队列
-		return producer.SendMessage("", msgJson)
-	} else if req.Priority == int(data.PRIORITY_MIDDLE) {
-		// 获取中优先级消息队列生产者
-		producer := dt.GetMiddleMQProducer()
-		// 发送消息到中优先级消息队列
-		return producer.SendMessage("", msgJson)
-	} else if req.Priority == int(data.PRIORITY_HIGH) {
-		// 获取高优先级消息队列生产者
-		producer := dt.GetHighMQProducer()
-		// 发送消息到高优先级消息队列
-		return producer.SendMessage("", msgJson)
+	var outbox = &data.MsgOutbox{
+		MsgId:        req.MsgID,
+		Priority:     req.Priority,
+		Payload:      string(msgJson),
+		TraceContext: tracing.Marshal(ctx),
+		Status:       int(data.OUTBOX_STATUS_PENDING),
 	}
-	// 返回nil，表示发送成功
-	return nil
+	if err = data.MsgOutboxNsp.Create(db, outbox); err != nil {
+		return nil, err
+	}
+	return outbox, nil
 }
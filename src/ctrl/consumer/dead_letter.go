@@ -0,0 +1,140 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msgpush"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// recordAttempt 对本次投递失败分类，追加到消息的失败历史并记录到消息记录中，返回错误分类
+func recordAttempt(db *gorm.DB, req *ctrlmodel.SendMsgReq, sendErr error) string {
+	category, code := msgpush.ClassifyError(sendErr)
+	req.AttemptHistory = req.AttemptHistory.Append(data.AttemptInfo{
+		Time:     time.Now().Unix(),
+		Channel:  req.Channel,
+		To:       req.To,
+		Error:    sendErr.Error(),
+		Category: category,
+		Code:     code,
+	})
+	if err := data.MsgRecordNsp.UpdateErrorClass(db, req.MsgID, category, code, sendErr.Error()); err != nil {
+		log.Errorf("记录消息 %s 的错误分类失败: %s", req.MsgID, err.Error())
+	}
+	if category == msgpush.ERR_CATEGORY_AUTH {
+		log.Errorf("消息 %s 投递遇到鉴权或账号错误，需要人工处理: %s", req.MsgID, sendErr.Error())
+	}
+	return category
+}
+
+// deadLetter 将达到最大重试次数的消息转入死信
+// Kafka模式下投递到死信主题，未配置死信主题或投递失败时直接写入死信表，都失败时返回错误
+func deadLetter(db *gorm.DB, req *ctrlmodel.SendMsgReq, retryCount int, sendErr error) error {
+	metrics.MsgDeadLetters.WithLabelValues(data.GetChannelStr(req.Channel)).Inc()
+	msg := &ctrlmodel.DeadLetterMsg{
+		Req:        req,
+		LastError:  sendErr.Error(),
+		RetryCount: retryCount,
+	}
+	if !config.Conf.Common.MySQLAsMq {
+		if producer := data.GetData().GetDeadMQProducer(); producer != nil {
+			body, err := json.Marshal(msg)
+			if err == nil {
+				err = producer.SendMessage(context.Background(), "", body)
+			}
+			if err == nil {
+				log.Infof("消息 %s 已投递到死信主题", req.MsgID)
+				return nil
+			}
+			log.Errorf("消息 %s 投递到死信主题失败，直接写入死信表: %s", req.MsgID, err.Error())
+		}
+	}
+	if err := saveDeadLetter(db, msg); err != nil {
+		log.Errorf("消息 %s 写入死信表失败: %s", req.MsgID, err.Error())
+		return err
+	}
+	log.Infof("消息 %s 已写入死信表", req.MsgID)
+	return nil
+}
+
+// saveDeadLetter 将死信写入死信表
+func saveDeadLetter(db *gorm.DB, msg *ctrlmodel.DeadLetterMsg) error {
+	req := msg.Req
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	lastError := msg.LastError
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+	return data.MsgDeadLetterNsp.Save(db, &data.MsgDeadLetter{
+		MsgId:          req.MsgID,
+		BatchID:        req.BatchID,
+		To:             req.To,
+		Channel:        req.Channel,
+		Priority:       req.Priority,
+		Req:            string(body),
+		LastError:      lastError,
+		AttemptHistory: req.AttemptHistory,
+		RetryCount:     msg.RetryCount,
+		Status:         int(data.DEAD_LETTER_STATUS_DEAD),
+	})
+}
+
+// DeadLetterConsume 死信主题消费者，将死信写入死信表供查询和重放
+type DeadLetterConsume struct {
+	// 退出时取消，停止消费死信主题
+	cancel context.CancelFunc
+}
+
+// Start 启动死信主题消费，MySQL作为消息队列时死信直接写表，不需要消费
+func (s *DeadLetterConsume) Start() {
+	if config.Conf.Common.MySQLAsMq {
+		return
+	}
+	consumer := data.GetData().GetDeadMQConsumer()
+	if consumer == nil {
+		log.Warnf("未配置死信主题，死信将直接写入死信表")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		health.WorkerStarted("dead_letter_consumer")
+		defer health.WorkerStopped("dead_letter_consumer")
+		consumer.ConsumeMessages(ctx, func(ctx context.Context, message []byte) error {
+			if !sends.begin() {
+				return errConsumerStopping
+			}
+			defer sends.end()
+			var msg = new(ctrlmodel.DeadLetterMsg)
+			if err := json.Unmarshal(message, msg); err != nil || msg.Req == nil {
+				// 无法解析的死信无法重放，记录日志后丢弃
+				log.Errorf("死信反序列化失败，原始消息: %s", string(message))
+				return nil
+			}
+			if err := saveDeadLetter(data.GetData().GetDB(), msg); err != nil {
+				log.Errorf("消息 %s 写入死信表失败: %s", msg.Req.MsgID, err.Error())
+				return err
+			}
+			log.Infof("消息 %s 已从死信主题写入死信表", msg.Req.MsgID)
+			return nil
+		})
+	}()
+}
+
+// Stop 停止消费死信主题
+func (s *DeadLetterConsume) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
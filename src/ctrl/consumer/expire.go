@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+// isExpired 判断消息是否已超过有效期
+func isExpired(req *ctrlmodel.SendMsgReq) bool {
+	return req.ExpireAt > 0 && time.Now().Unix() >= req.ExpireAt
+}
+
+// expireMsg 丢弃过期消息，消息记录和队列都标记为已过期
+func expireMsg(db *gorm.DB, req *ctrlmodel.SendMsgReq, priorityStr string) {
+	log.Infof("消息 %s 已于 %s 过期，不再投递", req.MsgID,
+		time.Unix(req.ExpireAt, 0).Format(time.DateTime))
+
+	err := tools.CreateOrUpdateMsgRecord(db, req.MsgID, req, nil, int(data.MSG_STATUS_EXPIRED))
+	if errors.Is(err, data.ErrMsgCancelled) {
+		return
+	}
+	if err != nil {
+		log.Errorf("更新消息 %s 记录为已过期失败: %s", req.MsgID, err.Error())
+	}
+	if config.Conf.Common.MySQLAsMq {
+		if err := data.MsgQueueNsp.SetStatus(db, priorityStr, req.MsgID, int(data.TASK_STATUS_EXPIRED)); err != nil {
+			log.Errorf("更新消息 %s 队列状态为已过期失败: %s", req.MsgID, err.Error())
+		}
+	}
+	// 回调通知已过期
+	tools.NotifyFinalStatus(db, req.MsgID, int(data.MSG_STATUS_EXPIRED), req.Channel,
+		len(req.AttemptHistory), "message expired")
+}
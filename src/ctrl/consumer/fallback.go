@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+// hasFallback 判断消息是否还有可用的降级渠道
+func hasFallback(req *ctrlmodel.SendMsgReq) bool {
+	return req.FallbackState != nil && len(req.FallbackState.Targets) > 0
+}
+
+// channelExhausted 判断当前渠道是否已经用尽：重试次数达到上限，或超过了降级策略的单渠道尝试时间
+// 当前渠道首次失败时设置截止时间
+func channelExhausted(req *ctrlmodel.SendMsgReq, retryCount int) bool {
+	if retryCount >= config.Conf.Common.MaxRetryCount {
+		return true
+	}
+	state := req.FallbackState
+	if state == nil || state.Timeout <= 0 {
+		return false
+	}
+	now := time.Now().Unix()
+	if state.Deadline == 0 {
+		state.Deadline = now + int64(state.Timeout)
+		return false
+	}
+	return now >= state.Deadline
+}
+
+// switchToFallback 切换到下一个降级渠道，新渠道重新计算重试次数
+func switchToFallback(db *gorm.DB, req *ctrlmodel.SendMsgReq) {
+	from := req.Channel
+	next, rest := req.FallbackState.Next()
+	req.Channel = next.Channel
+	req.Channels = []int{next.Channel}
+	req.To = next.To
+	// 短信等需要渠道专用模板的降级目标改用策略中指定的模板
+	if next.TemplateID != "" {
+		req.TemplateID = next.TemplateID
+	}
+	req.FallbackState = rest
+
+	if err := data.MsgRecordNsp.UpdateRetryCount(db, req.MsgID, 0); err != nil {
+		log.Errorf("重置消息 %s 重试次数失败: %s", req.MsgID, err.Error())
+	}
+	log.Infof("消息 %s 渠道 %d 已用尽，降级到渠道 %d，接收者: %s，剩余降级渠道: %d",
+		req.MsgID, from, next.Channel, next.To, len(rest.Targets))
+}
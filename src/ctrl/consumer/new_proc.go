@@ -2,12 +2,14 @@ package consumer
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msgpush"
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
 )
 
 type MsgIntf interface {
@@ -16,8 +18,9 @@ type MsgIntf interface {
 }
 
 type MsgHandler struct {
-	Channel int
-	NewProc func() MsgIntf
+	Channel  int
+	Provider string // 渠道供应商，记录在投递尝试日志中
+	NewProc  func() MsgIntf
 }
 
 type MsgBase struct {
@@ -28,6 +31,8 @@ type MsgBase struct {
 	TemplateID   string            `json:"templateID" form:"templateID"`
 	TemplateData map[string]string `json:"templateData" form:"templateData"`
 	NotifyURL    string            `json:"notifyUrl" form:"notifyUrl"`
+	// 发送成功后由处理器设置渠道供应商返回的消息ID
+	ProviderMsgID string `json:"-" form:"-"`
 }
 
 // Base func get base struct
@@ -37,18 +42,21 @@ func (p *MsgBase) Base() *MsgBase {
 
 func InitMsgProc() {
 	emailMsgProc := MsgHandler{
-		Channel: int(data.Channel_EMAIL),
-		NewProc: func() MsgIntf { return new(EmailMsgProc) },
+		Channel:  int(data.Channel_EMAIL),
+		Provider: "smtp",
+		NewProc:  func() MsgIntf { return new(EmailMsgProc) },
 	}
 	RegisterHandler(&emailMsgProc)
 	smsMsgProc := MsgHandler{
-		Channel: int(data.Channel_SMS),
-		NewProc: func() MsgIntf { return new(SMSMsgProc) },
+		Channel:  int(data.Channel_SMS),
+		Provider: "aliyun_sms",
+		NewProc:  func() MsgIntf { return new(SMSMsgProc) },
 	}
 	RegisterHandler(&smsMsgProc)
 	larkProc := MsgHandler{
-		Channel: int(data.Channel_LARK),
-		NewProc: func() MsgIntf { return new(LarkProc) },
+		Channel:  int(data.Channel_LARK),
+		Provider: "lark",
+		NewProc:  func() MsgIntf { return new(LarkProc) },
 	}
 	RegisterHandler(&larkProc)
 }
@@ -67,11 +75,12 @@ type EmailMsgProc struct {
 func (p *EmailMsgProc) SendMsg() error {
 	// 发送对应消息
 	log.Infof("📧 EmailMsgProc开始发送邮件，To: %s, Subject: %s, Content: %s", p.To, p.Subject, p.Content)
-	err := msgpush.SendEmail(p.To, p.Subject, p.Content)
+	messageID, err := msgpush.SendEmail(p.To, p.Subject, p.Content)
 	if err != nil {
 		log.Errorf("❌ EmailMsgProc发送邮件失败: %s", err.Error())
 		return err
 	}
+	p.ProviderMsgID = messageID
 	log.Infof("✅ EmailMsgProc发送邮件成功，To: %s", p.To)
 	return nil
 }
@@ -85,13 +94,17 @@ func (p *SMSMsgProc) SendMsg() error {
 	dt := data.GetData()
 	mt, err := data.MsgTemplateNsp.Find(dt.GetDB(), p.TemplateID)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return msgpush.NewSendError(msgpush.ERR_CATEGORY_PERMANENT, "template_not_found", err)
+		}
 		return err
 	}
 	templateParam, _ := json.Marshal(p.TemplateData)
-	err = msgpush.SendSMS(p.To, mt.SignName, mt.RelTemplateID, string(templateParam))
+	bizID, err := msgpush.SendSMS(p.To, mt.SignName, mt.RelTemplateID, string(templateParam))
 	if err != nil {
 		return err
 	}
+	p.ProviderMsgID = bizID
 	return nil
 }
 
@@ -110,18 +123,20 @@ func (p *LarkProc) SendMsg() error {
 	// 检查内容是否为JSON格式的卡片（AI润色生成的）
 	// 如果内容以 { 开头并包含 "config" 或 "header"，则认为是卡片JSON
 	content := p.Content
+	var messageID string
 	if len(content) > 0 && content[0] == '{' &&
 		(strings.Contains(content, `"config"`) || strings.Contains(content, `"header"`)) {
 		// 使用卡片消息发送
 		log.Infof("🎨 检测到飞书卡片格式，使用卡片消息发送")
-		err = msgpush.SendCardMessageFromJSON(accessToken, p.To, content)
+		messageID, err = msgpush.SendCardMessageFromJSON(accessToken, p.To, content)
 	} else {
 		// 使用普通文本消息发送
-		err = msgpush.SendMessage(accessToken, p.To, content)
+		messageID, err = msgpush.SendTextMessage(accessToken, p.To, content)
 	}
 
 	if err != nil {
 		return err
 	}
+	p.ProviderMsgID = messageID
 	return nil
 }
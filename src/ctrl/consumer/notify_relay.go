@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+)
+
+// NotifyRelay 回调中继，投递待投递回调表中到期的回调，同时进行的回调请求数有上限
+type NotifyRelay struct {
+	// 分布式锁，保证只有一个节点在投递回调
+	lock *lock.RedisLock
+	// 是否是主节点的标志
+	isLeader bool
+	// 退出时取消
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	// 锁的key
+	LOCK_NOTIFY_KEY = "NOTIFY_RELAY_LEADER"
+
+	// 锁的过期时间（秒）
+	LOCK_NOTIFY_EXPIRE_SECONDS = 5
+
+	// 非主节点尝试获取锁的间隔（秒）
+	LOCK_NOTIFY_RETRY_INTERVAL_SECONDS = 5
+
+	// 每轮投递的最大回调数
+	NOTIFY_RELAY_BATCH_SIZE = 100
+
+	// 同时进行的回调请求数
+	NOTIFY_RELAY_WORKERS = 8
+)
+
+// Start 启动回调中继
+func (s *NotifyRelay) Start() {
+	// 初始化锁和领导状态
+	s.lock = lock.NewRedisLock(LOCK_NOTIFY_KEY,
+		lock.WithExpireSeconds(LOCK_NOTIFY_EXPIRE_SECONDS),
+		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	s.isLeader = false
+	metrics.SetLeader(LOCK_NOTIFY_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.relayLoop(ctx)
+}
+
+// Stop 停止回调中继并释放主节点锁，等待进行中的回调请求完成，未投递的回调留在表中由下次启动后投递
+func (s *NotifyRelay) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("回调中继解锁失败: %v", err)
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_NOTIFY_KEY, false)
+	}
+}
+
+func (s *NotifyRelay) relayLoop(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("notify_relay")
+	defer health.WorkerStopped("notify_relay")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isLeader {
+			s.relayNotifyTask(ctx)
+		} else {
+			// 作为备用节点，定期尝试获取锁
+			log.Debugf("回调中继作为备用节点，等待成为主节点")
+			if !sleepCtx(ctx, time.Second*LOCK_NOTIFY_RETRY_INTERVAL_SECONDS) {
+				return
+			}
+			s.isLeader = s.tryBeLeader(ctx)
+			metrics.SetLeader(LOCK_NOTIFY_KEY, s.isLeader)
+			if s.isLeader {
+				log.Infof("回调中继从备用节点升级为主节点")
+			}
+		}
+	}
+}
+
+// tryBeLeader 尝试成为主节点
+func (s *NotifyRelay) tryBeLeader(ctx context.Context) bool {
+	err := s.lock.Lock(ctx)
+	if err != nil {
+		log.Infof("回调中继未能获取到主节点锁: %v", err)
+		return false
+	}
+
+	log.Infof("回调中继成功获取主节点锁，成为主节点")
+	return true
+}
+
+// relayNotifyTask 投递一批到期的回调，最多NOTIFY_RELAY_WORKERS个并发，本批全部完成后返回
+// 退出时不再发起新的回调，只等待进行中的回调完成
+func (s *NotifyRelay) relayNotifyTask(ctx context.Context) {
+	db := data.GetData().GetDB()
+	tasks, err := data.MsgNotifyTaskNsp.GetDueList(db, NOTIFY_RELAY_BATCH_SIZE)
+	if err != nil {
+		log.Errorf("获取待投递回调失败: %s", err.Error())
+		return
+	}
+
+	sem := make(chan struct{}, NOTIFY_RELAY_WORKERS)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, task := range tasks {
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(task *data.MsgNotifyTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			tools.DeliverNotifyTask(db, task)
+		}(task)
+	}
+}
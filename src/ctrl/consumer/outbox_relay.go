@@ -0,0 +1,172 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/mq"
+)
+
+// OutboxRelay 发件箱中继，将发送请求中未能即时投递的发件箱消息补投到Kafka，并清理超过保留时长的已投递消息
+type OutboxRelay struct {
+	// 分布式锁，保证只有一个节点在中继
+	lock *lock.RedisLock
+	// 是否是主节点的标志
+	isLeader bool
+	// 退出时取消
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	// 锁的key
+	LOCK_OUTBOX_KEY = "OUTBOX_RELAY_LEADER"
+
+	// 锁的过期时间（秒）
+	LOCK_OUTBOX_EXPIRE_SECONDS = 5
+
+	// 非主节点尝试获取锁的间隔（秒）
+	LOCK_OUTBOX_RETRY_INTERVAL_SECONDS = 5
+
+	// 每次中继的最大消息数
+	OUTBOX_RELAY_BATCH_SIZE = 100
+
+	// 清理已投递消息的间隔
+	OUTBOX_PURGE_INTERVAL = time.Minute
+
+	// 每次删除的最大消息数，分批删除避免长时间锁表
+	OUTBOX_PURGE_BATCH_SIZE = 1000
+)
+
+// Start 启动发件箱中继，MySQL作为消息队列时不需要中继
+func (s *OutboxRelay) Start() {
+	if config.Conf.Common.MySQLAsMq {
+		return
+	}
+	// 初始化锁和领导状态
+	s.lock = lock.NewRedisLock(LOCK_OUTBOX_KEY,
+		lock.WithExpireSeconds(LOCK_OUTBOX_EXPIRE_SECONDS),
+		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	s.isLeader = false
+	metrics.SetLeader(LOCK_OUTBOX_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.relayLoop(ctx)
+}
+
+// Stop 停止发件箱中继并释放主节点锁，等待进行中的一轮完成
+func (s *OutboxRelay) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("发件箱中继解锁失败: %v", err)
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_OUTBOX_KEY, false)
+	}
+}
+
+func (s *OutboxRelay) relayLoop(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("outbox_relay")
+	defer health.WorkerStopped("outbox_relay")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastPurge time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isLeader {
+			s.relayOutboxMsg()
+			if time.Since(lastPurge) >= OUTBOX_PURGE_INTERVAL {
+				lastPurge = time.Now()
+				s.purgeSentMsg(ctx)
+			}
+		} else {
+			// 作为备用节点，定期尝试获取锁
+			log.Debugf("发件箱中继作为备用节点，等待成为主节点")
+			if !sleepCtx(ctx, time.Second*LOCK_OUTBOX_RETRY_INTERVAL_SECONDS) {
+				return
+			}
+			s.isLeader = s.tryBeLeader(ctx)
+			metrics.SetLeader(LOCK_OUTBOX_KEY, s.isLeader)
+			if s.isLeader {
+				log.Infof("发件箱中继从备用节点升级为主节点")
+			}
+		}
+	}
+}
+
+// tryBeLeader 尝试成为主节点
+func (s *OutboxRelay) tryBeLeader(ctx context.Context) bool {
+	err := s.lock.Lock(ctx)
+	if err != nil {
+		log.Infof("发件箱中继未能获取到主节点锁: %v", err)
+		return false
+	}
+
+	log.Infof("发件箱中继成功获取主节点锁，成为主节点")
+	return true
+}
+
+// relayOutboxMsg 投递超过等待时长仍未投递的发件箱消息
+// 等待时长内的消息留给发送请求即时投递，避免重复投递
+func (s *OutboxRelay) relayOutboxMsg() {
+	dt := data.GetData()
+	before := time.Now().Add(-time.Duration(config.Conf.Common.OutboxRelayDelay) * time.Second)
+	outboxList, err := data.MsgOutboxNsp.GetPendingList(dt.GetDB(), before, OUTBOX_RELAY_BATCH_SIZE)
+	if err != nil {
+		log.Errorf("获取待投递发件箱消息失败: %s", err.Error())
+		return
+	}
+
+	for _, outbox := range outboxList {
+		err := tools.PublishOutboxMsg(dt.GetDB(), outbox)
+		if err == nil {
+			continue
+		}
+		// Kafka不可用时停止本轮中继，下一轮按原顺序重试；
+		// 单条消息的问题（超过大小限制、优先级没有对应主题等）只退避这一条，继续投递之后的消息
+		if mq.IsUnavailable(err) {
+			log.Errorf("中继发件箱消息 %s 失败，Kafka不可用，停止本轮中继: %s", outbox.MsgId, err.Error())
+			return
+		}
+		log.Errorf("中继发件箱消息 %s 失败，已退避，第 %d 次: %s", outbox.MsgId, outbox.RetryCount+1, err.Error())
+	}
+}
+
+// purgeSentMsg 删除超过保留时长的已投递消息，避免发件箱表无限增长
+func (s *OutboxRelay) purgeSentMsg(ctx context.Context) {
+	db := data.GetData().GetDB()
+	before := time.Now().Add(-time.Duration(config.Conf.Common.OutboxRetention) * time.Second)
+	var total int64
+	for ctx.Err() == nil {
+		n, err := data.MsgOutboxNsp.PurgeSent(db, before, OUTBOX_PURGE_BATCH_SIZE)
+		if err != nil {
+			log.Errorf("清理已投递的发件箱消息失败: %s", err.Error())
+			break
+		}
+		total += n
+		if n < OUTBOX_PURGE_BATCH_SIZE {
+			break
+		}
+	}
+	if total > 0 {
+		log.Infof("已清理 %d 条已投递的发件箱消息", total)
+	}
+}
@@ -0,0 +1,89 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// PRIORITY_WEIGHTS_REFRESH_INTERVAL 调度器重新读取调度权重的间隔，管理接口调整后最多经过该时长在各节点生效
+const PRIORITY_WEIGHTS_REFRESH_INTERVAL = 5 * time.Second
+
+// priorityScheduler MySQL队列的优先级调度器，决定每个空闲的发送协程分给哪个优先级
+// 使用平滑加权轮询：每次分配时各优先级的当前值加上自己的权重，取当前值最大的优先级并减去总权重，
+// 分配结果在任意长度的区间内都接近权重比例，空闲协程每次只有一两个时低优先级也能按比例分到
+type priorityScheduler struct {
+	weights  *data.PriorityWeights
+	loadedAt time.Time
+	current  map[data.PriorityEnum]float64
+}
+
+// newPriorityScheduler 创建调度器，初始使用配置文件中的调度权重
+func newPriorityScheduler() *priorityScheduler {
+	return &priorityScheduler{
+		weights: data.DefaultPriorityWeights(),
+		current: make(map[data.PriorityEnum]float64),
+	}
+}
+
+// refresh 到期后重新读取调度权重，读取失败时继续使用之前的权重
+func (s *priorityScheduler) refresh(ctx context.Context) {
+	if time.Since(s.loadedAt) < PRIORITY_WEIGHTS_REFRESH_INTERVAL {
+		return
+	}
+	s.loadedAt = time.Now()
+	weights, err := data.GetData().GetPriorityWeights(ctx)
+	if err != nil {
+		log.Errorf("读取优先级调度权重失败，继续使用之前的权重: %s", err.Error())
+		return
+	}
+	s.weights = weights
+}
+
+// effectiveWeights 各优先级实际参与调度的权重
+// 权重低于总权重的MinShare时按MinShare计，保证有积压的优先级至少分得该比例，不会被高优先级饿死
+func effectiveWeights(weights *data.PriorityWeights) map[data.PriorityEnum]float64 {
+	var total float64
+	for _, priority := range consumePriority {
+		if w := weights.Weight(priority); w > 0 {
+			total += float64(w)
+		}
+	}
+	floor := total * weights.MinShare
+	result := make(map[data.PriorityEnum]float64, len(consumePriority))
+	for _, priority := range consumePriority {
+		w := float64(weights.Weight(priority))
+		if w < floor {
+			w = floor
+		}
+		result[priority] = w
+	}
+	return result
+}
+
+// plan 将capacity个空闲协程分给candidates中的优先级，返回各优先级分得的数量
+func (s *priorityScheduler) plan(capacity int, candidates []data.PriorityEnum) map[data.PriorityEnum]int {
+	weights := effectiveWeights(s.weights)
+	result := make(map[data.PriorityEnum]int, len(candidates))
+	if len(candidates) == 0 {
+		return result
+	}
+	var total float64
+	for _, priority := range candidates {
+		total += weights[priority]
+	}
+	for i := 0; i < capacity; i++ {
+		best := candidates[0]
+		for _, priority := range candidates {
+			s.current[priority] += weights[priority]
+			if s.current[priority] > s.current[best] {
+				best = priority
+			}
+		}
+		s.current[best] -= total
+		result[best]++
+	}
+	return result
+}
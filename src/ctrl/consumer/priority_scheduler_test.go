@@ -0,0 +1,55 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+func newTestScheduler(weights map[string]int, minShare float64) *priorityScheduler {
+	return &priorityScheduler{
+		weights: &data.PriorityWeights{Weights: weights, MinShare: minShare},
+		current: make(map[data.PriorityEnum]float64),
+	}
+}
+
+func TestPrioritySchedulerPlan(t *testing.T) {
+	s := newTestScheduler(map[string]int{"high": 60, "middle": 30, "low": 10, "retry": 0}, 0)
+	plan := s.plan(100, consumePriority)
+	want := map[data.PriorityEnum]int{data.PRIORITY_HIGH: 60, data.PRIORITY_MIDDLE: 30, data.PRIORITY_LOW: 10}
+	for priority, n := range want {
+		if plan[priority] != n {
+			t.Errorf("plan[%s] = %d, want %d", priority, plan[priority], n)
+		}
+	}
+	if plan[data.PRIORITY_RETRY] != 0 {
+		t.Errorf("plan[retry] = %d, want 0", plan[data.PRIORITY_RETRY])
+	}
+}
+
+// 每次只有一个空闲协程时，多轮累计仍按权重分配，低优先级不会饿死
+func TestPrioritySchedulerPlanOneAtATime(t *testing.T) {
+	s := newTestScheduler(map[string]int{"high": 60, "middle": 30, "low": 10, "retry": 0}, 0.05)
+	got := make(map[data.PriorityEnum]int)
+	for i := 0; i < 1000; i++ {
+		for priority, n := range s.plan(1, consumePriority) {
+			got[priority] += n
+		}
+	}
+	// retry权重为0，按总权重的5%保底
+	for priority, min := range map[data.PriorityEnum]int{
+		data.PRIORITY_HIGH: 550, data.PRIORITY_MIDDLE: 270, data.PRIORITY_LOW: 90, data.PRIORITY_RETRY: 45} {
+		if got[priority] < min {
+			t.Errorf("got[%s] = %d, want at least %d", priority, got[priority], min)
+		}
+	}
+}
+
+// 只有部分优先级有积压时，空闲协程全部分给这些优先级
+func TestPrioritySchedulerPlanCandidates(t *testing.T) {
+	s := newTestScheduler(map[string]int{"high": 60, "middle": 30, "low": 10, "retry": 10}, 0.05)
+	plan := s.plan(20, []data.PriorityEnum{data.PRIORITY_LOW})
+	if plan[data.PRIORITY_LOW] != 20 || len(plan) != 1 {
+		t.Errorf("plan = %v, want all 20 to low", plan)
+	}
+}
@@ -0,0 +1,257 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+)
+
+// ProcessingReaper 处理中消息回收器
+// 消费者先将一批消息置为处理中再逐条发送，节点崩溃后这些消息会一直处于处理中，
+// 回收器将处理中超过MaxProcessTime的消息放回待处理，并增加消息的重试次数
+type ProcessingReaper struct {
+	// 分布式锁，保证只有一个节点在回收
+	lock *lock.RedisLock
+	// 是否是主节点的标志
+	isLeader bool
+	// 退出时取消
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	// 锁的key
+	LOCK_REAPER_KEY = "PROCESSING_REAPER_LEADER"
+
+	// 锁的过期时间（秒）
+	LOCK_REAPER_EXPIRE_SECONDS = 5
+
+	// 非主节点尝试获取锁的间隔（秒）
+	LOCK_REAPER_RETRY_INTERVAL_SECONDS = 5
+
+	// 每张表每轮回收的最大消息数
+	REAPER_BATCH_SIZE = 100
+)
+
+// errProcessingTimeout 消息处理中超时，处理节点可能已经崩溃
+var errProcessingTimeout = errors.New("message stuck in processing, the consumer may have crashed")
+
+// Start 启动回收器
+func (s *ProcessingReaper) Start() {
+	// 初始化锁和领导状态
+	s.lock = lock.NewRedisLock(LOCK_REAPER_KEY,
+		lock.WithExpireSeconds(LOCK_REAPER_EXPIRE_SECONDS),
+		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	s.isLeader = false
+	metrics.SetLeader(LOCK_REAPER_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.reapLoop(ctx)
+}
+
+// Stop 停止回收器并释放主节点锁，等待进行中的一轮完成
+func (s *ProcessingReaper) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("处理中消息回收器解锁失败: %v", err)
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_REAPER_KEY, false)
+	}
+}
+
+func (s *ProcessingReaper) reapLoop(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("processing_reaper")
+	defer health.WorkerStopped("processing_reaper")
+	ticker := time.NewTicker(time.Duration(config.Conf.Task.LongProcessInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isLeader {
+			s.reap(ctx)
+		} else {
+			// 作为备用节点，定期尝试获取锁
+			log.Debugf("处理中消息回收器作为备用节点，等待成为主节点")
+			if !sleepCtx(ctx, time.Second*LOCK_REAPER_RETRY_INTERVAL_SECONDS) {
+				return
+			}
+			s.isLeader = s.tryBeLeader(ctx)
+			metrics.SetLeader(LOCK_REAPER_KEY, s.isLeader)
+			if s.isLeader {
+				log.Infof("处理中消息回收器从备用节点升级为主节点")
+			}
+		}
+	}
+}
+
+// tryBeLeader 尝试成为主节点
+func (s *ProcessingReaper) tryBeLeader(ctx context.Context) bool {
+	err := s.lock.Lock(ctx)
+	if err != nil {
+		log.Infof("处理中消息回收器未能获取到主节点锁: %v", err)
+		return false
+	}
+
+	log.Infof("处理中消息回收器成功获取主节点锁，成为主节点")
+	return true
+}
+
+// reap 回收各队列表和定时队列表中处理中超时的消息，Kafka模式下只有定时队列表
+func (s *ProcessingReaper) reap(ctx context.Context) {
+	before := time.Now().Add(-time.Duration(config.Conf.Task.MaxProcessTime) * time.Second)
+	if config.Conf.Common.MySQLAsMq {
+		for _, priority := range consumePriority {
+			s.reapQueue(ctx, data.GetPriorityStr(priority), before)
+		}
+	}
+	s.reapTimer(ctx, before)
+}
+
+// nextReapCount 消息被回收后的重试次数，消息记录不存在时按第一次计
+func nextReapCount(msgID string) int {
+	record, err := data.MsgRecordNsp.Find(data.GetData().GetDB(), msgID)
+	if err != nil {
+		return 1
+	}
+	return record.RetryCount + 1
+}
+
+// reapQueue 回收一张队列表中处理中超时的消息
+// 重试次数达到上限的消息不再放回，直接标记为最终失败并转入死信，避免导致崩溃的消息反复被消费
+func (s *ProcessingReaper) reapQueue(ctx context.Context, priorityStr string, before time.Time) {
+	db := data.GetData().GetDB()
+	msgList, err := data.MsgQueueNsp.GetStuckList(db, priorityStr, before, REAPER_BATCH_SIZE)
+	if err != nil {
+		log.Errorf("获取%s优先级队列中处理中超时的消息失败: %s", priorityStr, err.Error())
+		return
+	}
+	for _, dbMsg := range msgList {
+		newCount := nextReapCount(dbMsg.MsgId)
+		if newCount >= config.Conf.Common.MaxRetryCount {
+			ok, err := data.MsgQueueNsp.CompareAndSetStatus(db, priorityStr, dbMsg.MsgId,
+				int(data.TASK_STATUS_PROCESSING), int(data.TASK_STATUS_FAILED))
+			if err != nil || !ok {
+				continue
+			}
+			// 模板数据无法解析时也转入死信，死信中的请求不含模板数据
+			req, err := queueMsgToReq(dbMsg)
+			if err != nil {
+				log.Errorf("%s优先级消息 %s 模板数据无法解析: %s", priorityStr, dbMsg.MsgId, err.Error())
+			}
+			if err := s.failStuckMsg(ctx, req, newCount); err != nil {
+				// 死信写入失败时恢复为处理中，下一轮回收时再次转入死信
+				data.MsgQueueNsp.CompareAndSetStatus(db, priorityStr, dbMsg.MsgId,
+					int(data.TASK_STATUS_FAILED), int(data.TASK_STATUS_PROCESSING))
+			}
+			continue
+		}
+
+		ok, err := data.MsgQueueNsp.CompareAndSetStatus(db, priorityStr, dbMsg.MsgId,
+			int(data.TASK_STATUS_PROCESSING), int(data.TASK_STATUS_PENDING))
+		if err != nil {
+			log.Errorf("%s优先级消息 %s 放回待处理失败: %s", priorityStr, dbMsg.MsgId, err.Error())
+			continue
+		}
+		// 回收期间消息已处理完
+		if !ok {
+			continue
+		}
+		if _, err := data.MsgRecordNsp.IncrementRetryCount(db, dbMsg.MsgId); err != nil {
+			log.Errorf("更新消息 %s 重试次数失败: %s", dbMsg.MsgId, err.Error())
+		}
+		metrics.MsgReaped.WithLabelValues(priorityStr).Inc()
+		log.Infof("%s优先级消息 %s 处理中超时，已放回待处理，重试次数: %d/%d",
+			priorityStr, dbMsg.MsgId, newCount, config.Conf.Common.MaxRetryCount)
+	}
+}
+
+// reapTimer 回收定时队列表中处理中超时的消息
+func (s *ProcessingReaper) reapTimer(ctx context.Context, before time.Time) {
+	db := data.GetData().GetDB()
+	msgList, err := data.MsgTmpQueueTimerNsp.GetStuckList(db, before, REAPER_BATCH_SIZE)
+	if err != nil {
+		log.Errorf("获取定时队列中处理中超时的消息失败: %s", err.Error())
+		return
+	}
+	requeued := false
+	for _, dbMsg := range msgList {
+		newCount := nextReapCount(dbMsg.MsgId)
+		if newCount >= config.Conf.Common.MaxRetryCount {
+			ok, err := data.MsgTmpQueueTimerNsp.CompareAndSetStatus(db, dbMsg.MsgId,
+				int(data.TIMER_MSG_STATUS_PROCESSING), int(data.TIMER_MSG_STATUS_FAILED))
+			if err != nil || !ok {
+				continue
+			}
+			var req = new(ctrlmodel.SendMsgReq)
+			if err := json.Unmarshal([]byte(dbMsg.Req), req); err != nil {
+				log.Errorf("定时消息 %s 反序列化失败，无法转入死信: %s", dbMsg.MsgId, err.Error())
+				continue
+			}
+			req.MsgID = dbMsg.MsgId
+			if err := s.failStuckMsg(ctx, req, newCount); err != nil {
+				// 死信写入失败时恢复为处理中，下一轮回收时再次转入死信
+				data.MsgTmpQueueTimerNsp.CompareAndSetStatus(db, dbMsg.MsgId,
+					int(data.TIMER_MSG_STATUS_FAILED), int(data.TIMER_MSG_STATUS_PROCESSING))
+			}
+			continue
+		}
+
+		ok, err := data.MsgTmpQueueTimerNsp.CompareAndSetStatus(db, dbMsg.MsgId,
+			int(data.TIMER_MSG_STATUS_PROCESSING), int(data.TIMER_MSG_STATUS_PENDING))
+		if err != nil {
+			log.Errorf("定时消息 %s 放回待处理失败: %s", dbMsg.MsgId, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if _, err := data.MsgRecordNsp.IncrementRetryCount(db, dbMsg.MsgId); err != nil {
+			log.Errorf("更新消息 %s 重试次数失败: %s", dbMsg.MsgId, err.Error())
+		}
+		requeued = true
+		metrics.MsgReaped.WithLabelValues("timer").Inc()
+		log.Infof("定时消息 %s 处理中超时，已放回待处理，重试次数: %d/%d",
+			dbMsg.MsgId, newCount, config.Conf.Common.MaxRetryCount)
+	}
+	if requeued {
+		rearmTimerMsgs(ctx)
+	}
+}
+
+// failStuckMsg 将多次处理中超时的消息转入死信并标记为最终失败，转入死信失败时返回错误，消息记录不变
+func (s *ProcessingReaper) failStuckMsg(ctx context.Context, req *ctrlmodel.SendMsgReq, retryCount int) error {
+	db := data.GetData().GetDB()
+	log.Errorf("消息 %s 多次处理中超时，不再放回: 重试次数 %d", req.MsgID, retryCount)
+	if err := deadLetter(db, req, retryCount, errProcessingTimeout); err != nil {
+		return err
+	}
+	if errors.Is(data.MsgRecordNsp.UpdateStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED)), data.ErrMsgCancelled) {
+		log.Infof("消息 %s 已取消，不再标记为最终失败", req.MsgID)
+		return nil
+	}
+	publishStatus(ctx, req, data.MSG_EVENT_FAILED, retryCount, errProcessingTimeout)
+	tools.NotifyFinalStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED), req.Channel,
+		len(req.AttemptHistory), errProcessingTimeout.Error())
+	return nil
+}
@@ -0,0 +1,201 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msgpush"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/lock"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/mq"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
+	"github.com/redis/go-redis/v9"
+)
+
+// RetryScheduler 重试调度器，将Redis中到期的重试消息投递到重试主题
+// 投递失败的消息先按退避时间停放在Redis ZSET中，避免下游故障时重试次数在几秒内耗尽
+type RetryScheduler struct {
+	// 分布式锁，保证只有一个节点在调度
+	lock *lock.RedisLock
+	// 是否是主节点的标志
+	isLeader bool
+	// 退出时取消
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+const (
+	// 锁的key
+	LOCK_RETRY_SCHEDULER_KEY = "RETRY_SCHEDULER_LEADER"
+
+	// 锁的过期时间（秒）
+	LOCK_RETRY_SCHEDULER_EXPIRE_SECONDS = 5
+
+	// 非主节点尝试获取锁的间隔（秒）
+	LOCK_RETRY_SCHEDULER_RETRY_INTERVAL_SECONDS = 5
+
+	// 重试消息重新停放的等待时间（毫秒），投递到重试主题失败时使用
+	RETRY_REPARK_DELAY_MS = 1000
+
+	// 每轮投递的最大重试消息数
+	RETRY_PUBLISH_BATCH_SIZE = 100
+)
+
+// nextAttemptAt 计算第retryCount次重试的时间（Unix毫秒），渠道供应商限流时直接按退避上限等待
+func nextAttemptAt(retryCount int, category string) int64 {
+	base := time.Duration(config.Conf.Common.RetryBackoffBase) * time.Millisecond
+	max := time.Duration(config.Conf.Common.RetryBackoffMax) * time.Millisecond
+	if category == msgpush.ERR_CATEGORY_RATE_LIMITED {
+		base = max
+	}
+	delay := tools.RetryBackoff(retryCount, base, max, config.Conf.Common.RetryBackoffJitter)
+	return time.Now().Add(delay).UnixMilli()
+}
+
+// parkForRetry 将消息停放到Redis中，到达下次尝试时间后由重试调度器投递到重试主题
+// ctx中的链路上下文随消息停放，重试消费时继续同一条链路
+func parkForRetry(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
+	req.TraceContext = tracing.Marshal(ctx)
+	msgJson, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return data.GetData().GetCache().ZAdd(ctx, data.REDIS_KEY_RETRY_MSGS,
+		redis.Z{Score: float64(req.NextAttemptAt), Member: string(msgJson)})
+}
+
+// Start 启动重试调度器，MySQL作为消息队列时由重试表的next_attempt_at控制重试时间
+func (s *RetryScheduler) Start() {
+	if config.Conf.Common.MySQLAsMq {
+		return
+	}
+	// 初始化锁和领导状态
+	s.lock = lock.NewRedisLock(LOCK_RETRY_SCHEDULER_KEY,
+		lock.WithExpireSeconds(LOCK_RETRY_SCHEDULER_EXPIRE_SECONDS),
+		lock.WithWatchDogMode()) // 使用看门狗模式自动续期
+	s.isLeader = false
+	metrics.SetLeader(LOCK_RETRY_SCHEDULER_KEY, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.scheduleLoop(ctx)
+}
+
+// Stop 停止重试调度器并释放主节点锁，等待进行中的一轮完成
+func (s *RetryScheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	if s.isLeader {
+		if err := s.lock.Unlock(); err != nil {
+			log.Errorf("重试调度器解锁失败: %v", err)
+		}
+		s.isLeader = false
+		metrics.SetLeader(LOCK_RETRY_SCHEDULER_KEY, false)
+	}
+}
+
+func (s *RetryScheduler) scheduleLoop(ctx context.Context) {
+	defer close(s.done)
+	health.WorkerStarted("retry_scheduler")
+	defer health.WorkerStopped("retry_scheduler")
+	ticker := time.NewTicker(time.Duration(200) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isLeader {
+			s.publishDueRetries(ctx)
+		} else {
+			// 作为备用节点，定期尝试获取锁
+			log.Debugf("重试调度器作为备用节点，等待成为主节点")
+			if !sleepCtx(ctx, time.Second*LOCK_RETRY_SCHEDULER_RETRY_INTERVAL_SECONDS) {
+				return
+			}
+			s.isLeader = s.tryBeLeader(ctx)
+			metrics.SetLeader(LOCK_RETRY_SCHEDULER_KEY, s.isLeader)
+			if s.isLeader {
+				log.Infof("重试调度器从备用节点升级为主节点")
+			}
+		}
+	}
+}
+
+// tryBeLeader 尝试成为主节点
+func (s *RetryScheduler) tryBeLeader(ctx context.Context) bool {
+	err := s.lock.Lock(ctx)
+	if err != nil {
+		log.Infof("重试调度器未能获取到主节点锁: %v", err)
+		return false
+	}
+
+	log.Infof("重试调度器成功获取主节点锁，成为主节点")
+	return true
+}
+
+// publishDueRetries 投递到期的重试消息到重试主题，投递成功后才从Redis中删除，
+// 节点在投递后、删除前崩溃时消息会被再次投递，宁可重复也不丢失
+// 投递失败的消息推迟后重新等待投递，Kafka不可用时停止本轮投递
+func (s *RetryScheduler) publishDueRetries(ctx context.Context) {
+	dt := data.GetData()
+	now := time.Now().UnixMilli()
+	msgList, err := dt.GetCache().ZRangeByScore(ctx, data.REDIS_KEY_RETRY_MSGS, &redis.ZRangeBy{
+		Min: "0", Max: strconv.FormatInt(now, 10), Count: RETRY_PUBLISH_BATCH_SIZE,
+	})
+	if err != nil {
+		log.Errorf("获取到期重试消息失败: %s", err.Error())
+		return
+	}
+
+	for _, msg := range msgList {
+		if ctx.Err() != nil {
+			return
+		}
+		var req = new(ctrlmodel.SendMsgReq)
+		if err := json.Unmarshal([]byte(msg), req); err != nil {
+			log.Errorf("解析重试消息失败，丢弃: %s, 消息: %s", err.Error(), msg)
+			dt.GetCache().ZRem(ctx, data.REDIS_KEY_RETRY_MSGS, msg)
+			continue
+		}
+		err := publishRetryMsg(ctx, req)
+		if err == nil {
+			if err := dt.GetCache().ZRem(ctx, data.REDIS_KEY_RETRY_MSGS, msg); err != nil {
+				log.Errorf("删除已投递的重试消息失败: %s, 消息: %s", err.Error(), msg)
+			}
+			continue
+		}
+		log.Errorf("投递重试消息失败，稍后重试: %s", err.Error())
+		// 同一成员重新ZADD只更新分数，推迟到下次尝试时间
+		repark := redis.Z{Score: float64(now + RETRY_REPARK_DELAY_MS), Member: msg}
+		if err := dt.GetCache().ZAdd(ctx, data.REDIS_KEY_RETRY_MSGS, repark); err != nil {
+			log.Errorf("推迟重试消息失败: %s, 消息: %s", err.Error(), msg)
+		}
+		if mq.IsUnavailable(err) {
+			return
+		}
+	}
+}
+
+// publishRetryMsg 恢复停放时保存的链路上下文，将重试消息投递到重试主题
+func publishRetryMsg(ctx context.Context, req *ctrlmodel.SendMsgReq) error {
+	ctx = tracing.Unmarshal(ctx, req.TraceContext)
+	req.TraceContext = ""
+	msgJson, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return data.GetData().GetRetryMQProducer().SendMessage(ctx, "", msgJson)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/utils"
 	"github.com/redis/go-redis/v9"
 )
@@ -38,13 +39,20 @@ func (s *ScheduledMessageConsumer) Start() {
 	}
 
 	go func() {
+		health.WorkerStarted("scheduled_message_consumer")
+		defer health.WorkerStopped("scheduled_message_consumer")
 		ticker := time.NewTicker(10 * time.Second) // 每10秒检查一次
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
+				// 退出过程中不再处理新的定时消息
+				if !sends.begin() {
+					continue
+				}
 				s.processScheduledMessages()
+				sends.end()
 			case <-s.stopChan:
 				s.logger.LogSchedulerStop()
 				if s.fileLogger != nil {
@@ -255,5 +263,5 @@ func (s *ScheduledMessageConsumer) sendMessageToQueue(req *ctrlmodel.SendMsgReq)
 
 	// 发送到中等优先级队列
 	producer := dt.GetProducer(data.PRIORITY_MIDDLE)
-	return producer.SendMessage("", msgJSON)
+	return producer.SendMessage(context.Background(), "", msgJSON)
 }
@@ -0,0 +1,173 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+// errConsumerStopping 进程退出过程中拒绝处理新消息
+var errConsumerStopping = errors.New("consumer is stopping")
+
+// sleepCtx 等待d，ctx取消时提前返回false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sendTracker 统计正在处理中的消息，退出时停止接收新消息并等待处理中的消息完成
+type sendTracker struct {
+	mu       sync.Mutex
+	n        int
+	draining bool
+	idle     chan struct{}
+}
+
+var sends = &sendTracker{}
+
+// begin 开始处理一条消息，进程正在退出时返回false，调用方不应再处理
+func (t *sendTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.n++
+	return true
+}
+
+// end 一条消息处理完成
+func (t *sendTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	if t.n == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// drain 停止接收新消息并等待处理中的消息完成，超时返回ctx的错误
+func (t *sendTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	if t.n == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitInflight 停止处理新消息，等待处理中的消息在ctx截止前完成
+func WaitInflight(ctx context.Context) error {
+	return sends.drain(ctx)
+}
+
+// claimedMsgs 本节点已在MySQL中置为处理中、尚未处理完的消息
+// 退出时仍未处理完的消息放回待处理，由其他节点或重启后继续消费
+type claimedMsgs struct {
+	mu    sync.Mutex
+	queue map[string]map[string]struct{} // 优先级 -> 消息ID，对应t_msg_queue_*
+	timer map[string]struct{}            // 对应t_msg_tmp_queue_timer
+}
+
+var claimed = &claimedMsgs{
+	queue: make(map[string]map[string]struct{}),
+	timer: make(map[string]struct{}),
+}
+
+// claimQueueMsgs 记录置为处理中的队列消息
+func claimQueueMsgs(priorityStr string, msgIDs []string) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	ids := claimed.queue[priorityStr]
+	if ids == nil {
+		ids = make(map[string]struct{}, len(msgIDs))
+		claimed.queue[priorityStr] = ids
+	}
+	for _, id := range msgIDs {
+		ids[id] = struct{}{}
+	}
+}
+
+// releaseQueueMsg 队列消息已处理完
+func releaseQueueMsg(priorityStr string, msgID string) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	delete(claimed.queue[priorityStr], msgID)
+}
+
+// claimTimerMsgs 记录置为处理中的定时消息
+func claimTimerMsgs(msgIDs []string) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	for _, id := range msgIDs {
+		claimed.timer[id] = struct{}{}
+	}
+}
+
+// releaseTimerMsg 定时消息已处理完
+func releaseTimerMsg(msgID string) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	delete(claimed.timer, msgID)
+}
+
+// RequeueClaimed 将本节点仍处于处理中的消息放回待处理，在等待处理中的消息之后调用
+func RequeueClaimed(db *gorm.DB) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+	for priorityStr, ids := range claimed.queue {
+		for msgID := range ids {
+			ok, err := data.MsgQueueNsp.CompareAndSetStatus(db, priorityStr, msgID,
+				int(data.TASK_STATUS_PROCESSING), int(data.TASK_STATUS_PENDING))
+			if err != nil {
+				log.Errorf("%s优先级消息 %s 放回待处理失败: %s", priorityStr, msgID, err.Error())
+				continue
+			}
+			if ok {
+				log.Infof("%s优先级消息 %s 未处理完，已放回待处理", priorityStr, msgID)
+			}
+			delete(ids, msgID)
+		}
+	}
+	requeued := false
+	for msgID := range claimed.timer {
+		ok, err := data.MsgTmpQueueTimerNsp.CompareAndSetStatus(db, msgID,
+			int(data.TIMER_MSG_STATUS_PROCESSING), int(data.TIMER_MSG_STATUS_PENDING))
+		if err != nil {
+			log.Errorf("定时消息 %s 放回待处理失败: %s", msgID, err.Error())
+			continue
+		}
+		if ok {
+			log.Infof("定时消息 %s 未处理完，已放回待处理", msgID)
+			requeued = true
+		}
+		delete(claimed.timer, msgID)
+	}
+	if requeued {
+		rearmTimerMsgs(context.Background())
+	}
+}
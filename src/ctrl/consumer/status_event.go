@@ -0,0 +1,26 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+// publishStatus 发布消息状态变化事件，供状态流接口推送给订阅方
+func publishStatus(ctx context.Context, req *ctrlmodel.SendMsgReq, status string, retryCount int, sendErr error) {
+	event := &data.MsgStatusEvent{
+		MsgID:      req.MsgID,
+		BatchID:    req.BatchID,
+		Status:     status,
+		Channel:    req.Channel,
+		RetryCount: retryCount,
+	}
+	if status == data.MSG_EVENT_RETRYING {
+		event.NextAttemptAt = req.NextAttemptAt
+	}
+	if sendErr != nil {
+		event.Error = sendErr.Error()
+	}
+	data.GetData().PublishMsgStatus(ctx, event)
+}
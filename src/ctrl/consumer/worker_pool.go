@@ -0,0 +1,45 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// workerPool 固定大小的协程池，限制同时处理的消息数
+type workerPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+// newWorkerPool 创建最多同时运行size个任务的协程池
+func newWorkerPool(size int) *workerPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// free 当前空闲的协程数
+func (p *workerPool) free() int {
+	return cap(p.slots) - len(p.slots)
+}
+
+// submit 提交任务，没有空闲协程时阻塞等待
+// 任务崩溃时记录日志，不影响进程和其他任务，协程照常归还
+func (p *workerPool) submit(task func()) {
+	p.slots <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("协程池任务发生崩溃: %v", r)
+			}
+		}()
+		task()
+	}()
+}
@@ -0,0 +1,75 @@
+package ctrlmodel
+
+import (
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+// DeadLetterMsg 投递到死信主题的消息
+type DeadLetterMsg struct {
+	Req        *SendMsgReq `json:"req"`        // 原始消息请求，包含失败历史
+	LastError  string      `json:"lastError"`  // 最后一次投递失败原因
+	RetryCount int         `json:"retryCount"` // 进入死信时的重试次数
+}
+
+// ListDeadLettersReq 死信列表请求
+type ListDeadLettersReq struct {
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	MsgID    string `form:"msg_id"`
+	Channel  int    `form:"channel"` // 可选：按渠道过滤
+	Status   int    `form:"status"`  // 可选：按状态过滤，1: 待处理, 2: 已重放
+}
+
+// ListDeadLettersResp 死信列表响应
+type ListDeadLettersResp struct {
+	RespComm
+	DeadLetters []*data.MsgDeadLetter `json:"deadLetters"`
+	Total       int64                 `json:"total"`
+	Page        int                   `json:"page"`
+}
+
+// GetDeadLetterReq 查询死信详情请求，id和msgID至少指定一个
+type GetDeadLetterReq struct {
+	ID    int64  `form:"id"`
+	MsgID string `form:"msg_id"`
+}
+
+// GetDeadLetterResp 查询死信详情响应
+type GetDeadLetterResp struct {
+	RespComm
+	DeadLetter *data.MsgDeadLetter `json:"deadLetter"`
+	Request    *SendMsgReq         `json:"request"` // 解析后的原始消息请求
+}
+
+// ReplayDeadLettersReq 批量重放死信请求
+type ReplayDeadLettersReq struct {
+	IDs          []int64           `json:"ids" binding:"required"`
+	TemplateData map[string]string `json:"templateData"` // 可选：覆盖原始请求中的模板数据，未指定的字段保持原值
+}
+
+// DeadLetterSkip 未能重放的死信
+type DeadLetterSkip struct {
+	ID     int64  `json:"id"`
+	MsgID  string `json:"msgID,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ReplayDeadLettersResp 批量重放死信响应
+type ReplayDeadLettersResp struct {
+	RespComm
+	Replayed []string         `json:"replayed"` // 已重新入队的消息ID
+	Skipped  []DeadLetterSkip `json:"skipped"`
+}
+
+// PurgeDeadLettersReq 清理死信请求，ids和before至少指定一个
+type PurgeDeadLettersReq struct {
+	IDs    []int64 `json:"ids"`
+	Before string  `json:"before"` // 删除该时间之前进入死信的消息，格式: "2025-09-11 17:30:00"
+	Status int     `json:"status"` // 可选：只删除该状态的死信
+}
+
+// PurgeDeadLettersResp 清理死信响应
+type PurgeDeadLettersResp struct {
+	RespComm
+	Deleted int64 `json:"deleted"`
+}
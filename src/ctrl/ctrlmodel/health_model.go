@@ -0,0 +1,30 @@
+package ctrlmodel
+
+const (
+	HEALTH_CHECK_OK      = "ok"
+	HEALTH_CHECK_FAILED  = "failed"
+	HEALTH_CHECK_SKIPPED = "skipped" // 不依赖该组件，例如MySQL作为消息队列时不检查Kafka
+)
+
+// HealthzResp 存活检查响应
+type HealthzResp struct {
+	RespComm
+	Status string `json:"status"`
+}
+
+// DependencyCheck 单个依赖的检查结果
+type DependencyCheck struct {
+	Status    string `json:"status"` // ok, failed, skipped
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ReadyzResp 就绪检查响应
+type ReadyzResp struct {
+	RespComm
+	Ready        bool                        `json:"ready"`
+	ShuttingDown bool                        `json:"shuttingDown"` // 正在优雅退出
+	Checks       map[string]*DependencyCheck `json:"checks"`       // mysql, redis, kafka
+	Workers      map[string]int              `json:"workers"`      // 各后台工作者运行中的协程数，0表示未运行
+	LeaderLocks  []string                    `json:"leaderLocks"`  // 本节点持有的主节点锁
+}
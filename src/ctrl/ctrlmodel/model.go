@@ -1,5 +1,11 @@
 package ctrlmodel
 
+import (
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
 // RespComm 通用的响应消息
 type RespComm struct {
 	Code int    `json:"code"`
@@ -8,24 +14,69 @@ type RespComm struct {
 
 // SendMsgReq 请求消息
 type SendMsgReq struct {
-	To            string            `json:"to" form:"to"`             // 直接指定接收者（手机号/邮箱等）
-	UserIDs       []string          `json:"user_ids" form:"user_ids"` // 目标用户ID列表
-	Tags          []string          `json:"tags" form:"tags"`         // 目标标签列表
-	Subject       string            `json:"subject" form:"subject"`
-	Priority      int               `json:"priority" form:"priority"`
-	TemplateID    string            `json:"templateID" form:"templateID"`
-	TemplateData  map[string]string `json:"templateData" form:"templateData"`
-	SendTimestamp int64             `json:"sendTimestamp" form:"sendTimestamp"`
-	MsgID         string
+	To             string            `json:"to" form:"to"`             // 直接指定接收者（手机号/邮箱等）
+	UserIDs        []string          `json:"user_ids" form:"user_ids"` // 目标用户ID列表
+	Tags           []string          `json:"tags" form:"tags"`         // 目标标签列表
+	Subject        string            `json:"subject" form:"subject"`
+	Priority       int               `json:"priority" form:"priority"`
+	TemplateID     string            `json:"templateID" form:"templateID"`
+	TemplateData   map[string]string `json:"templateData" form:"templateData"`
+	SendTimestamp  int64             `json:"sendTimestamp" form:"sendTimestamp"`
+	ExpireAt       int64             `json:"expire_at" form:"expire_at"`           // 过期时间（Unix秒），过期后不再投递，0表示不过期
+	TTLSeconds     int               `json:"ttl_seconds" form:"ttl_seconds"`       // 有效期（秒），从发送时间起算，未指定expire_at时生效
+	IdempotencyKey string            `json:"idempotencyKey" form:"idempotencyKey"` // 幂等键，也可通过Idempotency-Key请求头传入，按Source-Id隔离
+	NotifyURL      string            `json:"notify_url" form:"notify_url"`         // 消息到达最终状态（成功或最终失败）后回调的地址
+	MsgID          string
+	BatchID        string `json:"batchID" form:"-"`  // 批次ID，由服务端生成，关联同一次请求扇出的所有消息
+	SourceID       string `json:"sourceID" form:"-"` // 调用方来源ID，由服务端从Source-Id请求头设置
 	// 直接编写消息模式字段
 	Channels []int  `json:"channels" form:"channels"` // 消息渠道列表 (1:邮件, 2:短信, 3:飞书, 4:微信, 5:钉钉) - 支持多选
 	Content  string `json:"content" form:"content"`   // 消息内容（直接编写模式）
+	Channel  int    `json:"channel" form:"-"`         // 本条消息的投递渠道，由服务端按(接收者, 渠道)扇出时设置
+	// 渠道降级
+	Fallback      *data.FallbackPolicy `json:"fallback" form:"-"`      // 降级策略，未指定时使用模板上的策略
+	FallbackState *data.FallbackState  `json:"fallbackState" form:"-"` // 降级进度，由服务端按接收者解析后设置
+	// 失败投递历史，随消息一起进入重试和死信
+	AttemptHistory data.AttemptHistory `json:"attemptHistory,omitempty" form:"-"`
+	NextAttemptAt  int64               `json:"nextAttemptAt,omitempty" form:"-"` // 下次尝试时间（Unix毫秒），由重试退避设置
+	TraceContext   string              `json:"traceContext,omitempty" form:"-"`  // 停放等待重试期间保存的链路上下文，投递到重试主题时写入Kafka消息头
+}
+
+// 单个接收者的投递结果
+const (
+	SEND_RESULT_ACCEPTED = "accepted" // 已持久化，等待投递
+	SEND_RESULT_REJECTED = "rejected" // 被拒绝，未投递
+)
+
+// 接收者被拒绝的原因
+const (
+	REJECT_REASON_USER_NOT_FOUND = "user_not_found" // 用户不存在或已禁用
+	REJECT_REASON_NO_CONTACT     = "no_contact"     // 用户没有该渠道的联系方式
+	REJECT_REASON_QUOTA_EXCEEDED = "quota_exceeded" // 超出限频配额
+	REJECT_REASON_PERSIST_FAILED = "persist_failed" // 消息持久化失败
+	REJECT_REASON_INTERNAL       = "internal_error" // 其他内部错误
+)
+
+// SendMsgResult 单个接收者的投递结果
+type SendMsgResult struct {
+	UserID  string `json:"userID,omitempty"`
+	To      string `json:"to,omitempty"`
+	Channel int    `json:"channel,omitempty"`
+	MsgID   string `json:"msgID,omitempty"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
 }
 
 // SendMsgResp 响应消息
 type SendMsgResp struct {
 	RespComm
-	MsgID string `json:"msgID"`
+	MsgID    string          `json:"msgID"` // 第一条成功消息的ID，兼容旧接口
+	BatchID  string          `json:"batchID"`
+	MsgIDs   []string        `json:"msgIDs"`
+	Total    int             `json:"total"`
+	Accepted int             `json:"accepted"`
+	Rejected int             `json:"rejected"`
+	Results  []SendMsgResult `json:"results"`
 }
 
 // GetMsgResult 请求消息
@@ -36,10 +87,72 @@ type GetMsgRecordReq struct {
 // GetMsgResult 响应消息
 type GetMsgRecordResp struct {
 	RespComm
-	To           string            `json:"to" form:"to"`
-	Subject      string            `json:"subject" form:"subject"`
-	TemplateID   string            `json:"templateID" form:"templateID"`
-	TemplateData map[string]string `json:"templateData" form:"templateData"`
+	MsgRecordView
+}
+
+// MsgRecordView 消息的完整状态视图
+type MsgRecordView struct {
+	MsgID            string            `json:"msgID"`
+	BatchID          string            `json:"batchID"`
+	SourceID         string            `json:"sourceID"`
+	To               string            `json:"to" form:"to"`
+	Subject          string            `json:"subject" form:"subject"`
+	TemplateID       string            `json:"templateID" form:"templateID"`
+	TemplateData     map[string]string `json:"templateData" form:"templateData"`
+	Channel          int               `json:"channel"`          // 请求的渠道
+	DeliveredChannel int               `json:"deliveredChannel"` // 最终投递成功的渠道，0表示尚未投递成功
+	Status           int               `json:"status"`
+	StatusText       string            `json:"statusText"` // 生命周期状态: pending, succeeded, failed, expired, cancelled
+	RetryCount       int               `json:"retryCount"`
+	NextAttemptAt    int64             `json:"nextAttemptAt"` // 下次重试时间（Unix毫秒），0表示没有待重试
+	ErrorCategory    string            `json:"errorCategory"`
+	ErrorCode        string            `json:"errorCode"`
+	LastError        string            `json:"lastError"`
+	CreateTime       *time.Time        `json:"createTime"`
+	ModifyTime       *time.Time        `json:"modifyTime"`
+	Channels         []*ChannelOutcome `json:"channels"` // 每个渠道的投递结果
+}
+
+// ChannelOutcome 单个渠道的投递结果，由投递尝试日志汇总得到
+type ChannelOutcome struct {
+	Channel       int        `json:"channel"`
+	Provider      string     `json:"provider"`
+	Attempts      int        `json:"attempts"` // 该渠道的发送次数
+	Status        int        `json:"status"`   // 最近一次发送的结果, 1: 成功, 2: 失败
+	ErrorCategory string     `json:"errorCategory"`
+	ErrorCode     string     `json:"errorCode"`
+	LastError     string     `json:"lastError"`
+	ProviderMsgID string     `json:"providerMsgID"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt"`
+}
+
+// GetMsgRecordsReq 批量查询消息记录请求
+type GetMsgRecordsReq struct {
+	MsgIDs []string `json:"msgIDs" form:"msgIDs" binding:"required"`
+}
+
+// GetMsgRecordsResp 批量查询消息记录响应
+type GetMsgRecordsResp struct {
+	RespComm
+	Records  []*MsgRecordView `json:"records"`
+	NotFound []string         `json:"notFound"` // 不存在的消息ID
+}
+
+// MsgStatusStreamReq 消息状态流请求，msgID和batchID至少指定一个
+type MsgStatusStreamReq struct {
+	MsgID   string `json:"msgID" form:"msgID"`
+	BatchID string `json:"batchID" form:"batchID"`
+}
+
+// GetMsgAttemptsReq 查询消息投递尝试请求
+type GetMsgAttemptsReq struct {
+	MsgID string `json:"msgID" form:"msgID"`
+}
+
+// GetMsgAttemptsResp 查询消息投递尝试响应
+type GetMsgAttemptsResp struct {
+	RespComm
+	Attempts []*data.MsgAttempt `json:"attempts"`
 }
 
 // ListMsgRecordsReq 消息记录列表请求
@@ -47,6 +160,7 @@ type ListMsgRecordsReq struct {
 	Page      int    `form:"page" binding:"min=1"`
 	PageSize  int    `form:"page_size" binding:"min=1,max=100"`
 	MsgID     string `form:"msg_id"`
+	BatchID   string `form:"batch_id"`
 	To        string `form:"to"`
 	Status    int    `form:"status"`
 	StartTime string `form:"start_time"`
@@ -61,13 +175,27 @@ type ListMsgRecordsResp struct {
 	Page    int         `json:"page"`
 }
 
+// CancelMsgReq 取消消息请求，msgID和batchID至少指定一个
+type CancelMsgReq struct {
+	MsgID   string `json:"msgID" form:"msgID"`
+	BatchID string `json:"batchID" form:"batchID"`
+}
+
+// CancelMsgResp 取消消息响应
+type CancelMsgResp struct {
+	RespComm
+	Cancelled []string `json:"cancelled"` // 取消成功的消息ID
+	Skipped   []string `json:"skipped"`   // 已投递或已处于最终状态，无法取消的消息ID
+}
+
 type CreateTemplateReq struct {
-	SourceID string `json:"sourceID" form:"sourceID"`
-	Name     string `json:"name" form:"name"`
-	Subject  string `json:"subject" form:"subject"`
-	SignName string `json:"signName" form:"signName"`
-	Channel  int    `json:"channel" form:"channel"`
-	Content  string `json:"content" form:"content"`
+	SourceID string               `json:"sourceID" form:"sourceID"`
+	Name     string               `json:"name" form:"name"`
+	Subject  string               `json:"subject" form:"subject"`
+	SignName string               `json:"signName" form:"signName"`
+	Channel  int                  `json:"channel" form:"channel"`
+	Content  string               `json:"content" form:"content"`
+	Fallback *data.FallbackPolicy `json:"fallback" form:"-"`
 }
 
 type CreateTemplateResp struct {
@@ -81,22 +209,24 @@ type GetTemplateReq struct {
 
 type GetTemplateResp struct {
 	RespComm
-	RelTemplateID string `json:"relTemplateID"`
-	SourceID      string `json:"sourceID" form:"sourceID"`
-	SignName      string `json:"signName" form:"signName"`
-	Name          string `json:"name" form:"name"`
-	Subject       string `json:"subject" form:"subject"`
-	Channel       int    `json:"channel" form:"channel"`
-	Content       string `json:"content" form:"content"`
+	RelTemplateID string               `json:"relTemplateID"`
+	SourceID      string               `json:"sourceID" form:"sourceID"`
+	SignName      string               `json:"signName" form:"signName"`
+	Name          string               `json:"name" form:"name"`
+	Subject       string               `json:"subject" form:"subject"`
+	Channel       int                  `json:"channel" form:"channel"`
+	Content       string               `json:"content" form:"content"`
+	Fallback      *data.FallbackPolicy `json:"fallback"`
 }
 
 type UpdateTemplateReq struct {
-	TemplateID string `json:"templateID"`
-	Name       string `json:"name" form:"name"`
-	SourceID   string `json:"sourceID" form:"sourceID"`
-	Subject    string `json:"subject" form:"subject"`
-	Channel    int    `json:"channel" form:"channel"`
-	Content    string `json:"content" form:"content"`
+	TemplateID string               `json:"templateID"`
+	Name       string               `json:"name" form:"name"`
+	SourceID   string               `json:"sourceID" form:"sourceID"`
+	Subject    string               `json:"subject" form:"subject"`
+	Channel    int                  `json:"channel" form:"channel"`
+	Content    string               `json:"content" form:"content"`
+	Fallback   *data.FallbackPolicy `json:"fallback" form:"-"`
 }
 
 type UpdateTemplateResp struct {
@@ -0,0 +1,23 @@
+package ctrlmodel
+
+import (
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+// GetPriorityWeightsResp 查询优先级调度权重响应
+type GetPriorityWeightsResp struct {
+	RespComm
+	PriorityWeights *data.PriorityWeights `json:"priorityWeights"`
+}
+
+// UpdatePriorityWeightsReq 调整优先级调度权重请求，只修改指定的优先级，未指定minShare时保持不变
+type UpdatePriorityWeightsReq struct {
+	Weights  map[string]int `json:"weights"`  // 各优先级的权重，key为high、middle、low、retry，不能为负数
+	MinShare *float64       `json:"minShare"` // 每个优先级每轮至少分得的发送份额，取值0~0.25
+}
+
+// UpdatePriorityWeightsResp 调整优先级调度权重响应，返回调整后的权重
+type UpdatePriorityWeightsResp struct {
+	RespComm
+	PriorityWeights *data.PriorityWeights `json:"priorityWeights"`
+}
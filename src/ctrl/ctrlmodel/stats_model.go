@@ -0,0 +1,37 @@
+package ctrlmodel
+
+// MsgStatsReq 消息统计请求
+type MsgStatsReq struct {
+	Granularity string `form:"granularity"` // 时间粒度: minute, hour, day，默认hour
+	StartTime   string `form:"startTime"`   // 开始时间，格式 2006-01-02 15:04:05，默认为结束时间前一个默认时间范围
+	EndTime     string `form:"endTime"`     // 结束时间（不含），默认为当前时间
+	GroupBy     string `form:"groupBy"`     // 逗号分隔的分组维度: channel, sourceID, templateID, status
+	Channel     int    `form:"channel"`     // 可选：按渠道过滤
+	SourceID    string `form:"sourceID"`    // 可选：按业务ID过滤
+	TemplateID  string `form:"templateID"`  // 可选：按模板ID过滤
+}
+
+// MsgStatsItem 一个统计桶内一个分组的统计，未参与分组的维度不返回
+type MsgStatsItem struct {
+	BucketTime  string  `json:"bucketTime,omitempty"`
+	Channel     int     `json:"channel,omitempty"`
+	SourceID    string  `json:"sourceID,omitempty"`
+	TemplateID  string  `json:"templateID,omitempty"`
+	Status      int     `json:"status,omitempty"`
+	Total       int64   `json:"total"`     // 到达最终状态的消息数
+	Succ        int64   `json:"succ"`      // 投递成功数
+	Failed      int64   `json:"failed"`    // 投递失败数
+	Expired     int64   `json:"expired"`   // 过期丢弃数
+	Cancelled   int64   `json:"cancelled"` // 取消数
+	SuccessRate float64 `json:"successRate"`
+}
+
+// MsgStatsResp 消息统计响应
+type MsgStatsResp struct {
+	RespComm
+	Granularity string          `json:"granularity"`
+	StartTime   string          `json:"startTime"`
+	EndTime     string          `json:"endTime"`
+	Items       []*MsgStatsItem `json:"items"`
+	Summary     *MsgStatsItem   `json:"summary"` // 整个时间范围的合计
+}
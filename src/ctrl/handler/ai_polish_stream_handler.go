@@ -64,7 +64,7 @@ func (h *AIPolishHandler) PolishContentStream(c *gin.Context) {
 	c.Header("X-Accel-Buffering", "no")
 
 	// 发送开始事件
-	sendSSE(c.Writer, "start", map[string]interface{}{
+	SendSSE(c.Writer, "start", map[string]interface{}{
 		"message": "开始优化内容...",
 	})
 	c.Writer.Flush()
@@ -91,7 +91,7 @@ func (h *AIPolishHandler) PolishContentStream(c *gin.Context) {
 		accumulatedContent += chunk
 
 		// 发送chunk事件
-		sendSSE(c.Writer, "chunk", map[string]interface{}{
+		SendSSE(c.Writer, "chunk", map[string]interface{}{
 			"content": chunk,
 			"total":   accumulatedContent,
 		})
@@ -109,7 +109,7 @@ func (h *AIPolishHandler) PolishContentStream(c *gin.Context) {
 
 	if err != nil {
 		log.Errorf("❌ 内容润色失败: %v", err)
-		sendSSE(c.Writer, "error", map[string]interface{}{
+		SendSSE(c.Writer, "error", map[string]interface{}{
 			"message": "内容优化失败: " + err.Error(),
 		})
 		c.Writer.Flush()
@@ -143,7 +143,7 @@ func (h *AIPolishHandler) PolishContentStream(c *gin.Context) {
 		Description: description,
 	}
 
-	sendSSE(c.Writer, "complete", polishedContent)
+	SendSSE(c.Writer, "complete", polishedContent)
 	c.Writer.Flush()
 
 	log.Infof("✅ 内容润色完成")
@@ -207,7 +207,7 @@ func (h *AIPolishHandler) PolishForSingleChannelStream(c *gin.Context) {
 	c.Header("X-Accel-Buffering", "no")
 
 	// 发送开始事件
-	sendSSE(c.Writer, "start", map[string]interface{}{
+	SendSSE(c.Writer, "start", map[string]interface{}{
 		"channel": req.Channel,
 		"message": "开始生成内容...",
 	})
@@ -252,7 +252,7 @@ func (h *AIPolishHandler) PolishForSingleChannelStream(c *gin.Context) {
 		accumulatedContent += chunk
 
 		// 发送chunk事件
-		sendSSE(c.Writer, "chunk", map[string]interface{}{
+		SendSSE(c.Writer, "chunk", map[string]interface{}{
 			"content": chunk,
 			"total":   accumulatedContent,
 		})
@@ -270,7 +270,7 @@ func (h *AIPolishHandler) PolishForSingleChannelStream(c *gin.Context) {
 
 	if err != nil {
 		log.Errorf("❌ 流式润色失败: %v", err)
-		sendSSE(c.Writer, "error", map[string]interface{}{
+		SendSSE(c.Writer, "error", map[string]interface{}{
 			"message": "内容生成失败: " + err.Error(),
 		})
 		c.Writer.Flush()
@@ -304,14 +304,14 @@ func (h *AIPolishHandler) PolishForSingleChannelStream(c *gin.Context) {
 		Description: description,
 	}
 
-	sendSSE(c.Writer, "complete", polishedContent)
+	SendSSE(c.Writer, "complete", polishedContent)
 	c.Writer.Flush()
 
 	log.Infof("✅ 流式润色完成")
 }
 
-// sendSSE 发送SSE事件
-func sendSSE(w gin.ResponseWriter, event string, data interface{}) {
+// SendSSE 发送SSE事件
+func SendSSE(w gin.ResponseWriter, event string, data interface{}) {
 	eventData := StreamEvent{
 		Event: event,
 		Data:  data,
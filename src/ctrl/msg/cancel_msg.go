@@ -0,0 +1,228 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+// CancelMsgHandler 接口处理handler
+type CancelMsgHandler struct {
+	Req    ctrlmodel.CancelMsgReq
+	Resp   ctrlmodel.CancelMsgResp
+	UserId string
+}
+
+// CancelMsg 接口，取消尚未投递的消息
+func CancelMsg(c *gin.Context) {
+	var hd CancelMsgHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+	// 解析请求包
+	if err := c.ShouldBind(&hd.Req); err != nil {
+		log.Errorf("CancelMsg shouldBind err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+	// 执行处理函数, 这里会调用对应的HandleInput和HandleProcess
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("CancelMsg handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *CancelMsgHandler) HandleInput() error {
+	if p.Req.MsgID == "" && p.Req.BatchID == "" {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *CancelMsgHandler) HandleProcess() error {
+	log.Infof("into HandleProcess")
+	ctx := context.Background()
+
+	msgIDs, err := p.collectMsgIDs()
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+
+	p.Resp.Cancelled = make([]string, 0, len(msgIDs))
+	p.Resp.Skipped = make([]string, 0)
+	for _, msgID := range msgIDs {
+		cancelled, err := cancelOneMsg(ctx, msgID, p.UserId)
+		if err != nil {
+			log.Errorf("取消消息 %s 失败: %s", msgID, err.Error())
+			p.Resp.Code = constant.ERR_UPDATE
+			return err
+		}
+		if cancelled {
+			p.Resp.Cancelled = append(p.Resp.Cancelled, msgID)
+		} else {
+			p.Resp.Skipped = append(p.Resp.Skipped, msgID)
+		}
+	}
+
+	if len(p.Resp.Cancelled) == 0 {
+		p.Resp.Code = constant.ERR_MSG_NOT_CANCELLABLE
+		return errors.New("no message cancelled")
+	}
+	log.Infof("取消消息完成，成功 %d 条，跳过 %d 条", len(p.Resp.Cancelled), len(p.Resp.Skipped))
+	return nil
+}
+
+// collectMsgIDs 收集待取消的消息ID
+// 定时消息到达发送时间前还没有消息记录，需要从定时队列中查找
+func (p *CancelMsgHandler) collectMsgIDs() ([]string, error) {
+	db := data.GetData().GetDB()
+	seen := make(map[string]bool)
+	var msgIDs []string
+	add := func(msgID string) {
+		if !seen[msgID] {
+			seen[msgID] = true
+			msgIDs = append(msgIDs, msgID)
+		}
+	}
+
+	if p.Req.MsgID != "" {
+		add(p.Req.MsgID)
+	}
+	if p.Req.BatchID != "" {
+		records, err := data.MsgRecordNsp.ListByBatchID(db, p.Req.BatchID)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			add(record.MsgId)
+		}
+		timerMsgs, err := data.MsgTmpQueueTimerNsp.ListByBatchID(db, p.Req.BatchID, int(data.TIMER_MSG_STATUS_PENDING))
+		if err != nil {
+			return nil, err
+		}
+		for _, timerMsg := range timerMsgs {
+			add(timerMsg.MsgId)
+		}
+	}
+	return msgIDs, nil
+}
+
+// cancelOneMsg 取消单条消息，只有调用方自己发送的、等待中的消息可以取消，返回是否取消成功
+func cancelOneMsg(ctx context.Context, msgID, sourceID string) (bool, error) {
+	dt := data.GetData()
+	db := dt.GetDB()
+
+	owned, err := isMsgOwnedBy(db, msgID, sourceID)
+	if err != nil || !owned {
+		return false, err
+	}
+
+	// 定时消息：还未到发送时间的消息只在定时队列中
+	timerCancelled, err := data.MsgTmpQueueTimerNsp.CompareAndSetStatus(db, msgID,
+		int(data.TIMER_MSG_STATUS_PENDING), int(data.TIMER_MSG_STATUS_CANCELLED))
+	if err != nil {
+		return false, err
+	}
+
+	// 消息记录：只有等待中的消息可以取消，已投递或已失败的保持原状态
+	recordCancelled, err := data.MsgRecordNsp.CompareAndUpdateStatus(db, msgID,
+		int(data.MSG_STATUS_PENDING), int(data.MSG_STATUS_CANCELLED))
+	if err != nil {
+		return false, err
+	}
+	if timerCancelled && !recordCancelled {
+		if err := createCancelledTimerRecord(db, msgID); err != nil {
+			log.Errorf("创建定时消息 %s 的取消记录失败: %s", msgID, err.Error())
+		}
+	}
+	if !timerCancelled && !recordCancelled {
+		return false, nil
+	}
+
+	// 取消成功后写入取消标记，之后MQ中的消息都会被消费者跳过
+	// 标记写入前已被消费的消息投递后不会覆盖取消状态
+	if err := dt.SetCancelTombstone(ctx, msgID); err != nil {
+		log.Errorf("写入消息 %s 的取消标记失败: %s", msgID, err.Error())
+	}
+
+	// MySQL队列中等待中的消息标记为已取消，消息记录不保存优先级，逐个队列尝试
+	if config.Conf.Common.MySQLAsMq {
+		for _, priority := range []data.PriorityEnum{data.PRIORITY_LOW, data.PRIORITY_MIDDLE,
+			data.PRIORITY_HIGH, data.PRIORITY_RETRY} {
+			_, err := data.MsgQueueNsp.CompareAndSetStatus(db, data.GetPriorityStr(priority), msgID,
+				int(data.TASK_STATUS_PENDING), int(data.TASK_STATUS_CANCELLED))
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// 删除消息记录缓存，避免查询到取消前的状态
+	dt.GetCache().Del(ctx, data.REDIS_KEY_MES_RECORD+msgID)
+	if recordCancelled {
+		event := &data.MsgStatusEvent{MsgID: msgID, Status: data.MSG_EVENT_CANCELLED}
+		if record, err := data.MsgRecordNsp.Find(db, msgID); err == nil {
+			event.BatchID = record.BatchID
+			event.Channel = record.Channel
+		}
+		dt.PublishMsgStatus(ctx, event)
+	}
+	log.Infof("消息 %s 已取消", msgID)
+	return true, nil
+}
+
+// isMsgOwnedBy 判断消息是否由sourceID发送，定时消息到达发送时间前以定时队列中的请求为准
+func isMsgOwnedBy(db *gorm.DB, msgID, sourceID string) (bool, error) {
+	record, err := data.MsgRecordNsp.Find(db, msgID)
+	if err == nil {
+		return record.SourceID == sourceID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	timerMsg, err := data.MsgTmpQueueTimerNsp.Find(db, msgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var req = new(ctrlmodel.SendMsgReq)
+	if err := json.Unmarshal([]byte(timerMsg.Req), req); err != nil {
+		return false, err
+	}
+	return req.SourceID == sourceID, nil
+}
+
+// createCancelledTimerRecord 为尚未发送的定时消息创建已取消的消息记录
+func createCancelledTimerRecord(db *gorm.DB, msgID string) error {
+	timerMsg, err := data.MsgTmpQueueTimerNsp.Find(db, msgID)
+	if err != nil {
+		return err
+	}
+	var req = new(ctrlmodel.SendMsgReq)
+	if err := json.Unmarshal([]byte(timerMsg.Req), req); err != nil {
+		return err
+	}
+	return tools.CreateMsgRecord(db, msgID, req, nil, int(data.MSG_STATUS_CANCELLED))
+}
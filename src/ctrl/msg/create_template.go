@@ -100,6 +100,12 @@ func (p *CreateTemplateHandler) HandleProcess() error {
 	mt.SourceID = p.Req.SourceID
 	// 设置签名，主要用于短信
 	mt.SignName = p.Req.SignName
+	// 设置渠道降级策略
+	mt.Fallback = p.Req.Fallback
+	if err := checkFallbackTemplates(dt.GetDB(), mt.Fallback, mt); err != nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return err
+	}
 	// 设置状态为正常状态，可以立即使用
 	mt.Status = int(data.TEMPLATE_STATUS_NORMAL)
 	// 将新模板保存到数据库中
@@ -0,0 +1,37 @@
+package msg
+
+import (
+	"fmt"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"gorm.io/gorm"
+)
+
+// checkFallbackTemplates 检查降级策略中各渠道使用的模板
+// 短信只能按短信模板发送，降级到短信时必须在策略中指定短信模板，原消息本身是短信模板时除外；
+// 指定的模板必须存在、可用，且属于对应的渠道
+func checkFallbackTemplates(db *gorm.DB, policy *data.FallbackPolicy, mt *data.MsgTemplate) error {
+	if policy == nil {
+		return nil
+	}
+	for _, channel := range policy.Channels {
+		templateID := policy.TemplateFor(channel)
+		if templateID == "" {
+			if channel == int(data.Channel_SMS) && (mt == nil || mt.Channel != channel) {
+				return fmt.Errorf("fallback to channel %d requires a template in fallback.templates", channel)
+			}
+			continue
+		}
+		tp, err := data.MsgTemplateNsp.Find(db, templateID)
+		if err != nil {
+			return fmt.Errorf("fallback template %s for channel %d: %w", templateID, channel, err)
+		}
+		if tp.Channel != channel {
+			return fmt.Errorf("fallback template %s belongs to channel %d, not %d", templateID, tp.Channel, channel)
+		}
+		if tp.Status != int(data.TEMPLATE_STATUS_NORMAL) {
+			return fmt.Errorf("fallback template %s is not ready", templateID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package msg
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+// GetDeadLetterHandler 死信详情处理handler
+type GetDeadLetterHandler struct {
+	Req    ctrlmodel.GetDeadLetterReq
+	Resp   ctrlmodel.GetDeadLetterResp
+	UserId string
+}
+
+// GetDeadLetter 死信详情接口，返回最后的失败原因、失败历史和原始请求
+func GetDeadLetter(c *gin.Context) {
+	var hd GetDeadLetterHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求参数
+	if err := c.ShouldBindQuery(&hd.Req); err != nil {
+		log.Errorf("GetDeadLetter shouldBindQuery err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("GetDeadLetter handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *GetDeadLetterHandler) HandleInput() error {
+	if p.Req.ID <= 0 && p.Req.MsgID == "" {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *GetDeadLetterHandler) HandleProcess() error {
+	log.Infof("into GetDeadLetter HandleProcess")
+	db := data.GetData().GetDB()
+
+	var deadLetter *data.MsgDeadLetter
+	var err error
+	if p.Req.ID > 0 {
+		deadLetter, err = data.MsgDeadLetterNsp.Find(db, p.Req.ID)
+	} else {
+		deadLetter, err = data.MsgDeadLetterNsp.FindByMsgID(db, p.Req.MsgID)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			p.Resp.Code = constant.ERR_DEAD_LETTER_NOT_FOUND
+		} else {
+			p.Resp.Code = constant.ERR_QUERY
+		}
+		return err
+	}
+
+	p.Resp.DeadLetter = deadLetter
+	var req = new(ctrlmodel.SendMsgReq)
+	if err := json.Unmarshal([]byte(deadLetter.Req), req); err != nil {
+		// 原始请求无法解析时仍返回死信本身
+		log.Errorf("解析死信 %d 的原始请求失败: %s", deadLetter.ID, err.Error())
+		return nil
+	}
+	p.Resp.Request = req
+	return nil
+}
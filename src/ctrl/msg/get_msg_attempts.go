@@ -0,0 +1,67 @@
+package msg
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// GetMsgAttemptsHandler 查询消息投递尝试处理handler
+type GetMsgAttemptsHandler struct {
+	Req    ctrlmodel.GetMsgAttemptsReq
+	Resp   ctrlmodel.GetMsgAttemptsResp
+	UserId string
+}
+
+// GetMsgAttempts 查询消息投递尝试接口，按投递顺序返回每次发送的渠道、耗时和结果
+func GetMsgAttempts(c *gin.Context) {
+	var hd GetMsgAttemptsHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求参数
+	if err := c.ShouldBindQuery(&hd.Req); err != nil {
+		log.Errorf("GetMsgAttempts shouldBindQuery err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("GetMsgAttempts handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *GetMsgAttemptsHandler) HandleInput() error {
+	if p.Req.MsgID == "" {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *GetMsgAttemptsHandler) HandleProcess() error {
+	log.Infof("into GetMsgAttempts HandleProcess")
+	attempts, err := data.MsgAttemptNsp.ListByMsgID(data.GetData().GetDB(), p.Req.MsgID)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+	p.Resp.Attempts = attempts
+	return nil
+}
@@ -78,13 +78,66 @@ func (p *GetMsgRecordHandler) HandleProcess() error {
 		}
 	}
 
-	p.Resp.Subject = record.Subject
-	p.Resp.TemplateID = record.TemplateID
-	p.Resp.TemplateData = make(map[string]string)
-	err := json.Unmarshal([]byte(record.TemplateData), &p.Resp.TemplateData)
+	attempts, err := data.MsgAttemptNsp.ListByMsgID(dt.GetDB(), p.Req.MsgID)
+	if err != nil {
+		log.ErrorContextf(ctx, "MsgAttemptNsp.ListByMsgID err %s", err.Error())
+		return err
+	}
+	view, err := newMsgRecordView(record, attempts)
+	p.Resp.MsgRecordView = *view
 	if err != nil {
 		log.Errorf("json.Unmarshal err %s", err.Error())
 		return err
 	}
 	return nil
 }
+
+// newMsgRecordView 由消息记录和投递尝试日志组装消息的完整状态视图，模板数据解析失败时仍返回其余字段
+func newMsgRecordView(record *data.MsgRecord, attempts []*data.MsgAttempt) (*ctrlmodel.MsgRecordView, error) {
+	view := &ctrlmodel.MsgRecordView{
+		MsgID:            record.MsgId,
+		BatchID:          record.BatchID,
+		SourceID:         record.SourceID,
+		To:               record.To,
+		Subject:          record.Subject,
+		TemplateID:       record.TemplateID,
+		TemplateData:     make(map[string]string),
+		Channel:          record.Channel,
+		DeliveredChannel: record.DeliveredChannel,
+		Status:           record.Status,
+		StatusText:       data.GetMsgStatusStr(record.Status),
+		RetryCount:       record.RetryCount,
+		NextAttemptAt:    record.NextAttemptAt,
+		ErrorCategory:    record.ErrorCategory,
+		ErrorCode:        record.ErrorCode,
+		LastError:        record.LastError,
+		CreateTime:       record.CreateTime,
+		ModifyTime:       record.ModifyTime,
+		Channels:         make([]*ctrlmodel.ChannelOutcome, 0),
+	}
+
+	// 按渠道首次尝试的顺序汇总，每个渠道保留最近一次发送的结果
+	outcomes := make(map[int]*ctrlmodel.ChannelOutcome)
+	for _, attempt := range attempts {
+		outcome, ok := outcomes[attempt.Channel]
+		if !ok {
+			outcome = &ctrlmodel.ChannelOutcome{Channel: attempt.Channel}
+			outcomes[attempt.Channel] = outcome
+			view.Channels = append(view.Channels, outcome)
+		}
+		outcome.Attempts++
+		outcome.Provider = attempt.Provider
+		outcome.Status = attempt.Status
+		outcome.ErrorCategory = attempt.ErrorCategory
+		outcome.ErrorCode = attempt.ErrorCode
+		outcome.LastError = attempt.Response
+		outcome.ProviderMsgID = attempt.ProviderMsgID
+		outcome.LastAttemptAt = attempt.CreateTime
+	}
+
+	if record.TemplateData == "" {
+		return view, nil
+	}
+	err := json.Unmarshal([]byte(record.TemplateData), &view.TemplateData)
+	return view, err
+}
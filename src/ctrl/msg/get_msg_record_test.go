@@ -0,0 +1,47 @@
+package msg
+
+import (
+	"testing"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+func TestNewMsgRecordView(t *testing.T) {
+	record := &data.MsgRecord{
+		MsgId:            "msg_001",
+		Channel:          1,
+		DeliveredChannel: 2,
+		Status:           int(data.MSG_STATUS_SUCC),
+		RetryCount:       2,
+		TemplateData:     `{"name":"张三"}`,
+	}
+	attempts := []*data.MsgAttempt{
+		{MsgId: "msg_001", Channel: 1, Provider: "smtp", Status: int(data.ATTEMPT_STATUS_FAILED), ErrorCode: "421"},
+		{MsgId: "msg_001", Channel: 1, Provider: "smtp", Status: int(data.ATTEMPT_STATUS_FAILED), ErrorCode: "550"},
+		{MsgId: "msg_001", Channel: 2, Provider: "aliyun_sms", Status: int(data.ATTEMPT_STATUS_SUCC), ProviderMsgID: "biz_001"},
+	}
+
+	view, err := newMsgRecordView(record, attempts)
+	if err != nil {
+		t.Fatalf("newMsgRecordView err %v", err)
+	}
+	if view.StatusText != "succeeded" || view.TemplateData["name"] != "张三" {
+		t.Errorf("view = %+v", view)
+	}
+	if len(view.Channels) != 2 {
+		t.Fatalf("len(Channels) = %d, want 2", len(view.Channels))
+	}
+	email, sms := view.Channels[0], view.Channels[1]
+	if email.Channel != 1 || email.Attempts != 2 || email.Status != int(data.ATTEMPT_STATUS_FAILED) || email.ErrorCode != "550" {
+		t.Errorf("email outcome = %+v", email)
+	}
+	if sms.Channel != 2 || sms.Attempts != 1 || sms.Status != int(data.ATTEMPT_STATUS_SUCC) || sms.ProviderMsgID != "biz_001" {
+		t.Errorf("sms outcome = %+v", sms)
+	}
+
+	record.TemplateData = "{"
+	view, err = newMsgRecordView(record, nil)
+	if err == nil || view.MsgID != "msg_001" || len(view.Channels) != 0 {
+		t.Errorf("invalid template data: view = %+v, err = %v", view, err)
+	}
+}
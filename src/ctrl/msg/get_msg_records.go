@@ -0,0 +1,113 @@
+package msg
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// GetMsgRecordsHandler 批量查询消息记录处理handler
+type GetMsgRecordsHandler struct {
+	Req    ctrlmodel.GetMsgRecordsReq
+	Resp   ctrlmodel.GetMsgRecordsResp
+	UserId string
+}
+
+// GetMsgRecords 批量查询消息记录接口，按请求中msgID的顺序返回完整状态视图
+func GetMsgRecords(c *gin.Context) {
+	var hd GetMsgRecordsHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求包
+	if err := c.ShouldBind(&hd.Req); err != nil {
+		log.Errorf("GetMsgRecords shouldBind err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("GetMsgRecords handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查，去掉空值和重复的msgID
+func (p *GetMsgRecordsHandler) HandleInput() error {
+	seen := make(map[string]bool, len(p.Req.MsgIDs))
+	msgIDs := make([]string, 0, len(p.Req.MsgIDs))
+	for _, msgID := range p.Req.MsgIDs {
+		if msgID == "" || seen[msgID] {
+			continue
+		}
+		seen[msgID] = true
+		msgIDs = append(msgIDs, msgID)
+	}
+	if len(msgIDs) == 0 {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	if len(msgIDs) > constant.MAX_MSG_RECORDS_LIMIT {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return fmt.Errorf("一次最多查询%d条消息记录", constant.MAX_MSG_RECORDS_LIMIT)
+	}
+	p.Req.MsgIDs = msgIDs
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *GetMsgRecordsHandler) HandleProcess() error {
+	log.Infof("into GetMsgRecords HandleProcess")
+	db := data.GetData().GetDB()
+
+	records, err := data.MsgRecordNsp.FindByMsgIDs(db, p.Req.MsgIDs)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+	attempts, err := data.MsgAttemptNsp.ListByMsgIDs(db, p.Req.MsgIDs)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+
+	recordMap := make(map[string]*data.MsgRecord, len(records))
+	for _, record := range records {
+		recordMap[record.MsgId] = record
+	}
+	attemptMap := make(map[string][]*data.MsgAttempt)
+	for _, attempt := range attempts {
+		attemptMap[attempt.MsgId] = append(attemptMap[attempt.MsgId], attempt)
+	}
+
+	p.Resp.Records = make([]*ctrlmodel.MsgRecordView, 0, len(records))
+	p.Resp.NotFound = make([]string, 0)
+	for _, msgID := range p.Req.MsgIDs {
+		record, ok := recordMap[msgID]
+		if !ok {
+			p.Resp.NotFound = append(p.Resp.NotFound, msgID)
+			continue
+		}
+		view, err := newMsgRecordView(record, attemptMap[msgID])
+		if err != nil {
+			// 模板数据无法解析时仍返回其余状态字段
+			log.Errorf("解析消息 %s 的模板数据失败: %s", msgID, err.Error())
+		}
+		p.Resp.Records = append(p.Resp.Records, view)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package msg
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// GetPriorityWeightsHandler 查询优先级调度权重处理handler
+type GetPriorityWeightsHandler struct {
+	Resp   ctrlmodel.GetPriorityWeightsResp
+	UserId string
+	ctx    *gin.Context
+}
+
+// GetPriorityWeights 查询MySQL队列当前的优先级调度权重
+func GetPriorityWeights(c *gin.Context) {
+	hd := GetPriorityWeightsHandler{ctx: c}
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("GetPriorityWeights handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *GetPriorityWeightsHandler) HandleInput() error {
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *GetPriorityWeightsHandler) HandleProcess() error {
+	log.Infof("into GetPriorityWeights HandleProcess")
+	weights, err := data.GetData().GetPriorityWeights(p.ctx)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+	p.Resp.PriorityWeights = weights
+	return nil
+}
@@ -60,5 +60,6 @@ func (p *GetTemplateHandler) HandleProcess() error {
 	p.Resp.SignName = mt.SignName
 	p.Resp.Content = mt.Content
 	p.Resp.RelTemplateID = mt.RelTemplateID
+	p.Resp.Fallback = mt.Fallback
 	return nil
 }
@@ -0,0 +1,83 @@
+package msg
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// ListDeadLettersHandler 死信列表处理handler
+type ListDeadLettersHandler struct {
+	Req    ctrlmodel.ListDeadLettersReq
+	Resp   ctrlmodel.ListDeadLettersResp
+	UserId string
+}
+
+// ListDeadLetters 死信列表接口
+func ListDeadLetters(c *gin.Context) {
+	var hd ListDeadLettersHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求参数
+	if err := c.ShouldBindQuery(&hd.Req); err != nil {
+		log.Errorf("ListDeadLetters shouldBindQuery err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("ListDeadLetters handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *ListDeadLettersHandler) HandleInput() error {
+	// 设置默认值
+	if p.Req.Page <= 0 {
+		p.Req.Page = 1
+	}
+	if p.Req.PageSize <= 0 {
+		p.Req.PageSize = 10
+	}
+	if p.Req.PageSize > 100 {
+		p.Req.PageSize = 100
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *ListDeadLettersHandler) HandleProcess() error {
+	log.Infof("into ListDeadLetters HandleProcess")
+	dt := data.GetData()
+
+	// 计算偏移量
+	offset := (p.Req.Page - 1) * p.Req.PageSize
+
+	deadLetters, total, err := data.MsgDeadLetterNsp.List(dt.GetDB(), offset, p.Req.PageSize,
+		p.Req.MsgID, p.Req.Channel, p.Req.Status)
+	if err != nil {
+		log.Errorf("查询死信列表失败: %s", err.Error())
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+
+	p.Resp.DeadLetters = deadLetters
+	p.Resp.Total = total
+	p.Resp.Page = p.Req.Page
+	return nil
+}
@@ -69,6 +69,7 @@ func (p *ListMsgRecordsHandler) HandleProcess() error {
 		offset,
 		p.Req.PageSize,
 		p.Req.MsgID,
+		p.Req.BatchID,
 		p.Req.To,
 		p.Req.Status,
 		p.Req.StartTime,
@@ -0,0 +1,153 @@
+package msg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// 状态流的心跳间隔，避免代理断开空闲连接
+const MSG_STATUS_STREAM_HEARTBEAT = 15 * time.Second
+
+// MsgStatusStream 消息状态流接口，以SSE推送消息的状态变化
+// 先推送消息当前的状态（snapshot事件），之后每次状态变化推送一个status事件，
+// 跟踪的消息都到达最终状态后推送complete事件并结束
+func MsgStatusStream(c *gin.Context) {
+	var req ctrlmodel.MsgStatusStreamReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		log.Errorf("MsgStatusStream shouldBindQuery err %s", err.Error())
+		writeStreamErr(c, constant.ERR_SHOULD_BIND)
+		return
+	}
+	if req.MsgID == "" && req.BatchID == "" {
+		writeStreamErr(c, constant.ERR_INPUT_INVALID)
+		return
+	}
+
+	dt := data.GetData()
+	ctx := c.Request.Context()
+
+	// 先订阅再查询当前状态，避免遗漏两者之间的状态变化
+	sub := dt.GetCache().Subscribe(ctx, data.REDIS_CHANNEL_MSG_STATUS)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Errorf("订阅消息状态频道失败: %s", err.Error())
+		writeStreamErr(c, constant.ERR_INTERNAL)
+		return
+	}
+
+	var records []*data.MsgRecord
+	var err error
+	if req.MsgID != "" {
+		var record *data.MsgRecord
+		if record, err = data.MsgRecordNsp.Find(dt.GetDB(), req.MsgID); err == nil {
+			records = append(records, record)
+		}
+	} else {
+		records, err = data.MsgRecordNsp.ListByBatchID(dt.GetDB(), req.BatchID)
+	}
+	// 消息记录可能尚未创建（如定时消息），此时只推送之后的状态变化
+	if err != nil {
+		log.Infof("查询消息 %s 批次 %s 的当前状态失败: %s", req.MsgID, req.BatchID, err.Error())
+	}
+
+	// 设置SSE响应头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// pending 记录尚未到达最终状态的消息
+	pending := make(map[string]bool)
+	for _, record := range records {
+		event := recordStatusEvent(record)
+		handler.SendSSE(c.Writer, "snapshot", event)
+		if !data.IsFinalMsgEvent(event.Status) {
+			pending[record.MsgId] = true
+		}
+	}
+	if len(records) > 0 && len(pending) == 0 {
+		handler.SendSSE(c.Writer, "complete", nil)
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(MSG_STATUS_STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var event data.MsgStatusEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Errorf("解析消息状态事件失败: %s", err.Error())
+				continue
+			}
+			if (req.MsgID != "" && event.MsgID != req.MsgID) ||
+				(req.MsgID == "" && event.BatchID != req.BatchID) {
+				continue
+			}
+			handler.SendSSE(c.Writer, "status", event)
+			c.Writer.Flush()
+
+			if !data.IsFinalMsgEvent(event.Status) {
+				pending[event.MsgID] = true
+				continue
+			}
+			delete(pending, event.MsgID)
+			// 单条消息到达最终状态即结束；批次在快照中的消息都到达最终状态后结束
+			if req.MsgID != "" || (len(records) > 0 && len(pending) == 0) {
+				handler.SendSSE(c.Writer, "complete", nil)
+				c.Writer.Flush()
+				return
+			}
+		}
+	}
+}
+
+// recordStatusEvent 由消息记录生成当前状态事件，等待重试的消息记为RETRYING
+func recordStatusEvent(record *data.MsgRecord) *data.MsgStatusEvent {
+	event := &data.MsgStatusEvent{
+		MsgID:      record.MsgId,
+		BatchID:    record.BatchID,
+		Status:     data.GetMsgEventStatus(record.Status),
+		Channel:    record.Channel,
+		RetryCount: record.RetryCount,
+	}
+	if record.Status == int(data.MSG_STATUS_PENDING) && record.NextAttemptAt > 0 {
+		event.Status = data.MSG_EVENT_RETRYING
+		event.NextAttemptAt = record.NextAttemptAt
+	}
+	if record.Status == int(data.MSG_STATUS_FAILED) {
+		event.Error = record.LastError
+	}
+	if record.ModifyTime != nil {
+		event.Time = record.ModifyTime.UnixMilli()
+	}
+	return event
+}
+
+// writeStreamErr 建立SSE连接前出错时按普通接口返回错误码
+func writeStreamErr(c *gin.Context, code int) {
+	c.JSON(http.StatusOK, ctrlmodel.RespComm{
+		Code: code,
+		Msg:  constant.GetErrMsg(code),
+	})
+}
@@ -0,0 +1,81 @@
+package msg
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// PurgeDeadLettersHandler 清理死信处理handler
+type PurgeDeadLettersHandler struct {
+	Req    ctrlmodel.PurgeDeadLettersReq
+	Resp   ctrlmodel.PurgeDeadLettersResp
+	UserId string
+	before *time.Time
+}
+
+// PurgeDeadLetters 清理死信接口
+func PurgeDeadLetters(c *gin.Context) {
+	var hd PurgeDeadLettersHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求包
+	if err := c.ShouldBind(&hd.Req); err != nil {
+		log.Errorf("PurgeDeadLetters shouldBind err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("PurgeDeadLetters handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查，不允许无条件清空死信表
+func (p *PurgeDeadLettersHandler) HandleInput() error {
+	if len(p.Req.IDs) == 0 && p.Req.Before == "" {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	if p.Req.Before != "" {
+		before, err := time.ParseInLocation(time.DateTime, p.Req.Before, time.Local)
+		if err != nil {
+			log.Errorf("死信清理时间格式错误: %s", p.Req.Before)
+			p.Resp.Code = constant.ERR_INPUT_INVALID
+			return constant.ERR_HANDLE_INPUT
+		}
+		p.before = &before
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *PurgeDeadLettersHandler) HandleProcess() error {
+	log.Infof("into PurgeDeadLetters HandleProcess")
+
+	deleted, err := data.MsgDeadLetterNsp.Purge(data.GetData().GetDB(), p.Req.IDs, p.before, p.Req.Status)
+	if err != nil {
+		log.Errorf("清理死信失败: %s", err.Error())
+		p.Resp.Code = constant.ERR_DELETE
+		return err
+	}
+	p.Resp.Deleted = deleted
+	log.Infof("清理死信完成，共删除 %d 条", deleted)
+	return nil
+}
@@ -0,0 +1,252 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"gorm.io/gorm"
+)
+
+// 死信未能重放的原因
+const (
+	REPLAY_SKIP_NOT_FOUND = "not_found"    // 死信不存在
+	REPLAY_SKIP_REPLAYED  = "replayed"     // 已重放过，重放后再次失败会重新进入死信
+	REPLAY_SKIP_BAD_REQ   = "bad_request"  // 原始请求无法解析
+	REPLAY_SKIP_FAILED    = "enqueue_fail" // 重新入队失败
+)
+
+// ReplayDeadLettersHandler 批量重放死信处理handler
+type ReplayDeadLettersHandler struct {
+	Req    ctrlmodel.ReplayDeadLettersReq
+	Resp   ctrlmodel.ReplayDeadLettersResp
+	UserId string
+}
+
+// ReplayDeadLetters 批量重放死信接口，可选覆盖模板数据
+func ReplayDeadLetters(c *gin.Context) {
+	var hd ReplayDeadLettersHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求包
+	if err := c.ShouldBind(&hd.Req); err != nil {
+		log.Errorf("ReplayDeadLetters shouldBind err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("ReplayDeadLetters handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查
+func (p *ReplayDeadLettersHandler) HandleInput() error {
+	if len(p.Req.IDs) == 0 || len(p.Req.IDs) > 100 {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	return nil
+}
+
+// HandleProcess 处理函数
+func (p *ReplayDeadLettersHandler) HandleProcess() error {
+	log.Infof("into ReplayDeadLetters HandleProcess")
+	db := data.GetData().GetDB()
+
+	deadLetters, err := data.MsgDeadLetterNsp.FindByIDs(db, p.Req.IDs)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+	if len(deadLetters) == 0 {
+		p.Resp.Code = constant.ERR_DEAD_LETTER_NOT_FOUND
+		return errors.New("dead letter not found")
+	}
+	found := make(map[int64]*data.MsgDeadLetter, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		found[deadLetter.ID] = deadLetter
+	}
+
+	p.Resp.Replayed = make([]string, 0, len(deadLetters))
+	p.Resp.Skipped = make([]ctrlmodel.DeadLetterSkip, 0)
+	for _, id := range p.Req.IDs {
+		deadLetter, ok := found[id]
+		if !ok {
+			p.Resp.Skipped = append(p.Resp.Skipped, ctrlmodel.DeadLetterSkip{ID: id, Reason: REPLAY_SKIP_NOT_FOUND})
+			continue
+		}
+		if reason := replayOneDeadLetter(db, deadLetter, p.Req.TemplateData); reason != "" {
+			p.Resp.Skipped = append(p.Resp.Skipped, ctrlmodel.DeadLetterSkip{
+				ID: id, MsgID: deadLetter.MsgId, Reason: reason,
+			})
+			continue
+		}
+		p.Resp.Replayed = append(p.Resp.Replayed, deadLetter.MsgId)
+	}
+
+	log.Infof("重放死信完成，成功 %d 条，跳过 %d 条", len(p.Resp.Replayed), len(p.Resp.Skipped))
+	return nil
+}
+
+// replayOneDeadLetter 重放单条死信：先将死信标记为已重放，再重置消息记录并重新投递到原优先级队列，
+// 并发重放同一条死信时只有标记成功的一方会重新投递，返回未能重放的原因
+func replayOneDeadLetter(db *gorm.DB, deadLetter *data.MsgDeadLetter, templateData map[string]string) string {
+	ctx := context.Background()
+	if deadLetter.Status == int(data.DEAD_LETTER_STATUS_REPLAYED) {
+		return REPLAY_SKIP_REPLAYED
+	}
+
+	var req = new(ctrlmodel.SendMsgReq)
+	if err := json.Unmarshal([]byte(deadLetter.Req), req); err != nil {
+		log.Errorf("解析死信 %d 的原始请求失败: %s", deadLetter.ID, err.Error())
+		return REPLAY_SKIP_BAD_REQ
+	}
+
+	// 覆盖模板数据，未指定的字段保持原值
+	var tdStr string
+	if len(templateData) > 0 {
+		if req.TemplateData == nil {
+			req.TemplateData = make(map[string]string, len(templateData))
+		}
+		for k, v := range templateData {
+			req.TemplateData[k] = v
+		}
+		td, _ := json.Marshal(req.TemplateData)
+		tdStr = string(td)
+	}
+	// 重放的消息重新计算重试次数和失败历史，降级渠道从当前渠道重新计时
+	req.AttemptHistory = nil
+	req.NextAttemptAt = 0
+	if req.FallbackState != nil {
+		req.FallbackState.Deadline = 0
+	}
+	// 重试队列中的消息按中优先级重新投递
+	priority := data.PriorityEnum(req.Priority)
+	if priority < data.PRIORITY_LOW || priority > data.PRIORITY_HIGH {
+		priority = data.PRIORITY_MIDDLE
+	}
+	req.Priority = int(priority)
+
+	claimed, err := data.MsgDeadLetterNsp.ClaimReplay(db, deadLetter.ID)
+	if err != nil {
+		log.Errorf("标记死信 %d 已重放失败: %s", deadLetter.ID, err.Error())
+		return REPLAY_SKIP_FAILED
+	}
+	if !claimed {
+		return REPLAY_SKIP_REPLAYED
+	}
+
+	if err := data.MsgRecordNsp.ResetForReplay(db, req.MsgID, tdStr); err != nil {
+		log.Errorf("重置消息 %s 记录失败: %s", req.MsgID, err.Error())
+		releaseReplay(db, deadLetter.ID)
+		return REPLAY_SKIP_FAILED
+	}
+	// 删除消息记录缓存，避免查询到重放前的状态
+	data.GetData().GetCache().Del(ctx, data.REDIS_KEY_MES_RECORD+req.MsgID)
+
+	if config.Conf.Common.MySQLAsMq {
+		err = replayToMySQL(db, req)
+	} else {
+		err = replayToMQ(req)
+	}
+	if err != nil {
+		log.Errorf("重放死信 %d（消息 %s）失败: %s", deadLetter.ID, req.MsgID, err.Error())
+		// 重新入队失败，消息记录恢复为最终失败，死信恢复为待处理
+		data.MsgRecordNsp.UpdateStatus(db, req.MsgID, int(data.MSG_STATUS_FAILED))
+		releaseReplay(db, deadLetter.ID)
+		return REPLAY_SKIP_FAILED
+	}
+
+	metrics.MsgEnqueued.WithLabelValues(data.GetPriorityStr(priority)).Inc()
+	data.GetData().PublishMsgStatus(ctx, &data.MsgStatusEvent{
+		MsgID:   req.MsgID,
+		BatchID: req.BatchID,
+		Status:  data.MSG_EVENT_PENDING,
+		Channel: req.Channel,
+	})
+
+	log.Infof("死信 %d（消息 %s）已重新投递到%s优先级队列", deadLetter.ID, req.MsgID, data.GetPriorityStr(priority))
+	return ""
+}
+
+// releaseReplay 重放失败时将死信恢复为待处理，之后可以再次重放
+func releaseReplay(db *gorm.DB, id int64) {
+	if err := data.MsgDeadLetterNsp.ReleaseReplay(db, id); err != nil {
+		log.Errorf("恢复死信 %d 为待处理失败: %s", id, err.Error())
+	}
+}
+
+// replayToMySQL 将消息重新写入MySQL消息队列表，队列中已有该消息时重置为待处理
+func replayToMySQL(db *gorm.DB, req *ctrlmodel.SendMsgReq) error {
+	td, err := json.Marshal(req.TemplateData)
+	if err != nil {
+		return err
+	}
+	priorityStr := data.GetPriorityStr(data.PriorityEnum(req.Priority))
+	existing, err := data.MsgQueueNsp.Find(db, priorityStr, req.MsgID)
+	if err == nil && existing.ID != 0 {
+		return data.MsgQueueNsp.Updates(db, priorityStr, req.MsgID, map[string]interface{}{
+			"status":          int(data.TASK_STATUS_PENDING),
+			"to":              req.To,
+			"channel":         req.Channel,
+			"template_id":     req.TemplateID,
+			"template_data":   string(td),
+			"content":         req.Content,
+			"fallback":        req.FallbackState,
+			"attempt_history": req.AttemptHistory,
+			"next_attempt_at": 0,
+		})
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var md = &data.MsgQueue{
+		MsgId:        req.MsgID,
+		BatchID:      req.BatchID,
+		To:           req.To,
+		Subject:      req.Subject,
+		Channel:      req.Channel,
+		TemplateID:   req.TemplateID,
+		TemplateData: string(td),
+		Content:      req.Content,
+		Fallback:     req.FallbackState,
+		ExpireAt:     req.ExpireAt,
+		Priority:     req.Priority,
+		Status:       int(data.TASK_STATUS_PENDING),
+	}
+	return data.MsgQueueNsp.Create(db, priorityStr, md)
+}
+
+// replayToMQ 将消息重新投递到对应优先级的Kafka主题
+func replayToMQ(req *ctrlmodel.SendMsgReq) error {
+	msgJson, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	producer := data.GetData().GetProducer(data.PriorityEnum(req.Priority))
+	if producer == nil {
+		return errors.New("no producer for priority " + data.GetPriorityStr(data.PriorityEnum(req.Priority)))
+	}
+	return producer.SendMessage(context.Background(), "", msgJson)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,16 +19,29 @@ import (
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/tools"
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/utils"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
+var (
+	// errQuotaExceeded 超出限频配额
+	errQuotaExceeded = errors.New("request limit exceeded")
+	// errPersistFailed 消息持久化失败
+	errPersistFailed = errors.New("persist message failed")
+)
+
 // SendMsgHandler 接口处理handler
 type SendMsgHandler struct {
 	Req    ctrlmodel.SendMsgReq
 	Resp   ctrlmodel.SendMsgResp
 	UserId string
+
+	ctx      context.Context      // 请求上下文，携带接口的链路追踪信息
+	fallback *data.FallbackPolicy // 生效的渠道降级策略
 }
 
 // SendMsg 接口
@@ -39,12 +53,17 @@ func SendMsg(c *gin.Context) {
 	}()
 	// 获取用户Id
 	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+	hd.ctx = c.Request.Context()
 	// 解析请求包
 	if err := c.ShouldBind(&hd.Req); err != nil {
 		log.Errorf("SendMsg shouldBind err %s", err.Error())
 		hd.Resp.Code = constant.ERR_SHOULD_BIND
 		return
 	}
+	// 幂等键优先取请求体，其次取请求头
+	if hd.Req.IdempotencyKey == "" {
+		hd.Req.IdempotencyKey = c.Request.Header.Get(constant.HEADER_IDEMPOTENCY_KEY)
+	}
 	// 执行处理函数, 这里会调用对应的HandleInput和HandleProcess，往下看
 	if err := handler.Run(&hd); err != nil {
 		log.Errorf("SendMsg handler.Run err %s", err.Error())
@@ -82,19 +101,77 @@ func (p *SendMsgHandler) HandleInput() error {
 		return nil
 	}
 
+	// 回调地址必须是http或https地址，且不能指向内网地址
+	if p.Req.NotifyURL != "" {
+		if err := tools.ValidateNotifyURL(p.Req.NotifyURL); err != nil {
+			p.Resp.Code = constant.ERR_INPUT_INVALID
+			return constant.ERR_HANDLE_INPUT
+		}
+	}
+
+	// 有效期从发送时间起算，定时消息从定时发送时间起算
+	if p.Req.TTLSeconds < 0 || p.Req.ExpireAt < 0 {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	if p.Req.ExpireAt == 0 && p.Req.TTLSeconds > 0 {
+		sendTime := time.Now().Unix()
+		if p.Req.SendTimestamp > sendTime {
+			sendTime = p.Req.SendTimestamp
+		}
+		p.Req.ExpireAt = sendTime + int64(p.Req.TTLSeconds)
+	}
+	// 发送前就已过期的消息直接拒绝
+	if p.Req.ExpireAt > 0 && (p.Req.ExpireAt <= time.Now().Unix() || p.Req.ExpireAt <= p.Req.SendTimestamp) {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+
 	if p.Req.Priority == 0 {
 		p.Req.Priority = int(data.PRIORITY_LOW)
 	}
+	// 只接受高、中、低三个优先级，Kafka模式下该优先级还必须配置了主题
+	switch data.PriorityEnum(p.Req.Priority) {
+	case data.PRIORITY_LOW, data.PRIORITY_MIDDLE, data.PRIORITY_HIGH:
+	default:
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	if !config.Conf.Common.MySQLAsMq && data.GetData().GetProducer(data.PriorityEnum(p.Req.Priority)) == nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
 	return nil
 }
 
 // HandleProcess 处理函数
-func (p *SendMsgHandler) HandleProcess() error {
+// 链路从这里开始，随消息写入队列表、发件箱或Kafka消息头，由消费者继续
+func (p *SendMsgHandler) HandleProcess() (err error) {
 	sourceID := p.UserId
-	ctx := context.Background()
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Start(ctx, "SendMsg", attribute.String("msg.source_id", sourceID))
+	defer func() {
+		span.SetAttributes(
+			attribute.String("msg.batch_id", p.Resp.BatchID),
+			attribute.Int("msg.accepted", p.Resp.Accepted),
+			attribute.Int("msg.rejected", p.Resp.Rejected))
+		tracing.End(span, err)
+	}()
 	log.Infof("into HandleProcess")
 	dt := data.GetData()
 
+	// 携带幂等键的重复请求直接返回首次请求的响应
+	if p.Req.IdempotencyKey != "" {
+		replayed, err := p.acquireIdempotency(ctx, sourceID)
+		if err != nil || replayed {
+			return err
+		}
+		defer p.releaseIdempotency(ctx, sourceID)
+	}
+
 	var mt *data.MsgTemplate
 
 	// 如果是模板模式，获取模板信息
@@ -114,8 +191,24 @@ func (p *SendMsgHandler) HandleProcess() error {
 		}
 	}
 
-	// 解析接收者列表
-	recipients, err := p.parseRecipients()
+	// 生成批次ID，关联本次请求扇出的所有消息
+	p.Req.BatchID = utils.GenerateUUID()
+	p.Resp.BatchID = p.Req.BatchID
+
+	// 请求未指定降级策略时使用模板上的策略
+	p.fallback = p.Req.Fallback
+	if p.fallback == nil && mt != nil {
+		p.fallback = mt.Fallback
+	}
+	if err := checkFallbackTemplates(dt.GetDB(), p.fallback, mt); err != nil {
+		log.Errorf("check fallback templates err %s", err.Error())
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return err
+	}
+
+	// 解析投递渠道和接收者列表，每个(接收者, 渠道)是一条独立的消息
+	channels := p.resolveChannels(mt)
+	recipients, err := p.parseRecipients(channels)
 	if err != nil {
 		log.Errorf("parse recipients err %s", err.Error())
 		p.Resp.Code = constant.ERR_INPUT_INVALID
@@ -127,75 +220,146 @@ func (p *SendMsgHandler) HandleProcess() error {
 		return errors.New("no valid recipients found")
 	}
 
-	// 批量发送消息
-	var successCount int
-	var msgIDs []string
+	// 批量发送消息，记录每个接收者的结果
+	p.Resp.MsgIDs = make([]string, 0, len(recipients))
+	p.Resp.Results = make([]ctrlmodel.SendMsgResult, 0, len(recipients))
+	for _, rcpt := range recipients {
+		result := ctrlmodel.SendMsgResult{
+			UserID:  rcpt.UserID,
+			To:      rcpt.To,
+			Channel: rcpt.Channel,
+		}
 
-	for _, recipient := range recipients {
-		// 为每个接收者创建单独的消息请求
+		// 解析阶段已被拒绝的接收者
+		if rcpt.Reason != "" {
+			result.Status = ctrlmodel.SEND_RESULT_REJECTED
+			result.Reason = rcpt.Reason
+			p.Resp.Results = append(p.Resp.Results, result)
+			continue
+		}
+
+		// 为每个接收者的每个渠道创建单独的消息请求
 		msgReq := p.Req
-		msgReq.To = recipient
+		msgReq.To = rcpt.To
+		msgReq.Channel = rcpt.Channel
+		msgReq.Channels = []int{rcpt.Channel}
+		msgReq.FallbackState = rcpt.Fallback
+		if rcpt.TemplateID != "" {
+			msgReq.TemplateID = rcpt.TemplateID
+		}
 
-		msgID, err := p.sendSingleMessage(&msgReq, mt, sourceID)
+		msgID, err := p.sendSingleMessage(ctx, &msgReq, mt, sourceID)
 		if err != nil {
-			log.Errorf("send message to %s failed: %s", recipient, err.Error())
+			log.Errorf("send message to %s failed: %s", rcpt.To, err.Error())
+			result.MsgID = msgID
+			result.Status = ctrlmodel.SEND_RESULT_REJECTED
+			result.Reason = rejectReason(err)
+			p.Resp.Results = append(p.Resp.Results, result)
 			continue
 		}
 
-		successCount++
-		msgIDs = append(msgIDs, msgID)
+		result.MsgID = msgID
+		result.Status = ctrlmodel.SEND_RESULT_ACCEPTED
+		p.Resp.Results = append(p.Resp.Results, result)
+		p.Resp.MsgIDs = append(p.Resp.MsgIDs, msgID)
 	}
 
-	if successCount == 0 {
+	p.Resp.Total = len(p.Resp.Results)
+	p.Resp.Accepted = len(p.Resp.MsgIDs)
+	p.Resp.Rejected = p.Resp.Total - p.Resp.Accepted
+
+	if p.Resp.Accepted == 0 {
 		p.Resp.Code = constant.ERR_SEND_MSG
 		return errors.New("all messages failed to send")
 	}
 
-	// 返回第一个消息ID作为主ID，实际场景中可能需要返回所有ID
-	p.Resp.MsgID = msgIDs[0]
-	log.Infof("batch send completed: %d/%d messages sent successfully", successCount, len(recipients))
+	// 保留第一个消息ID，兼容只读取msgID的调用方
+	p.Resp.MsgID = p.Resp.MsgIDs[0]
+	log.Infof("batch %s send completed: %d/%d messages accepted",
+		p.Resp.BatchID, p.Resp.Accepted, p.Resp.Total)
 	return nil
 }
 
-// parseRecipients 解析接收者列表
-func (p *SendMsgHandler) parseRecipients() ([]string, error) {
-	var recipients []string
+// recipient 解析后的单个接收者
+type recipient struct {
+	UserID     string
+	To         string
+	Channel    int
+	Reason     string              // 解析阶段被拒绝的原因，为空表示可以投递
+	TemplateID string              // 直接从降级渠道开始投递时该渠道使用的模板，为空时沿用请求的模板
+	Fallback   *data.FallbackState // 当前渠道失败后依次尝试的降级目标
+}
+
+// resolveChannels 确定投递渠道：模板模式使用模板渠道，直接发送模式使用去重后的请求渠道
+func (p *SendMsgHandler) resolveChannels(mt *data.MsgTemplate) []int {
+	if mt != nil {
+		return []int{mt.Channel}
+	}
+
+	seen := make(map[int]bool)
+	var channels []int
+	for _, channel := range p.Req.Channels {
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// parseRecipients 解析接收者列表，为每个用户在每个渠道上解析对应的联系方式
+func (p *SendMsgHandler) parseRecipients(channels []int) ([]*recipient, error) {
+	var recipients []*recipient
 	dt := data.GetData()
 
 	// 1. 直接指定的接收者
 	if p.Req.To != "" {
-		recipients = append(recipients, p.Req.To)
+		for _, channel := range channels {
+			rcpt := &recipient{To: p.Req.To, Channel: channel}
+			// 多渠道时只投递到格式匹配的渠道，避免把邮箱发给短信或飞书
+			if len(channels) > 1 && !matchChannel(p.Req.To, channel) {
+				rcpt.Reason = ctrlmodel.REJECT_REASON_NO_CONTACT
+			}
+			p.applyFallback(rcpt, func(channel int) string {
+				if matchChannel(p.Req.To, channel) {
+					return p.Req.To
+				}
+				return ""
+			})
+			recipients = append(recipients, rcpt)
+		}
 	}
 
 	// 2. 按用户ID指定的接收者
+	var users []*data.User
 	if len(p.Req.UserIDs) > 0 {
 		for _, userID := range p.Req.UserIDs {
 			user, err := data.UserNamespace.FindByUserID(dt.GetDB(), userID)
 			if err != nil {
 				log.Warnf("user %s not found: %s", userID, err.Error())
+				recipients = append(recipients, &recipient{
+					UserID: userID,
+					Reason: ctrlmodel.REJECT_REASON_USER_NOT_FOUND,
+				})
 				continue
 			}
-
-			// 根据模板渠道或直接发送渠道选择合适的联系方式
-			recipient := p.getRecipientByChannel(user)
-			if recipient != "" {
-				recipients = append(recipients, recipient)
-			}
+			users = append(users, user)
 		}
 	}
 
 	// 3. 按标签指定的接收者
 	if len(p.Req.Tags) > 0 {
-		users, err := data.UserNamespace.FindByAnyTags(dt.GetDB(), p.Req.Tags)
+		tagUsers, err := data.UserNamespace.FindByAnyTags(dt.GetDB(), p.Req.Tags)
 		if err != nil {
 			return nil, fmt.Errorf("find users by tags failed: %w", err)
 		}
+		users = append(users, tagUsers...)
+	}
 
-		for _, user := range users {
-			recipient := p.getRecipientByChannel(user)
-			if recipient != "" {
-				recipients = append(recipients, recipient)
-			}
+	// 根据渠道选择用户对应的联系方式
+	for _, user := range users {
+		for _, channel := range channels {
+			recipients = append(recipients, p.newUserRecipient(user, channel))
 		}
 	}
 
@@ -204,100 +368,243 @@ func (p *SendMsgHandler) parseRecipients() ([]string, error) {
 	return recipients, nil
 }
 
-// getRecipientByChannel 根据模板渠道或直接发送渠道获取用户的联系方式
-func (p *SendMsgHandler) getRecipientByChannel(user *data.User) string {
-	ctx := context.Background()
-	dt := data.GetData()
+// newUserRecipient 根据用户信息构建接收者，没有对应联系方式时标记为拒绝
+func (p *SendMsgHandler) newUserRecipient(user *data.User, channel int) *recipient {
+	rcpt := &recipient{
+		UserID:  user.UserID,
+		To:      p.getRecipientByChannel(user, channel),
+		Channel: channel,
+	}
+	if rcpt.To == "" {
+		rcpt.Reason = ctrlmodel.REJECT_REASON_NO_CONTACT
+	}
+	p.applyFallback(rcpt, func(channel int) string {
+		return p.getRecipientByChannel(user, channel)
+	})
+	return rcpt
+}
 
-	var channel int
+// applyFallback 按降级策略解析接收者在各降级渠道上的联系方式
+// 主渠道没有联系方式时，直接从第一个可用的降级渠道开始投递
+func (p *SendMsgHandler) applyFallback(rcpt *recipient, resolve func(channel int) string) {
+	if p.fallback == nil || len(p.fallback.Channels) == 0 {
+		return
+	}
 
-	// 判断是模板模式还是直接发送模式
-	if p.Req.TemplateID != "" {
-		// 模板模式：从模板获取渠道
-		mt, err := dt.GetMsgTemplate(ctx, p.Req.TemplateID)
-		if err != nil {
-			log.Errorf("get template failed: %s", err.Error())
-			return ""
+	state := &data.FallbackState{Timeout: p.fallback.Timeout}
+	seen := map[int]bool{rcpt.Channel: true}
+	for _, channel := range p.fallback.Channels {
+		if seen[channel] {
+			continue
+		}
+		seen[channel] = true
+		// 没有联系方式的渠道直接跳过
+		if to := resolve(channel); to != "" {
+			state.Targets = append(state.Targets, data.FallbackTarget{
+				Channel:    channel,
+				To:         to,
+				TemplateID: p.fallback.TemplateFor(channel),
+			})
 		}
-		channel = mt.Channel
-	} else if len(p.Req.Channels) > 0 {
-		// 直接发送模式：使用第一个渠道
-		// 注意：当前端为多个渠道分别发送请求时，每个请求中的Channels数组只包含该渠道
-		// 例如：邮件请求中 Channels=[1]，飞书请求中 Channels=[3]
-		channel = p.Req.Channels[0]
 	}
 
-	// 根据渠道获取用户的对应联系方式
+	if rcpt.Reason == ctrlmodel.REJECT_REASON_NO_CONTACT && len(state.Targets) > 0 {
+		var next data.FallbackTarget
+		next, state = state.Next()
+		rcpt.Channel = next.Channel
+		rcpt.To = next.To
+		rcpt.TemplateID = next.TemplateID
+		rcpt.Reason = ""
+	}
+
+	if len(state.Targets) > 0 {
+		rcpt.Fallback = state
+	}
+}
+
+// getRecipientByChannel 获取用户在指定渠道上的联系方式
+func (p *SendMsgHandler) getRecipientByChannel(user *data.User, channel int) string {
 	switch channel {
-	case 1: // 邮件
+	case int(data.Channel_EMAIL):
 		if user.Email == "" {
 			log.Warnf("user %s has no email address", user.UserID)
-			return ""
 		}
 		return user.Email
-	case 2: // 短信
+	case int(data.Channel_SMS):
 		if user.Mobile == "" {
 			log.Warnf("user %s has no mobile number", user.UserID)
-			return ""
 		}
 		return user.Mobile
-	case 3: // 飞书
+	case int(data.Channel_LARK):
 		if user.LarkID == "" {
 			log.Warnf("user %s has no lark id", user.UserID)
-			return ""
 		}
 		return user.LarkID
 	default:
-		// 默认优先级：邮箱 > 手机号 > 飞书ID
-		if user.Email != "" {
-			return user.Email
-		}
-		if user.Mobile != "" {
-			return user.Mobile
-		}
-		if user.LarkID != "" {
-			return user.LarkID
-		}
-		log.Warnf("user %s has no valid contact information", user.UserID)
+		log.Warnf("user %s has no contact for channel %d", user.UserID, channel)
 		return ""
 	}
 }
 
+// mobilePattern 手机号格式
+var mobilePattern = regexp.MustCompile(`^\+?[0-9]{6,20}$`)
+
+// matchChannel 判断直接指定的接收者是否是该渠道可用的联系方式
+func matchChannel(to string, channel int) bool {
+	isEmail := strings.Contains(to, "@")
+	isMobile := mobilePattern.MatchString(to)
+	switch channel {
+	case int(data.Channel_EMAIL):
+		return isEmail
+	case int(data.Channel_SMS):
+		return isMobile
+	case int(data.Channel_LARK):
+		return !isEmail && !isMobile
+	default:
+		return false
+	}
+}
+
 // deduplicateRecipients 去重接收者列表
-func (p *SendMsgHandler) deduplicateRecipients(recipients []string) []string {
+// 同一渠道下，可投递的接收者按联系方式去重，被拒绝的接收者按用户ID去重
+func (p *SendMsgHandler) deduplicateRecipients(recipients []*recipient) []*recipient {
 	seen := make(map[string]bool)
-	var result []string
+	var result []*recipient
 
-	for _, recipient := range recipients {
-		if recipient != "" && !seen[recipient] {
-			seen[recipient] = true
-			result = append(result, recipient)
+	for _, rcpt := range recipients {
+		key := fmt.Sprintf("%d:to:%s", rcpt.Channel, rcpt.To)
+		if rcpt.Reason != "" {
+			key = fmt.Sprintf("%d:user:%s:%s", rcpt.Channel, rcpt.UserID, rcpt.To)
+		}
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, rcpt)
 		}
 	}
 
 	return result
 }
 
-// sendSingleMessage 发送单条消息
-func (p *SendMsgHandler) sendSingleMessage(msgReq *ctrlmodel.SendMsgReq, mt *data.MsgTemplate, sourceID string) (string, error) {
-	ctx := context.Background()
+// rejectReason 将发送错误转换为拒绝原因
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, errQuotaExceeded):
+		return ctrlmodel.REJECT_REASON_QUOTA_EXCEEDED
+	case errors.Is(err, errPersistFailed):
+		return ctrlmodel.REJECT_REASON_PERSIST_FAILED
+	default:
+		return ctrlmodel.REJECT_REASON_INTERNAL
+	}
+}
+
+// sendSingleMessage 发送单条消息，每条消息一个入队span
+func (p *SendMsgHandler) sendSingleMessage(ctx context.Context, msgReq *ctrlmodel.SendMsgReq, mt *data.MsgTemplate, sourceID string) (string, error) {
+	ctx, span := tracing.Start(ctx, "msg.enqueue",
+		attribute.String("msg.channel", data.GetChannelStr(msgReq.Channel)),
+		attribute.String("msg.priority", data.GetPriorityStr(data.PriorityEnum(msgReq.Priority))))
+	msgID, err := p.enqueueSingleMessage(ctx, msgReq, mt, sourceID)
+	span.SetAttributes(attribute.String("msg.id", msgID))
+	tracing.End(span, err)
+	return msgID, err
+}
+
+// enqueueSingleMessage 检查配额后将单条消息持久化，ctx中的链路上下文随消息保存
+func (p *SendMsgHandler) enqueueSingleMessage(ctx context.Context, msgReq *ctrlmodel.SendMsgReq, mt *data.MsgTemplate, sourceID string) (string, error) {
+	dt := data.GetData()
+
+	// 每条消息只投递一个渠道，配额也按该渠道检查
+	channel := msgReq.Channel
+	if channel == 0 {
+		return "", errors.New("no channel specified")
+	}
+
+	// 生成消息ID，持久化失败时也能通过该ID追踪
+	msgReq.MsgID = genMsgID(sourceID, msgReq.IdempotencyKey, msgReq.To, channel)
+	msgReq.SourceID = sourceID
+
+	// 携带幂等键时，已有消息记录说明之前的请求已经受理，不再重复入队
+	if msgReq.IdempotencyKey != "" {
+		if _, err := data.MsgRecordNsp.Find(dt.GetDB(), msgReq.MsgID); err == nil {
+			log.Infof("消息 %s 已受理过，跳过重复入队", msgReq.MsgID)
+			return msgReq.MsgID, nil
+		}
+	}
+
+	if err := p.checkQuota(ctx, msgReq, mt, sourceID); err != nil {
+		return "", err
+	}
+
+	// 定时消息
+	if msgReq.SendTimestamp > 0 {
+		msgID, err := p.sendSingleToTimer(ctx, msgReq)
+		if err != nil {
+			return msgID, fmt.Errorf("%w: %s", errPersistFailed, err.Error())
+		}
+		metrics.MsgEnqueued.WithLabelValues("timer").Inc()
+		return msgID, nil
+	}
+
+	// 消息和消息记录在同一个事务中持久化，两者要么都写入要么都不写入
+	// Kafka模式下消息先写入发件箱，事务提交后再投递
+	msgID := msgReq.MsgID
+	var outbox *data.MsgOutbox
+	msgErr := dt.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		if config.Conf.Common.MySQLAsMq {
+			err = p.sendSingleToMySQL(ctx, tx, msgReq)
+		} else {
+			outbox, err = p.sendSingleToOutbox(ctx, tx, msgReq)
+		}
+		if err != nil {
+			return err
+		}
+		// 创建消息记录，使用户可以立即查询到消息状态
+		return tools.CreateMsgRecord(tx, msgID, msgReq, mt, int(data.MSG_STATUS_PENDING))
+	})
+
+	// 如果持久化出错，则返回错误
+	if msgErr != nil {
+		// 幂等键生成的消息ID已存在，说明是重复请求
+		if data.IsDuplicateEntry(msgErr) {
+			log.Warnf("消息 %s 已存在，跳过重复入队", msgID)
+			return msgID, nil
+		}
+		log.Errorf("消息持久化失败: %s", msgErr.Error())
+		// 记录失败状态，使用户可以查询到该消息
+		// 携带幂等键的消息ID是固定的，留下失败记录会让调用方重试时被当作已受理而跳过入队，因此不记录
+		if msgReq.IdempotencyKey == "" {
+			if err := tools.CreateMsgRecord(dt.GetDB(), msgID, msgReq, mt, int(data.MSG_STATUS_FAILED)); err != nil {
+				log.Errorf("创建消息记录失败：%s", err.Error())
+			}
+		}
+		return msgID, fmt.Errorf("%w: %s", errPersistFailed, msgErr.Error())
+	}
+
+	metrics.MsgEnqueued.WithLabelValues(data.GetPriorityStr(data.PriorityEnum(msgReq.Priority))).Inc()
+
+	// 事务提交后立即投递，投递失败时由发件箱中继补偿
+	if outbox != nil {
+		if err := tools.PublishOutboxMsg(dt.GetDB(), outbox); err != nil {
+			log.Warnf("消息 %s 投递到MQ失败，等待发件箱中继重试: %s", msgID, err.Error())
+		}
+	}
+
+	log.Infof("消息 %s 已成功持久化", msgID)
+	return msgID, nil
+}
+
+// checkQuota 按业务配额（未配置时使用全局配额）检查消息所在渠道是否超出限频，超出时返回errQuotaExceeded
+func (p *SendMsgHandler) checkQuota(ctx context.Context, msgReq *ctrlmodel.SendMsgReq, mt *data.MsgTemplate, sourceID string) (err error) {
+	ctx, span := tracing.Start(ctx, "quota.check", attribute.String("msg.source_id", sourceID))
+	defer func() { tracing.End(span, err) }()
 	dt := data.GetData()
 
 	// 获取配额
 	var (
 		limit, div int
 		ready      bool
-		channel    int
 	)
-
-	// 确定渠道：模板模式或直接发送模式
-	if mt != nil {
-		channel = mt.Channel
-	} else if len(msgReq.Channels) > 0 {
-		channel = msgReq.Channels[0]
-	} else {
-		return "", errors.New("no channel specified")
-	}
+	channel := msgReq.Channel
 
 	// 构建配额缓存key
 	var templateSourceID string
@@ -326,7 +633,7 @@ func (p *SendMsgHandler) sendSingleMessage(msgReq *ctrlmodel.SendMsgReq, mt *dat
 		// 获取全局配额
 		globalQuota, err := data.GlobalQuotaNsp.Find(dt.GetDB(), channel)
 		if err != nil {
-			return "", err
+			return err
 		}
 		limit = globalQuota.Num
 		div = globalQuota.Unit
@@ -334,7 +641,7 @@ func (p *SendMsgHandler) sendSingleMessage(msgReq *ctrlmodel.SendMsgReq, mt *dat
 		sourceQuota, err := data.SourceQuotaNsp.Find(dt.GetDB(), sourceID, channel)
 		if err != nil {
 			if err != gorm.ErrRecordNotFound {
-				return "", err
+				return err
 			}
 		} else {
 			limit = sourceQuota.Num
@@ -359,68 +666,31 @@ func (p *SendMsgHandler) sendSingleMessage(msgReq *ctrlmodel.SendMsgReq, mt *dat
 	allowed, err := lm.IsRequestAllowed(keyID)
 	if err != nil {
 		log.Errorf("IsRequestAllowed err %s", err.Error())
-		return "", err
+		return err
 	}
 	if !allowed {
 		log.Infof("request denied for recipient %s", msgReq.To)
-		return "", errors.New("request limit exceeded")
-	}
-
-	// 定时消息
-	if msgReq.SendTimestamp > 0 {
-		return p.sendSingleToTimer(msgReq)
-	}
-
-	// 确保消息在响应前持久化
-	var msgErr error
-	var msgID string
-	if config.Conf.Common.MySQLAsMq {
-		msgID, msgErr = p.sendSingleToMySQL(msgReq)
-	} else {
-		msgID, msgErr = p.sendSingleToMQ(msgReq)
-	}
-
-	status := int(data.MSG_STATUS_PENDING)
-	if msgErr != nil {
-		status = int(data.MSG_STATUS_FAILED)
-	}
-
-	// 创建消息记录，使用户可以立即查询到消息状态
-	err = tools.CreateMsgRecord(dt.GetDB(), msgID, msgReq, mt, status)
-	if err != nil {
-		log.Errorf("创建消息记录失败：%s", err.Error())
-		// 即使创建消息记录失败，我们也已经发送了消息到MQ，继续
+		metrics.RateLimitDenied.WithLabelValues(sourceID, data.GetChannelStr(channel)).Inc()
+		return errQuotaExceeded
 	}
-
-	// 如果持久化出错，则返回错误
-	if msgErr != nil {
-		log.Errorf("消息持久化失败: %s", msgErr.Error())
-		return "", msgErr
-	}
-
-	log.Infof("消息 %s 已成功持久化", msgID)
-	return msgID, nil
+	return nil
 }
 
 // sendSingleToTimer 将单条消息发送到定时队列
-func (p *SendMsgHandler) sendSingleToTimer(msgReq *ctrlmodel.SendMsgReq) (string, error) {
+func (p *SendMsgHandler) sendSingleToTimer(ctx context.Context, msgReq *ctrlmodel.SendMsgReq) (string, error) {
 	// 获取数据实例
 	log.Infof("into sendSingleToTimer")
 	dt := data.GetData()
-	ctx := context.Background()
-
-	// 生成唯一的消息ID
-	msgID := utils.GenerateUUID()
 
-	// 将消息ID赋值给请求结构体
-	msgReq.MsgID = msgID
+	// 消息ID在sendSingleMessage中生成
+	msgID := msgReq.MsgID
 
 	// 将请求结构体转换为JSON格式
 	msgJson, err := json.Marshal(msgReq)
 	if err != nil {
 		// 记录错误日志
-		log.ErrorContextf(context.Background(), "json marshal err %s", err.Error())
-		return "", err
+		log.ErrorContextf(ctx, "json marshal err %s", err.Error())
+		return msgID, err
 	}
 
 	// 根据消息优先级选择对应的定时队列 Todo 是否处理优先级？
@@ -431,11 +701,13 @@ func (p *SendMsgHandler) sendSingleToTimer(msgReq *ctrlmodel.SendMsgReq) (string
 	// 设置消息的发送时间
 	md.SendTimestamp = msgReq.SendTimestamp
 
-	// 设置消息
+	// 设置消息和链路上下文，到期投递时继续本次请求的链路
 	md.Req = string(msgJson)
+	md.TraceContext = tracing.Marshal(ctx)
 
-	// 设置消息的ID
+	// 设置消息的ID和批次ID
 	md.MsgId = msgID
+	md.BatchID = msgReq.BatchID
 
 	// 设置消息的初始状态
 	md.Status = int(data.TIMER_MSG_STATUS_PENDING)
@@ -443,7 +715,12 @@ func (p *SendMsgHandler) sendSingleToTimer(msgReq *ctrlmodel.SendMsgReq) (string
 	// 将消息插入到MySQL数据库中
 	err = data.MsgTmpQueueTimerNsp.Create(dt.GetDB(), md)
 	if err != nil {
-		return "", err
+		// 幂等键生成的消息ID已存在，说明是重复请求
+		if data.IsDuplicateEntry(err) {
+			log.Warnf("定时消息 %s 已存在，跳过重复入队", msgID)
+			return msgID, nil
+		}
+		return msgID, err
 	}
 
 	// 存入 ZSET；
@@ -451,26 +728,24 @@ func (p *SendMsgHandler) sendSingleToTimer(msgReq *ctrlmodel.SendMsgReq) (string
 	member := fmt.Sprintf("%d", msgReq.SendTimestamp)
 	err = dt.GetCache().ZAdd(ctx, "Timer_Msgs", redis.Z{Score: timeSocre, Member: member})
 	if err != nil {
-		return "", err
+		return msgID, err
 	}
 
 	// 返回消息ID，表示发送成功
 	return msgID, nil
 }
 
-// sendSingleToMySQL 将单条消息发送到MySQL数据库
-func (p *SendMsgHandler) sendSingleToMySQL(msgReq *ctrlmodel.SendMsgReq) (string, error) {
-	// 获取数据实例
-	dt := data.GetData()
-
-	// 生成唯一的消息ID
-	msgID := utils.GenerateUUID()
+// sendSingleToMySQL 将单条消息写入MySQL消息队列表，db为调用方的事务
+func (p *SendMsgHandler) sendSingleToMySQL(ctx context.Context, db *gorm.DB, msgReq *ctrlmodel.SendMsgReq) error {
+	// 消息ID在sendSingleMessage中生成
+	msgID := msgReq.MsgID
 
 	// 创建一个新的消息队列实例
 	var md = new(data.MsgQueue)
 
 	// 设置消息的主题
 	md.Subject = msgReq.Subject
+	md.BatchID = msgReq.BatchID
 
 	// 设置消息的模板ID
 	md.TemplateID = msgReq.TemplateID
@@ -478,17 +753,22 @@ func (p *SendMsgHandler) sendSingleToMySQL(msgReq *ctrlmodel.SendMsgReq) (string
 	// 将模板数据转换为JSON格式
 	td, err := json.Marshal(msgReq.TemplateData)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	// 设置消息的模板数据
 	md.TemplateData = string(td)
 
-	// 设置消息的接收者
+	// 设置消息的接收者、渠道和内容
 	md.To = msgReq.To
+	md.Channel = msgReq.Channel
+	md.Content = msgReq.Content
+	md.Fallback = msgReq.FallbackState
+	md.ExpireAt = msgReq.ExpireAt
 
-	// 设置消息的ID
+	// 设置消息的ID和链路上下文
 	md.MsgId = msgID
+	md.TraceContext = tracing.Marshal(ctx)
 
 	// 设置消息的初始状态为待处理状态
 	// 消息状态流转: PENDING -> PROCESSING -> SUCC
@@ -504,52 +784,32 @@ func (p *SendMsgHandler) sendSingleToMySQL(msgReq *ctrlmodel.SendMsgReq) (string
 	priorityStr := data.GetPriorityStr(data.PriorityEnum(msgReq.Priority))
 
 	// 将消息插入到MySQL数据库中
-	err = data.MsgQueueNsp.Create(dt.GetDB(), priorityStr, md)
-	if err != nil {
-		return "", err
-	}
-
-	// 返回消息ID，表示发送成功
-	return msgID, nil
+	return data.MsgQueueNsp.Create(db, priorityStr, md)
 }
 
-// sendSingleToMQ 将单条消息发送到消息队列
-func (p *SendMsgHandler) sendSingleToMQ(msgReq *ctrlmodel.SendMsgReq) (string, error) {
-	// 获取数据实例
-	log.Infof("into sendSingleToMQ")
-	dt := data.GetData()
-
-	// 生成唯一的消息ID
-	msgID := utils.GenerateUUID()
-
-	// 将消息ID赋值给请求结构体
-	msgReq.MsgID = msgID
-
+// sendSingleToOutbox 将单条消息写入发件箱，db为调用方的事务
+func (p *SendMsgHandler) sendSingleToOutbox(ctx context.Context, db *gorm.DB, msgReq *ctrlmodel.SendMsgReq) (*data.MsgOutbox, error) {
 	// 将请求结构体转换为JSON格式
 	msgJson, err := json.Marshal(msgReq)
 	if err != nil {
 		// 记录错误日志
-		log.ErrorContextf(context.Background(), "json marshal err %s", err.Error())
-		return "", err
+		log.ErrorContextf(ctx, "json marshal err %s", err.Error())
+		return nil, err
 	}
 
 	// 消息队列处理流程：
-	// 1. 消息发送到MQ并持久化
-	// 2. 消费者从MQ获取消息并处理
-	// 3. 处理成功后，消费者会更新MySQL中的消息状态为成功
-
-	var sendErr error
-
-	// 根据消息优先级选择对应的消息队列生产者
-	producer := dt.GetProducer(data.PriorityEnum(msgReq.Priority))
-	sendErr = producer.SendMessage("", msgJson)
-	if sendErr != nil {
-		log.ErrorContextf(context.Background(), "发送消息到MQ失败: %s", sendErr.Error())
-		return "", sendErr
-	}
-
-	log.Infof("消息 %s 已发送到%s优先级队列", msgID, data.GetPriorityStr(data.PriorityEnum(msgReq.Priority)))
-
-	// 返回消息ID，表示发送成功
-	return msgID, nil
+	// 1. 消息与消息记录在同一个事务中写入发件箱
+	// 2. 事务提交后投递到对应优先级的MQ，失败时由发件箱中继重试
+	// 3. 消费者从MQ获取消息并处理，处理成功后更新MySQL中的消息状态为成功
+	var outbox = &data.MsgOutbox{
+		MsgId:        msgReq.MsgID,
+		Priority:     msgReq.Priority,
+		Payload:      string(msgJson),
+		TraceContext: tracing.Marshal(ctx),
+		Status:       int(data.OUTBOX_STATUS_PENDING),
+	}
+	if err = data.MsgOutboxNsp.Create(db, outbox); err != nil {
+		return nil, err
+	}
+	return outbox, nil
 }
@@ -0,0 +1,96 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/utils"
+)
+
+const (
+	// idempotencyProcessing 请求处理中的占位值
+	idempotencyProcessing = "processing"
+	// idempotencyLockSeconds 处理中占位的过期时间，防止节点崩溃后幂等键一直不可用
+	idempotencyLockSeconds = 60
+)
+
+// idempotencyCacheKey 幂等键的缓存key，按Source-Id隔离
+func idempotencyCacheKey(sourceID, key string) string {
+	return fmt.Sprintf("%s%s_%s", data.REDIS_KEY_IDEMPOTENCY, sourceID, key)
+}
+
+// acquireIdempotency 占用幂等键
+// 如果该幂等键已经处理完成，则把原响应写回p.Resp并返回replayed=true
+func (p *SendMsgHandler) acquireIdempotency(ctx context.Context, sourceID string) (replayed bool, err error) {
+	cache := data.GetData().GetCache()
+	cacheKey := idempotencyCacheKey(sourceID, p.Req.IdempotencyKey)
+
+	ok, err := cache.SetNX(ctx, cacheKey, idempotencyProcessing, idempotencyLockSeconds*time.Second)
+	if err != nil {
+		log.Errorf("idempotency setnx %s err %s", cacheKey, err.Error())
+		p.Resp.Code = constant.ERR_INTERNAL
+		return false, err
+	}
+	if ok {
+		return false, nil
+	}
+
+	value, _, err := cache.Get(ctx, cacheKey)
+	if err != nil {
+		log.Errorf("idempotency get %s err %s", cacheKey, err.Error())
+		p.Resp.Code = constant.ERR_INTERNAL
+		return false, err
+	}
+	if value == idempotencyProcessing {
+		p.Resp.Code = constant.ERR_IDEMPOTENCY_CONFLICT
+		return false, fmt.Errorf("idempotency key %s is being processed", p.Req.IdempotencyKey)
+	}
+
+	if err := json.Unmarshal([]byte(value), &p.Resp); err != nil {
+		log.Errorf("idempotency unmarshal %s err %s", cacheKey, err.Error())
+		p.Resp.Code = constant.ERR_INTERNAL
+		return false, err
+	}
+	log.Infof("idempotency key %s replayed, batch %s", p.Req.IdempotencyKey, p.Resp.BatchID)
+	return true, nil
+}
+
+// releaseIdempotency 保存处理结果
+// 有消息被受理时保存响应供重放；全部失败时删除幂等键，允许调用方重试
+func (p *SendMsgHandler) releaseIdempotency(ctx context.Context, sourceID string) {
+	cache := data.GetData().GetCache()
+	cacheKey := idempotencyCacheKey(sourceID, p.Req.IdempotencyKey)
+
+	if p.Resp.Accepted == 0 {
+		if err := cache.Del(ctx, cacheKey); err != nil {
+			log.Errorf("idempotency del %s err %s", cacheKey, err.Error())
+		}
+		return
+	}
+
+	value, err := json.Marshal(p.Resp)
+	if err != nil {
+		log.Errorf("idempotency marshal resp err %s", err.Error())
+		return
+	}
+	window := time.Duration(config.Conf.Common.IdempotencyWindow) * time.Second
+	if err := cache.Set(ctx, cacheKey, string(value), window); err != nil {
+		log.Errorf("idempotency set %s err %s", cacheKey, err.Error())
+	}
+}
+
+// genMsgID 生成消息ID
+// 携带幂等键时根据来源、幂等键、接收者和渠道生成确定性ID，
+// 即使缓存丢失，重复请求也会在队列表和记录表的唯一键上冲突，而不会重复入队
+func genMsgID(sourceID, idempotencyKey, to string, channel int) string {
+	if idempotencyKey == "" {
+		return utils.GenerateUUID()
+	}
+	return utils.GenerateNameUUID(fmt.Sprintf("%s:%s:%s:%d", sourceID, idempotencyKey, to, channel))
+}
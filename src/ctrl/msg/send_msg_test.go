@@ -0,0 +1,80 @@
+package msg
+
+import (
+	"testing"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+)
+
+func TestMatchChannel(t *testing.T) {
+	cases := []struct {
+		to      string
+		channel data.ChannelEnum
+		want    bool
+	}{
+		{"zhangsan@example.com", data.Channel_EMAIL, true},
+		{"zhangsan@example.com", data.Channel_SMS, false},
+		{"zhangsan@example.com", data.Channel_LARK, false},
+		{"13800138001", data.Channel_SMS, true},
+		{"+8613800138001", data.Channel_SMS, true},
+		{"13800138001", data.Channel_EMAIL, false},
+		{"lark_zhangsan", data.Channel_LARK, true},
+		{"lark_zhangsan", data.Channel_SMS, false},
+	}
+	for _, c := range cases {
+		if got := matchChannel(c.to, int(c.channel)); got != c.want {
+			t.Errorf("matchChannel(%q, %d) = %v, want %v", c.to, c.channel, got, c.want)
+		}
+	}
+}
+
+func TestDeduplicateRecipients(t *testing.T) {
+	var p SendMsgHandler
+	recipients := []*recipient{
+		{UserID: "user_001", To: "zhangsan@example.com", Channel: 1},
+		{UserID: "user_001", To: "13800138001", Channel: 2},
+		{To: "zhangsan@example.com", Channel: 1},
+		{UserID: "user_002", Channel: 2, Reason: ctrlmodel.REJECT_REASON_NO_CONTACT},
+		{UserID: "user_002", Channel: 2, Reason: ctrlmodel.REJECT_REASON_NO_CONTACT},
+		{UserID: "user_002", Channel: 3, Reason: ctrlmodel.REJECT_REASON_NO_CONTACT},
+	}
+	got := p.deduplicateRecipients(recipients)
+	if len(got) != 4 {
+		t.Fatalf("deduplicateRecipients returned %d recipients, want 4", len(got))
+	}
+}
+
+func TestApplyFallback(t *testing.T) {
+	p := SendMsgHandler{fallback: &data.FallbackPolicy{
+		Channels:  []int{int(data.Channel_LARK), int(data.Channel_SMS), int(data.Channel_EMAIL)},
+		Timeout:   300,
+		Templates: map[int]string{int(data.Channel_SMS): "sms_tpl"},
+	}}
+	contacts := map[int]string{
+		int(data.Channel_SMS):   "13800138001",
+		int(data.Channel_EMAIL): "zhangsan@example.com",
+	}
+	resolve := func(channel int) string { return contacts[channel] }
+
+	// 主渠道可用：降级目标跳过主渠道和没有联系方式的渠道
+	rcpt := &recipient{To: "zhangsan@example.com", Channel: int(data.Channel_EMAIL)}
+	p.applyFallback(rcpt, resolve)
+	if rcpt.Fallback == nil || len(rcpt.Fallback.Targets) != 1 ||
+		rcpt.Fallback.Targets[0].Channel != int(data.Channel_SMS) || rcpt.Fallback.Timeout != 300 ||
+		rcpt.Fallback.Targets[0].TemplateID != "sms_tpl" {
+		t.Fatalf("unexpected fallback state %+v", rcpt.Fallback)
+	}
+
+	// 主渠道没有联系方式：从第一个可用的降级渠道开始投递
+	rcpt = &recipient{Channel: int(data.Channel_LARK), Reason: ctrlmodel.REJECT_REASON_NO_CONTACT}
+	p.applyFallback(rcpt, resolve)
+	if rcpt.Reason != "" || rcpt.Channel != int(data.Channel_SMS) || rcpt.To != "13800138001" ||
+		rcpt.TemplateID != "sms_tpl" {
+		t.Fatalf("recipient not promoted to fallback channel: %+v", rcpt)
+	}
+	if rcpt.Fallback == nil || len(rcpt.Fallback.Targets) != 1 ||
+		rcpt.Fallback.Targets[0].Channel != int(data.Channel_EMAIL) || rcpt.Fallback.Targets[0].TemplateID != "" {
+		t.Fatalf("unexpected fallback state %+v", rcpt.Fallback)
+	}
+}
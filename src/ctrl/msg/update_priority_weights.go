@@ -0,0 +1,120 @@
+package msg
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// MAX_PRIORITY_MIN_SHARE 保底份额的上限，四个优先级的保底之和不超过全部发送协程
+const MAX_PRIORITY_MIN_SHARE = 0.25
+
+// UpdatePriorityWeightsHandler 调整优先级调度权重处理handler
+type UpdatePriorityWeightsHandler struct {
+	Req    ctrlmodel.UpdatePriorityWeightsReq
+	Resp   ctrlmodel.UpdatePriorityWeightsResp
+	UserId string
+	ctx    *gin.Context
+}
+
+// UpdatePriorityWeights 调整MySQL队列的优先级调度权重，所有节点的调度器在几秒内生效
+func UpdatePriorityWeights(c *gin.Context) {
+	hd := UpdatePriorityWeightsHandler{ctx: c}
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求包
+	if err := c.ShouldBind(&hd.Req); err != nil {
+		log.Errorf("UpdatePriorityWeights shouldBind err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("UpdatePriorityWeights handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查，只能调整参与调度的四个优先级，权重不能为负数
+func (p *UpdatePriorityWeightsHandler) HandleInput() error {
+	if len(p.Req.Weights) == 0 && p.Req.MinShare == nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	for name, weight := range p.Req.Weights {
+		if !isConsumePriority(name) || weight < 0 {
+			log.Errorf("优先级调度权重无效: %s=%d", name, weight)
+			p.Resp.Code = constant.ERR_INPUT_INVALID
+			return constant.ERR_HANDLE_INPUT
+		}
+	}
+	if p.Req.MinShare != nil && (*p.Req.MinShare < 0 || *p.Req.MinShare > MAX_PRIORITY_MIN_SHARE) {
+		log.Errorf("优先级保底份额无效: %v", *p.Req.MinShare)
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+	return nil
+}
+
+// isConsumePriority 是否为参与调度的优先级
+func isConsumePriority(name string) bool {
+	for _, priority := range []data.PriorityEnum{data.PRIORITY_HIGH, data.PRIORITY_MIDDLE,
+		data.PRIORITY_LOW, data.PRIORITY_RETRY} {
+		if data.GetPriorityStr(priority) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleProcess 处理函数，在当前权重上修改指定的部分
+func (p *UpdatePriorityWeightsHandler) HandleProcess() error {
+	log.Infof("into UpdatePriorityWeights HandleProcess")
+	dt := data.GetData()
+	weights, err := dt.GetPriorityWeights(p.ctx)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+	if weights.Weights == nil {
+		weights.Weights = make(map[string]int)
+	}
+	for name, weight := range p.Req.Weights {
+		weights.Weights[name] = weight
+	}
+	if p.Req.MinShare != nil {
+		weights.MinShare = *p.Req.MinShare
+	}
+
+	// 权重全为0时没有优先级能分到发送协程
+	total := 0
+	for _, weight := range weights.Weights {
+		total += weight
+	}
+	if total == 0 {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return constant.ERR_HANDLE_INPUT
+	}
+
+	if err := dt.SetPriorityWeights(p.ctx, weights); err != nil {
+		p.Resp.Code = constant.ERR_UPDATE
+		return err
+	}
+	p.Resp.PriorityWeights = weights
+	log.Infof("优先级调度权重已调整为 %v，保底份额 %v", weights.Weights, weights.MinShare)
+	return nil
+}
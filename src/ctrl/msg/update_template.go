@@ -69,6 +69,13 @@ func (p *UpdateTemplateHandler) HandleProcess() error {
 	if p.Req.SourceID != "" {
 		mt.SourceID = p.Req.SourceID
 	}
+	if p.Req.Fallback != nil {
+		mt.Fallback = p.Req.Fallback
+	}
+	if err := checkFallbackTemplates(dt.GetDB(), mt.Fallback, mt); err != nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return err
+	}
 	err = data.MsgTemplateNsp.Save(dt.GetDB(), mt)
 	if err != nil {
 		return err
@@ -33,10 +33,11 @@ func CreateClient() (_result *dysmsapi20170525.Client, _err error) {
 	return _result, _err
 }
 
-func SendSMS(to string, signName string, templateCode string, templateParam string) (_err error) {
+// SendSMS 发送短信，返回阿里云的发送回执ID(BizId)
+func SendSMS(to string, signName string, templateCode string, templateParam string) (_bizID string, _err error) {
 	client, _err := CreateClient()
 	if _err != nil {
-		return _err
+		return "", NewSendError(ERR_CATEGORY_AUTH, "client_init_failed", _err)
 	}
 
 	sendSmsRequest := &dysmsapi20170525.SendSmsRequest{}
@@ -52,10 +53,18 @@ func SendSMS(to string, signName string, templateCode string, templateParam stri
 			}
 		}()
 		// 复制代码运行请自行打印 API 的返回值
-		_, _err = client.SendSmsWithOptions(sendSmsRequest, runtime)
+		var resp *dysmsapi20170525.SendSmsResponse
+		resp, _err = client.SendSmsWithOptions(sendSmsRequest, runtime)
 		if _err != nil {
 			return _err
 		}
+		// 业务错误（手机号无效、限流等）以HTTP 200返回，需要检查返回码
+		if resp.Body != nil && tea.StringValue(resp.Body.Code) != "OK" {
+			return &tea.SDKError{Code: resp.Body.Code, Message: resp.Body.Message}
+		}
+		if resp.Body != nil {
+			_bizID = tea.StringValue(resp.Body.BizId)
+		}
 
 		return nil
 	}()
@@ -80,8 +89,9 @@ func SendSMS(to string, signName string, templateCode string, templateParam stri
 		}
 		_, _err = util.AssertAsString(error.Message)
 		if _err != nil {
-			return _err
+			return "", _err
 		}
+		return "", classifyAliSMSError(tea.StringValue(error.Code), tryErr)
 	}
-	return _err
+	return _bizID, _err
 }
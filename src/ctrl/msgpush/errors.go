@@ -0,0 +1,159 @@
+package msgpush
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// 投递错误分类
+const (
+	ERR_CATEGORY_TRANSIENT    = "transient"    // 临时错误（网络异常、服务端5xx等），按退避重试
+	ERR_CATEGORY_PERMANENT    = "permanent"    // 永久错误（地址无效、用户不存在、参数错误等），重试无意义，直接失败
+	ERR_CATEGORY_RATE_LIMITED = "rate_limited" // 渠道供应商限流，按退避上限等待后重试
+	ERR_CATEGORY_AUTH         = "auth"         // 鉴权或账号问题（密钥错误、余额不足等），需要人工处理，按退避重试
+)
+
+// SendError 带分类的投递错误
+type SendError struct {
+	Category string // 错误分类
+	Code     string // 原因码，渠道供应商的错误码或本地归类的原因
+	Err      error
+}
+
+// NewSendError 创建带分类的投递错误
+func NewSendError(category, code string, err error) *SendError {
+	return &SendError{Category: category, Code: code, Err: err}
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("[%s/%s] %v", e.Category, e.Code, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError 获取投递错误的分类和原因码，未分类的错误按临时错误处理
+func ClassifyError(err error) (category, code string) {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Category, sendErr.Code
+	}
+	return ERR_CATEGORY_TRANSIENT, ""
+}
+
+// classifySMTPError 按SMTP响应码对邮件发送错误分类
+// 5xx为永久错误，4xx为临时错误，鉴权失败单独归类；没有响应码的错误（网络异常等）按临时错误处理
+func classifySMTPError(err error) error {
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return NewSendError(ERR_CATEGORY_TRANSIENT, "", err)
+	}
+	code := strconv.Itoa(tpErr.Code)
+	msg := strings.ToLower(tpErr.Msg)
+	switch {
+	case tpErr.Code == 454 || tpErr.Code == 530 || tpErr.Code == 534 || tpErr.Code == 535:
+		return NewSendError(ERR_CATEGORY_AUTH, code, err)
+	case strings.Contains(msg, "frequency") || strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many"):
+		return NewSendError(ERR_CATEGORY_RATE_LIMITED, code, err)
+	case tpErr.Code >= 500:
+		return NewSendError(ERR_CATEGORY_PERMANENT, code, err)
+	default:
+		return NewSendError(ERR_CATEGORY_TRANSIENT, code, err)
+	}
+}
+
+// aliSMSErrCategory 阿里云短信错误码分类，未列出的错误码按临时错误处理
+// 错误码参考 https://help.aliyun.com/document_detail/101346.html
+var aliSMSErrCategory = map[string]string{
+	"isv.MOBILE_NUMBER_ILLEGAL":       ERR_CATEGORY_PERMANENT,
+	"isv.MOBILE_COUNT_OVER_LIMIT":     ERR_CATEGORY_PERMANENT,
+	"isv.INVALID_PARAMETERS":          ERR_CATEGORY_PERMANENT,
+	"isv.INVALID_JSON_PARAM":          ERR_CATEGORY_PERMANENT,
+	"isv.TEMPLATE_MISSING_PARAMETERS": ERR_CATEGORY_PERMANENT,
+	"isv.TEMPLATE_PARAMS_ILLEGAL":     ERR_CATEGORY_PERMANENT,
+	"isv.SMS_TEMPLATE_ILLEGAL":        ERR_CATEGORY_PERMANENT,
+	"isv.SMS_SIGNATURE_ILLEGAL":       ERR_CATEGORY_PERMANENT,
+	"isv.PARAM_LENGTH_LIMIT":          ERR_CATEGORY_PERMANENT,
+	"isv.PARAM_NOT_SUPPORT_URL":       ERR_CATEGORY_PERMANENT,
+	"isv.BLACK_KEY_CONTROL_LIMIT":     ERR_CATEGORY_PERMANENT,
+	"isv.BUSINESS_LIMIT_CONTROL":      ERR_CATEGORY_RATE_LIMITED,
+	"isv.DAY_LIMIT_CONTROL":           ERR_CATEGORY_RATE_LIMITED,
+	"Throttling.User":                 ERR_CATEGORY_RATE_LIMITED,
+	"Throttling":                      ERR_CATEGORY_RATE_LIMITED,
+	"isv.ACCOUNT_NOT_EXISTS":          ERR_CATEGORY_AUTH,
+	"isv.ACCOUNT_ABNORMAL":            ERR_CATEGORY_AUTH,
+	"isv.AMOUNT_NOT_ENOUGH":           ERR_CATEGORY_AUTH,
+	"isv.OUT_OF_SERVICE":              ERR_CATEGORY_AUTH,
+	"isp.RAM_PERMISSION_DENY":         ERR_CATEGORY_AUTH,
+	"InvalidAccessKeyId.NotFound":     ERR_CATEGORY_AUTH,
+	"SignatureDoesNotMatch":           ERR_CATEGORY_AUTH,
+}
+
+// classifyAliSMSError 按阿里云错误码对短信发送错误分类
+func classifyAliSMSError(code string, err error) error {
+	category, ok := aliSMSErrCategory[code]
+	if !ok {
+		category = ERR_CATEGORY_TRANSIENT
+	}
+	return NewSendError(category, code, err)
+}
+
+// larkErrCategory 飞书开放平台错误码分类，未列出的错误码按HTTP状态码归类
+var larkErrCategory = map[int]string{
+	10003:    ERR_CATEGORY_AUTH,         // app_id无效
+	10014:    ERR_CATEGORY_AUTH,         // app_secret无效
+	99991661: ERR_CATEGORY_AUTH,         // 缺少access_token
+	99991663: ERR_CATEGORY_AUTH,         // tenant_access_token无效
+	99991672: ERR_CATEGORY_AUTH,         // 应用未开通接口权限
+	230006:   ERR_CATEGORY_AUTH,         // 应用未启用机器人能力
+	99991400: ERR_CATEGORY_RATE_LIMITED, // 请求频率超限
+	230020:   ERR_CATEGORY_RATE_LIMITED, // 消息发送频率超限
+	230001:   ERR_CATEGORY_PERMANENT,    // 请求参数无效
+	230002:   ERR_CATEGORY_PERMANENT,    // 机器人不在群组中
+	230013:   ERR_CATEGORY_PERMANENT,    // 机器人对该用户不可用
+	99992351: ERR_CATEGORY_PERMANENT,    // 用户ID不存在
+	99992402: ERR_CATEGORY_PERMANENT,    // 字段校验失败
+}
+
+// larkMessageID 获取飞书发送消息接口返回的消息ID
+func larkMessageID(result map[string]interface{}) string {
+	data, _ := result["data"].(map[string]interface{})
+	messageID, _ := data["message_id"].(string)
+	return messageID
+}
+
+// larkError 将飞书接口的返回转换为带分类的投递错误，调用成功时返回nil
+func larkError(statusCode int, result map[string]interface{}, action string) error {
+	code, ok := result["code"].(float64)
+	if ok && code == 0 {
+		return nil
+	}
+	if !ok && statusCode < 400 {
+		return nil
+	}
+
+	err := fmt.Errorf("%s: %v", action, result["msg"])
+	codeStr := strconv.Itoa(statusCode)
+	category := ""
+	if ok {
+		codeStr = strconv.Itoa(int(code))
+		category = larkErrCategory[int(code)]
+	}
+	if category == "" {
+		switch {
+		case statusCode == 429:
+			category = ERR_CATEGORY_RATE_LIMITED
+		case statusCode == 401 || statusCode == 403:
+			category = ERR_CATEGORY_AUTH
+		case statusCode >= 400 && statusCode < 500:
+			category = ERR_CATEGORY_PERMANENT
+		default:
+			category = ERR_CATEGORY_TRANSIENT
+		}
+	}
+	return NewSendError(category, codeStr, err)
+}
@@ -2,7 +2,12 @@ package msgpush
 
 import (
 	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net/mail"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lvdashuaibi/MsgPushSystem/src/config"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
@@ -21,8 +26,13 @@ var (
 	d    *gomail.Dialer
 )
 
-// 发送给谁
-func SendEmail(to string, subject string, text string) error {
+// SendEmail 发送邮件，返回邮件的Message-ID，可用于在邮件服务器日志中追踪投递情况
+func SendEmail(to string, subject string, text string) (string, error) {
+	// 收件地址无效时重试没有意义
+	if _, err := mail.ParseAddress(to); err != nil {
+		return "", NewSendError(ERR_CATEGORY_PERMANENT, "invalid_address", err)
+	}
+
 	once.Do(func() {
 		log.Infof("初始化邮件发送器，账号: %s", config.Conf.Common.EmailAccount)
 		d = gomail.NewDialer(emailHost, port, config.Conf.Common.EmailAccount, config.Conf.Common.EmailAuthCode)
@@ -39,6 +49,9 @@ func SendEmail(to string, subject string, text string) error {
 	m.SetHeader("To", to)
 	// 设置主题
 	m.SetHeader("Subject", subject)
+	// 设置Message-ID
+	messageID := genMessageID(config.Conf.Common.EmailAccount)
+	m.SetHeader("Message-ID", messageID)
 
 	// 检查内容是否包含HTML标签，如果包含则使用HTML格式
 	if len(text) > 0 && (text[0] == '<' || text[len(text)-1] == '>') {
@@ -53,8 +66,17 @@ func SendEmail(to string, subject string, text string) error {
 	log.Infof("开始发送邮件，发送者: %s，接收者: %s，主题: %s", config.Conf.Common.EmailAccount, to, subject)
 	if err := d.DialAndSend(m); err != nil {
 		log.Errorf("发送邮件失败，发送者: %s，接收者: %s，错误: %s", config.Conf.Common.EmailAccount, to, err.Error())
-		return err
+		return "", classifySMTPError(err)
+	}
+	log.Infof("发送邮件成功，发送者: %s，接收者: %s，Message-ID: %s", config.Conf.Common.EmailAccount, to, messageID)
+	return messageID, nil
+}
+
+// genMessageID 生成邮件的Message-ID，域名取发件账号的域名
+func genMessageID(account string) string {
+	domain := emailHost
+	if i := strings.LastIndex(account, "@"); i >= 0 && i < len(account)-1 {
+		domain = account[i+1:]
 	}
-	log.Infof("发送邮件成功，发送者: %s，接收者: %s", config.Conf.Common.EmailAccount, to)
-	return nil
+	return fmt.Sprintf("<%d.%d@%s>", time.Now().UnixNano(), rand.Int63(), domain)
 }
@@ -19,7 +19,8 @@ func GetAccessToken() (string, error) {
 
 	// 检查配置是否为空
 	if appID == "" || appSecret == "" {
-		return "", fmt.Errorf("飞书应用配置未设置，请在配置文件中设置 lark_app_id 和 lark_app_secret")
+		return "", NewSendError(ERR_CATEGORY_AUTH, "config_missing",
+			fmt.Errorf("飞书应用配置未设置，请在配置文件中设置 lark_app_id 和 lark_app_secret"))
 	}
 
 	body := map[string]string{
@@ -38,8 +39,8 @@ func GetAccessToken() (string, error) {
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
-	if result["code"].(float64) != 0 {
-		return "", fmt.Errorf("failed to get access token: %v", result["msg"])
+	if err := larkError(resp.StatusCode, result, "failed to get access token"); err != nil {
+		return "", err
 	}
 
 	return result["tenant_access_token"].(string), nil
@@ -47,11 +48,12 @@ func GetAccessToken() (string, error) {
 
 // SendMessage 发送普通文本消息（兼容旧接口）
 func SendMessage(accessToken, to, content string) error {
-	return SendTextMessage(accessToken, to, content)
+	_, err := SendTextMessage(accessToken, to, content)
+	return err
 }
 
-// SendTextMessage 发送普通文本消息
-func SendTextMessage(accessToken, to, content string) error {
+// SendTextMessage 发送普通文本消息，返回飞书的消息ID
+func SendTextMessage(accessToken, to, content string) (string, error) {
 	url := "https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=user_id"
 
 	body := map[string]interface{}{
@@ -68,7 +70,7 @@ func SendTextMessage(accessToken, to, content string) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -76,12 +78,12 @@ func SendTextMessage(accessToken, to, content string) error {
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
-	if code, ok := result["code"].(float64); ok && code != 0 {
-		return fmt.Errorf("发送消息失败: %v", result["msg"])
+	if err := larkError(resp.StatusCode, result, "发送消息失败"); err != nil {
+		return "", err
 	}
 
 	fmt.Println("飞书消息发送成功:", string(respBody))
-	return nil
+	return larkMessageID(result), nil
 }
 
 // SendRichTextMessage 发送富文本消息
@@ -126,8 +128,8 @@ func SendRichTextMessage(accessToken, to, title, content string) error {
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
-	if code, ok := result["code"].(float64); ok && code != 0 {
-		return fmt.Errorf("发送富文本消息失败: %v", result["msg"])
+	if err := larkError(resp.StatusCode, result, "发送富文本消息失败"); err != nil {
+		return err
 	}
 
 	fmt.Println("飞书富文本消息发送成功:", string(respBody))
@@ -210,22 +212,22 @@ func SendCardMessage(accessToken, to, title, content string, fields map[string]s
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
-	if code, ok := result["code"].(float64); ok && code != 0 {
-		return fmt.Errorf("发送卡片消息失败: %v", result["msg"])
+	if err := larkError(resp.StatusCode, result, "发送卡片消息失败"); err != nil {
+		return err
 	}
 
 	fmt.Println("飞书卡片消息发送成功:", string(respBody))
 	return nil
 }
 
-// SendCardMessageFromJSON 直接使用JSON字符串发送卡片消息（用于AI生成的卡片）
-func SendCardMessageFromJSON(accessToken, to, cardJSON string) error {
+// SendCardMessageFromJSON 直接使用JSON字符串发送卡片消息（用于AI生成的卡片），返回飞书的消息ID
+func SendCardMessageFromJSON(accessToken, to, cardJSON string) (string, error) {
 	url := "https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=user_id"
 
 	// 验证JSON格式
 	var cardContent map[string]interface{}
 	if err := json.Unmarshal([]byte(cardJSON), &cardContent); err != nil {
-		return fmt.Errorf("无效的卡片JSON格式: %v", err)
+		return "", NewSendError(ERR_CATEGORY_PERMANENT, "invalid_card_json", fmt.Errorf("无效的卡片JSON格式: %v", err))
 	}
 
 	body := map[string]interface{}{
@@ -242,7 +244,7 @@ func SendCardMessageFromJSON(accessToken, to, cardJSON string) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -250,12 +252,12 @@ func SendCardMessageFromJSON(accessToken, to, cardJSON string) error {
 	var result map[string]interface{}
 	json.Unmarshal(respBody, &result)
 
-	if code, ok := result["code"].(float64); ok && code != 0 {
-		return fmt.Errorf("发送AI卡片消息失败: %v", result["msg"])
+	if err := larkError(resp.StatusCode, result, "发送AI卡片消息失败"); err != nil {
+		return "", err
 	}
 
 	fmt.Println("飞书AI卡片消息发送成功:", string(respBody))
-	return nil
+	return larkMessageID(result), nil
 }
 
 // 根据手机号获取用户 OpenID
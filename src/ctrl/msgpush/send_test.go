@@ -1,7 +1,9 @@
 package msgpush
 
 import (
+	"errors"
 	"fmt"
+	"net/textproto"
 	"testing"
 )
 
@@ -36,3 +38,34 @@ func TestSendLark(t *testing.T) {
 	}
 	return
 }
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err          error
+		wantCategory string
+		wantCode     string
+	}{
+		{errors.New("connection reset"), ERR_CATEGORY_TRANSIENT, ""},
+		{fmt.Errorf("wrapped: %w", NewSendError(ERR_CATEGORY_PERMANENT, "invalid_address", errors.New("bad"))), ERR_CATEGORY_PERMANENT, "invalid_address"},
+		{classifySMTPError(&textproto.Error{Code: 550, Msg: "Mailbox not found"}), ERR_CATEGORY_PERMANENT, "550"},
+		{classifySMTPError(&textproto.Error{Code: 451, Msg: "Temporary local problem"}), ERR_CATEGORY_TRANSIENT, "451"},
+		{classifySMTPError(&textproto.Error{Code: 535, Msg: "Authentication failed"}), ERR_CATEGORY_AUTH, "535"},
+		{classifySMTPError(&textproto.Error{Code: 421, Msg: "Connection frequency limited"}), ERR_CATEGORY_RATE_LIMITED, "421"},
+		{classifyAliSMSError("isv.MOBILE_NUMBER_ILLEGAL", errors.New("illegal")), ERR_CATEGORY_PERMANENT, "isv.MOBILE_NUMBER_ILLEGAL"},
+		{classifyAliSMSError("isv.BUSINESS_LIMIT_CONTROL", errors.New("limit")), ERR_CATEGORY_RATE_LIMITED, "isv.BUSINESS_LIMIT_CONTROL"},
+		{classifyAliSMSError("isp.SYSTEM_ERROR", errors.New("system")), ERR_CATEGORY_TRANSIENT, "isp.SYSTEM_ERROR"},
+		{larkError(400, map[string]interface{}{"code": float64(99991663), "msg": "invalid token"}, "发送消息失败"), ERR_CATEGORY_AUTH, "99991663"},
+		{larkError(400, map[string]interface{}{"code": float64(230013), "msg": "no availability"}, "发送消息失败"), ERR_CATEGORY_PERMANENT, "230013"},
+		{larkError(429, map[string]interface{}{}, "发送消息失败"), ERR_CATEGORY_RATE_LIMITED, "429"},
+		{larkError(502, map[string]interface{}{}, "发送消息失败"), ERR_CATEGORY_TRANSIENT, "502"},
+	}
+	for _, c := range cases {
+		category, code := ClassifyError(c.err)
+		if category != c.wantCategory || code != c.wantCode {
+			t.Errorf("ClassifyError(%v) = (%s, %s), want (%s, %s)", c.err, category, code, c.wantCategory, c.wantCode)
+		}
+	}
+	if err := larkError(200, map[string]interface{}{"code": float64(0)}, "发送消息失败"); err != nil {
+		t.Errorf("larkError for success response = %v, want nil", err)
+	}
+}
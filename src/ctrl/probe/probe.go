@@ -0,0 +1,96 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// READY_CHECK_TIMEOUT 单次就绪检查中每个依赖的超时时间
+const READY_CHECK_TIMEOUT = 2 * time.Second
+
+// Healthz 存活检查，进程能处理请求即返回成功，不检查依赖，避免依赖故障时进程被反复重启
+func Healthz(c *gin.Context) {
+	resp := ctrlmodel.HealthzResp{Status: ctrlmodel.HEALTH_CHECK_OK}
+	resp.Msg = constant.GetErrMsg(resp.Code)
+	c.JSON(http.StatusOK, resp)
+}
+
+// Readyz 就绪检查，MySQL、Redis、Kafka（MySQL作为消息队列时跳过）都可用且进程不在优雅退出中时返回200，否则返回503
+// 同时返回后台工作者的运行情况和本节点持有的主节点锁，便于排查
+func Readyz(c *gin.Context) {
+	var resp ctrlmodel.ReadyzResp
+	resp.ShuttingDown = health.ShuttingDown()
+	resp.Checks = checkDependencies(c.Request.Context())
+	resp.Workers = health.Workers()
+	resp.LeaderLocks = health.LeaderLocks()
+
+	resp.Ready = !resp.ShuttingDown
+	for name, check := range resp.Checks {
+		if check.Status == ctrlmodel.HEALTH_CHECK_FAILED {
+			log.Warnf("就绪检查失败，%s不可用: %s", name, check.Error)
+			resp.Ready = false
+		}
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+		resp.Code = constant.ERR_SERVICE_NOT_READY
+	}
+	resp.Msg = constant.GetErrMsg(resp.Code)
+	c.JSON(status, resp)
+}
+
+// checkDependencies 并行检查各依赖
+func checkDependencies(ctx context.Context) map[string]*ctrlmodel.DependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, READY_CHECK_TIMEOUT)
+	defer cancel()
+
+	dt := data.GetData()
+	checks := map[string]func() error{
+		"mysql": func() error { return dt.PingMySQL(ctx) },
+		"redis": func() error { return dt.PingRedis(ctx) },
+	}
+	result := make(map[string]*ctrlmodel.DependencyCheck, len(checks)+1)
+	if config.Conf.Common.MySQLAsMq {
+		result["kafka"] = &ctrlmodel.DependencyCheck{Status: ctrlmodel.HEALTH_CHECK_SKIPPED}
+	} else {
+		checks["kafka"] = func() error { return dt.PingKafka(READY_CHECK_TIMEOUT) }
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check()
+			item := &ctrlmodel.DependencyCheck{
+				Status:    ctrlmodel.HEALTH_CHECK_OK,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				item.Status = ctrlmodel.HEALTH_CHECK_FAILED
+				item.Error = err.Error()
+			}
+			mu.Lock()
+			result[name] = item
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return result
+}
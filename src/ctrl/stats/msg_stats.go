@@ -0,0 +1,186 @@
+package stats
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// 各时间粒度未指定开始时间时的默认时间范围
+var defaultStatsRange = map[string]time.Duration{
+	data.STATS_GRANULARITY_MINUTE: time.Hour,
+	data.STATS_GRANULARITY_HOUR:   24 * time.Hour,
+	data.STATS_GRANULARITY_DAY:    7 * 24 * time.Hour,
+}
+
+// 各时间粒度允许查询的最大时间范围，避免一次返回过多的统计桶
+var maxStatsRange = map[string]time.Duration{
+	data.STATS_GRANULARITY_MINUTE: 24 * time.Hour,
+	data.STATS_GRANULARITY_HOUR:   31 * 24 * time.Hour,
+	data.STATS_GRANULARITY_DAY:    366 * 24 * time.Hour,
+}
+
+// MsgStatsHandler 消息统计处理handler
+type MsgStatsHandler struct {
+	Req    ctrlmodel.MsgStatsReq
+	Resp   ctrlmodel.MsgStatsResp
+	UserId string
+
+	start   time.Time
+	end     time.Time
+	groupBy []string
+}
+
+// MsgStats 消息统计接口，从汇总表按时间粒度和分组维度返回消息数和成功率
+func MsgStats(c *gin.Context) {
+	var hd MsgStatsHandler
+	defer func() {
+		hd.Resp.Msg = constant.GetErrMsg(hd.Resp.Code)
+		c.JSON(http.StatusOK, hd.Resp)
+	}()
+
+	// 获取用户Id
+	hd.UserId = c.Request.Header.Get(constant.HEADER_USERID)
+
+	// 解析请求参数
+	if err := c.ShouldBindQuery(&hd.Req); err != nil {
+		log.Errorf("MsgStats shouldBindQuery err %s", err.Error())
+		hd.Resp.Code = constant.ERR_SHOULD_BIND
+		return
+	}
+
+	// 执行处理函数
+	if err := handler.Run(&hd); err != nil {
+		log.Errorf("MsgStats handler.Run err %s", err.Error())
+		if hd.Resp.Code == 0 {
+			hd.Resp.Code = constant.ERR_INTERNAL
+		}
+	}
+}
+
+// HandleInput 参数检查，解析时间范围和分组维度
+func (p *MsgStatsHandler) HandleInput() error {
+	if p.Req.Granularity == "" {
+		p.Req.Granularity = data.STATS_GRANULARITY_HOUR
+	}
+	if _, ok := maxStatsRange[p.Req.Granularity]; !ok {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return fmt.Errorf("不支持的时间粒度: %s", p.Req.Granularity)
+	}
+
+	var err error
+	if err = p.parseRange(); err != nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return err
+	}
+
+	if p.groupBy, err = parseGroupBy(p.Req.GroupBy); err != nil {
+		p.Resp.Code = constant.ERR_INPUT_INVALID
+		return err
+	}
+	return nil
+}
+
+// parseRange 解析查询的时间范围，开始时间向下对齐到统计桶
+func (p *MsgStatsHandler) parseRange() error {
+	p.end = time.Now()
+	if p.Req.EndTime != "" {
+		end, err := time.ParseInLocation(time.DateTime, p.Req.EndTime, time.Local)
+		if err != nil {
+			return fmt.Errorf("结束时间格式错误: %s", p.Req.EndTime)
+		}
+		p.end = end
+	}
+	p.start = p.end.Add(-defaultStatsRange[p.Req.Granularity])
+	if p.Req.StartTime != "" {
+		start, err := time.ParseInLocation(time.DateTime, p.Req.StartTime, time.Local)
+		if err != nil {
+			return fmt.Errorf("开始时间格式错误: %s", p.Req.StartTime)
+		}
+		p.start = start
+	}
+	p.start = data.StatsBucket(p.start, p.Req.Granularity)
+
+	if !p.start.Before(p.end) {
+		return fmt.Errorf("开始时间必须早于结束时间")
+	}
+	if p.end.Sub(p.start) > maxStatsRange[p.Req.Granularity] {
+		return fmt.Errorf("按%s统计的时间范围不能超过%s", p.Req.Granularity, maxStatsRange[p.Req.Granularity])
+	}
+	return nil
+}
+
+// parseGroupBy 解析逗号分隔的分组维度，去掉重复的维度
+func parseGroupBy(groupBy string) ([]string, error) {
+	dims := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, dim := range strings.Split(groupBy, ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" || seen[dim] {
+			continue
+		}
+		if _, ok := data.StatsGroupColumns[dim]; !ok {
+			return nil, fmt.Errorf("不支持的分组维度: %s", dim)
+		}
+		seen[dim] = true
+		dims = append(dims, dim)
+	}
+	return dims, nil
+}
+
+// HandleProcess 处理函数
+func (p *MsgStatsHandler) HandleProcess() error {
+	log.Infof("into MsgStats HandleProcess")
+	rows, err := data.MsgStatsNsp.Query(data.GetData().GetDB(), p.Req.Granularity, p.start, p.end,
+		p.groupBy, p.Req.Channel, p.Req.SourceID, p.Req.TemplateID)
+	if err != nil {
+		p.Resp.Code = constant.ERR_QUERY
+		return err
+	}
+
+	p.Resp.Granularity = p.Req.Granularity
+	p.Resp.StartTime = p.start.Format(time.DateTime)
+	p.Resp.EndTime = p.end.Format(time.DateTime)
+	p.Resp.Items = make([]*ctrlmodel.MsgStatsItem, 0, len(rows))
+	p.Resp.Summary = new(ctrlmodel.MsgStatsItem)
+	for _, row := range rows {
+		item := &ctrlmodel.MsgStatsItem{
+			BucketTime: row.BucketTime.Format(time.DateTime),
+			Channel:    row.Channel,
+			SourceID:   row.SourceID,
+			TemplateID: row.TemplateID,
+			Status:     row.Status,
+			Total:      row.Total,
+			Succ:       row.Succ,
+			Failed:     row.Failed,
+			Expired:    row.Expired,
+			Cancelled:  row.Cancelled,
+		}
+		item.SuccessRate = successRate(item.Succ, item.Total)
+		p.Resp.Items = append(p.Resp.Items, item)
+
+		p.Resp.Summary.Total += row.Total
+		p.Resp.Summary.Succ += row.Succ
+		p.Resp.Summary.Failed += row.Failed
+		p.Resp.Summary.Expired += row.Expired
+		p.Resp.Summary.Cancelled += row.Cancelled
+	}
+	p.Resp.Summary.SuccessRate = successRate(p.Resp.Summary.Succ, p.Resp.Summary.Total)
+	return nil
+}
+
+// successRate 成功率，保留4位小数
+func successRate(succ, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(succ*10000/total) / 10000
+}
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/ctrlmodel"
+)
+
+func TestParseGroupBy(t *testing.T) {
+	dims, err := parseGroupBy(" channel,sourceID,,channel ,status")
+	if err != nil {
+		t.Fatalf("parseGroupBy err %v", err)
+	}
+	if want := []string{"channel", "sourceID", "status"}; !reflect.DeepEqual(dims, want) {
+		t.Errorf("parseGroupBy = %v, want %v", dims, want)
+	}
+	if _, err := parseGroupBy("channel,to"); err == nil {
+		t.Errorf("parseGroupBy should reject unknown dimension")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		granularity string
+		start, end  string
+		wantStart   string
+		wantErr     bool
+	}{
+		{"hour", "2026-03-02 10:25:00", "2026-03-02 18:00:00", "2026-03-02 10:00:00", false},
+		{"day", "2026-03-02 10:25:00", "2026-03-09 00:00:00", "2026-03-02 00:00:00", false},
+		{"minute", "2026-03-02 10:25:30", "2026-03-02 10:30:00", "2026-03-02 10:25:00", false},
+		{"minute", "2026-03-01 00:00:00", "2026-03-03 00:00:00", "", true},
+		{"hour", "2026-03-02 18:00:00", "2026-03-02 10:00:00", "", true},
+		{"hour", "2026/03/02", "", "", true},
+	}
+	for _, c := range cases {
+		p := &MsgStatsHandler{Req: ctrlmodel.MsgStatsReq{Granularity: c.granularity, StartTime: c.start, EndTime: c.end}}
+		err := p.parseRange()
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseRange(%s, %s, %s) err = %v, wantErr %v", c.granularity, c.start, c.end, err, c.wantErr)
+			continue
+		}
+		if err == nil && p.start.Format("2006-01-02 15:04:05") != c.wantStart {
+			t.Errorf("parseRange(%s, %s, %s) start = %s, want %s", c.granularity, c.start, c.end, p.start, c.wantStart)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryBackoff 计算第attempt次重试前的等待时长
+// 等待时长为 base * 2^(attempt-1)，不超过max，再按jitter比例随机上下浮动，避免大量失败消息同时重试
+// attempt小于1时不等待
+func RetryBackoff(attempt int, base, max time.Duration, jitter float64) time.Duration {
+	if attempt < 1 || base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		// 在 [1-jitter, 1+jitter) 范围内随机浮动
+		delay = time.Duration(float64(delay) * (1 - jitter + 2*jitter*rand.Float64()))
+		if delay > max {
+			delay = max
+		}
+	}
+	return delay
+}
@@ -31,8 +31,10 @@ func CreateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgReq, mt *d
 	var msgRecord = new(data.MsgRecord)
 	msgRecord.Subject = req.Subject
 	msgRecord.MsgId = msgID
+	msgRecord.BatchID = req.BatchID
 	msgRecord.TemplateID = req.TemplateID
 	msgRecord.To = req.To
+	msgRecord.NotifyURL = req.NotifyURL
 	msgRecord.Status = status
 
 	// 将模板数据转换为JSON格式
@@ -50,6 +52,14 @@ func CreateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgReq, mt *d
 		msgRecord.Channel = mt.Channel
 		msgRecord.SourceID = mt.SourceID
 	}
+	// 来源以调用方的Source-Id为准，取消消息时据此校验调用方
+	if req.SourceID != "" {
+		msgRecord.SourceID = req.SourceID
+	}
+	// 按渠道扇出的消息以消息自身的渠道为准
+	if req.Channel != 0 {
+		msgRecord.Channel = req.Channel
+	}
 
 	// 将消息记录保存到数据库
 	err := data.MsgRecordNsp.Create(db, msgRecord)
@@ -58,6 +68,13 @@ func CreateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgReq, mt *d
 		return err
 	}
 
+	data.GetData().PublishMsgStatus(ctx, &data.MsgStatusEvent{
+		MsgID:   msgID,
+		BatchID: msgRecord.BatchID,
+		Status:  data.GetMsgEventStatus(status),
+		Channel: msgRecord.Channel,
+	})
+
 	// 保存到缓存
 	if config.Conf.Common.OpenCache {
 		jsonData, _ := json.Marshal(msgRecord)
@@ -70,7 +87,7 @@ func CreateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgReq, mt *d
 }
 
 // CreateOrUpdateMsgRecord 创建或更新消息记录
-// 如果消息记录已存在，则更新状态；否则创建新记录
+// 如果消息记录已存在，则更新状态；否则创建新记录。记录已取消时返回data.ErrMsgCancelled
 func CreateOrUpdateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgReq, mt *data.MsgTemplate, status int) error {
 	ctx := context.Background()
 
@@ -92,10 +109,21 @@ func CreateOrUpdateMsgRecord(db *gorm.DB, msgID string, req *ctrlmodel.SendMsgRe
 		msgID, record.Status, status)
 
 	err = data.MsgRecordNsp.UpdateStatus(db, msgID, status)
+	if errors.Is(err, data.ErrMsgCancelled) {
+		log.InfoContextf(ctx, "消息记录 %s 已取消，保持取消状态", msgID)
+		return err
+	}
 	if err != nil {
 		log.ErrorContextf(ctx, "更新消息记录状态失败: %s", err.Error())
 		return err
 	}
+	data.GetData().PublishMsgStatus(ctx, &data.MsgStatusEvent{
+		MsgID:      msgID,
+		BatchID:    record.BatchID,
+		Status:     data.GetMsgEventStatus(status),
+		Channel:    req.Channel,
+		RetryCount: record.RetryCount,
+	})
 
 	log.InfoContextf(ctx, "消息记录 %s 状态已更新为：%d", msgID, status)
 	return nil
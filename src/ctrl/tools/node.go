@@ -0,0 +1,24 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	nodeNameOnce sync.Once
+	nodeName     string
+)
+
+// NodeName 当前节点的名称，由主机名和进程号组成
+func NodeName() string {
+	nodeNameOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		nodeName = fmt.Sprintf("%s:%d", host, os.Getpid())
+	})
+	return nodeName
+}
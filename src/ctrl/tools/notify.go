@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/constant"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// 回调请求超时时间
+	NOTIFY_TIMEOUT = 5 * time.Second
+	// 回调重试的初始退避时间，每次失败后翻倍
+	NOTIFY_BACKOFF_BASE = time.Second
+	// 回调重试的最大退避时间
+	NOTIFY_BACKOFF_MAX = time.Minute
+	// 回调记录中错误信息的最大长度
+	NOTIFY_ERROR_MAX_LEN = 1024
+)
+
+// errNotifyAddrForbidden 回调地址解析到内网、回环或链路本地地址
+var errNotifyAddrForbidden = errors.New("notify url resolves to a private, loopback or link-local address")
+
+// notifyClient 回调地址由调用方指定，建立连接时校验解析后的地址，拒绝访问内网地址
+// 重定向后的连接同样经过校验
+var notifyClient = &http.Client{
+	Timeout: NOTIFY_TIMEOUT,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: NOTIFY_TIMEOUT, Control: checkNotifyAddr}).DialContext,
+	},
+}
+
+// NotifyPayload 投递回调的请求体
+type NotifyPayload struct {
+	MsgID     string `json:"msgID"`
+	BatchID   string `json:"batchID,omitempty"`
+	Status    string `json:"status"` // SUCC、FAILED 或 EXPIRED
+	Channel   int    `json:"channel"`
+	Attempts  int    `json:"attempts"` // 投递尝试次数
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ValidateNotifyURL 检查回调地址，必须是http或https地址，且不能直接指向内网、回环或链路本地地址
+// 域名解析后的地址在回调建立连接时再次校验
+func ValidateNotifyURL(notifyURL string) error {
+	u, err := url.Parse(notifyURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid notify url %s", notifyURL)
+	}
+	if strings.EqualFold(u.Hostname(), "localhost") {
+		return errNotifyAddrForbidden
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && isForbiddenNotifyIP(ip) {
+		return errNotifyAddrForbidden
+	}
+	return nil
+}
+
+// isForbiddenNotifyIP 判断是否为回调不允许访问的地址
+func isForbiddenNotifyIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// checkNotifyAddr 建立回调连接前校验解析后的地址
+func checkNotifyAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isForbiddenNotifyIP(ip) {
+		return errNotifyAddrForbidden
+	}
+	return nil
+}
+
+// NotifyFinalStatus 消息到达最终状态后，将回调写入待投递回调表，由回调中继投递到发送时指定的notify_url
+// status为MSG_STATUS_SUCC、MSG_STATUS_FAILED或MSG_STATUS_EXPIRED，channel为最终投递（或最后尝试）的渠道，
+// attempts为投递尝试次数
+func NotifyFinalStatus(db *gorm.DB, msgID string, status int, channel int, attempts int, errMsg string) {
+	record, err := data.MsgRecordNsp.Find(db, msgID)
+	if err != nil {
+		log.Errorf("查询消息 %s 记录失败，无法回调: %s", msgID, err.Error())
+		return
+	}
+	if record.NotifyURL == "" {
+		return
+	}
+
+	payload := NotifyPayload{
+		MsgID:     record.MsgId,
+		BatchID:   record.BatchID,
+		Channel:   channel,
+		Attempts:  attempts,
+		Error:     errMsg,
+		Timestamp: time.Now().Unix(),
+	}
+	switch status {
+	case int(data.MSG_STATUS_SUCC):
+		payload.Status = "SUCC"
+	case int(data.MSG_STATUS_EXPIRED):
+		payload.Status = "EXPIRED"
+	default:
+		payload.Status = "FAILED"
+	}
+	if payload.Channel == 0 {
+		payload.Channel = record.Channel
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Errorf("json marshal err %s", err.Error())
+		return
+	}
+	task := &data.MsgNotifyTask{
+		MsgId:     record.MsgId,
+		NotifyURL: record.NotifyURL,
+		MsgStatus: status,
+		Payload:   string(body),
+		Status:    int(data.NOTIFY_TASK_STATUS_PENDING),
+	}
+	if err := data.MsgNotifyTaskNsp.Create(db, task); err != nil {
+		log.Errorf("保存消息 %s 的待投递回调失败: %s", msgID, err.Error())
+	}
+}
+
+// DeliverNotifyTask 投递一次回调并记录到回调记录表，失败后按指数退避等待下次投递，
+// 达到最大次数或回调地址不允许访问时放弃
+func DeliverNotifyTask(db *gorm.DB, task *data.MsgNotifyTask) {
+	attempt := task.Attempt + 1
+	httpCode, err := postNotify(task.NotifyURL, []byte(task.Payload))
+
+	notifyLog := &data.MsgNotifyLog{
+		MsgId:     task.MsgId,
+		NotifyURL: task.NotifyURL,
+		Status:    task.MsgStatus,
+		Attempt:   attempt,
+		HttpCode:  httpCode,
+	}
+	if err != nil {
+		notifyLog.Error = err.Error()
+		if len(notifyLog.Error) > NOTIFY_ERROR_MAX_LEN {
+			notifyLog.Error = notifyLog.Error[:NOTIFY_ERROR_MAX_LEN]
+		}
+	}
+	if logErr := data.MsgNotifyLogNsp.Create(db, notifyLog); logErr != nil {
+		log.Errorf("保存消息 %s 回调记录失败: %s", task.MsgId, logErr.Error())
+	}
+
+	status := int(data.NOTIFY_TASK_STATUS_SUCC)
+	var nextAttemptAt int64
+	maxAttempts := config.Conf.Common.NotifyMaxRetry
+	switch {
+	case err == nil:
+		log.Infof("消息 %s 回调成功，第%d次", task.MsgId, attempt)
+	case attempt >= maxAttempts || errors.Is(err, errNotifyAddrForbidden):
+		log.Errorf("消息 %s 第%d次回调失败，放弃回调: %s", task.MsgId, attempt, err.Error())
+		status = int(data.NOTIFY_TASK_STATUS_FAILED)
+	default:
+		log.Warnf("消息 %s 第%d/%d次回调失败: %s", task.MsgId, attempt, maxAttempts, err.Error())
+		status = int(data.NOTIFY_TASK_STATUS_PENDING)
+		nextAttemptAt = time.Now().Add(RetryBackoff(attempt, NOTIFY_BACKOFF_BASE, NOTIFY_BACKOFF_MAX, 0)).UnixMilli()
+	}
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if markErr := data.MsgNotifyTaskNsp.MarkAttempt(db, task.ID, status, attempt, nextAttemptAt, errMsg); markErr != nil {
+		log.Errorf("更新消息 %s 的待投递回调失败: %s", task.MsgId, markErr.Error())
+	}
+}
+
+// postNotify 发送一次带签名的回调请求，返回HTTP状态码，非2xx视为失败
+func postNotify(notifyURL string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(constant.HEADER_NOTIFY_TIMESTAMP, timestamp)
+	req.Header.Set(constant.HEADER_NOTIFY_SIGNATURE, SignNotify(config.Conf.Common.NotifySecret, timestamp, body))
+
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignNotify 计算回调签名：hex(HMAC-SHA256(secret, timestamp + "." + body))
+// 接收方用同样的方式计算并比较X-Msg-Signature请求头
+func SignNotify(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
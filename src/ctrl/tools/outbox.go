@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/data"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// PublishOutboxMsg 将发件箱中的消息投递到对应优先级的Kafka主题，成功后标记为已投递
+// 投递成功但标记失败时，中继会再次投递，消费端需要按消息ID容忍重复
+// 发件箱中保存的链路上下文随消息头投递，中继补投的消息也能接上发送请求的链路
+func PublishOutboxMsg(db *gorm.DB, outbox *data.MsgOutbox) error {
+	ctx, span := tracing.Start(tracing.Unmarshal(context.Background(), outbox.TraceContext), "outbox.publish",
+		attribute.String("msg.id", outbox.MsgId),
+		attribute.String("msg.priority", data.GetPriorityStr(data.PriorityEnum(outbox.Priority))))
+	err := publishOutboxMsg(ctx, db, outbox)
+	tracing.End(span, err)
+	return err
+}
+
+func publishOutboxMsg(ctx context.Context, db *gorm.DB, outbox *data.MsgOutbox) error {
+	producer := data.GetData().GetProducer(data.PriorityEnum(outbox.Priority))
+	if producer == nil {
+		err := fmt.Errorf("no producer for priority %d", outbox.Priority)
+		markOutboxFailed(db, outbox, err)
+		return err
+	}
+	if err := producer.SendMessage(ctx, "", []byte(outbox.Payload)); err != nil {
+		markOutboxFailed(db, outbox, err)
+		return err
+	}
+
+	if err := data.MsgOutboxNsp.MarkSent(db, outbox.ID); err != nil {
+		log.Errorf("标记发件箱消息 %s 已投递失败: %s", outbox.MsgId, err.Error())
+		return err
+	}
+	log.Infof("发件箱消息 %s 已投递到%s优先级队列", outbox.MsgId,
+		data.GetPriorityStr(data.PriorityEnum(outbox.Priority)))
+	return nil
+}
+
+// markOutboxFailed 记录投递失败，按失败次数退避，一条无法投递的消息不会挡住之后的消息
+func markOutboxFailed(db *gorm.DB, outbox *data.MsgOutbox, sendErr error) {
+	delay := RetryBackoff(outbox.RetryCount+1,
+		time.Duration(config.Conf.Common.RetryBackoffBase)*time.Millisecond,
+		time.Duration(config.Conf.Common.RetryBackoffMax)*time.Millisecond,
+		config.Conf.Common.RetryBackoffJitter)
+	nextAttemptAt := time.Now().Add(delay).UnixMilli()
+	if err := data.MsgOutboxNsp.MarkFailed(db, outbox.ID, sendErr.Error(), nextAttemptAt); err != nil {
+		log.Errorf("记录发件箱消息 %s 投递失败原因出错: %s", outbox.MsgId, err.Error())
+	}
+}
@@ -45,3 +45,59 @@ func TestTemplateReplace(t *testing.T) {
 	}
 	fmt.Println(result)
 }
+
+func TestSignNotify(t *testing.T) {
+	body := []byte(`{"msgID":"abc","status":"SUCC"}`)
+	sign := SignNotify("secret", "1700000000", body)
+	if len(sign) != 64 {
+		t.Fatalf("SignNotify returned %q, want 64 hex chars", sign)
+	}
+	if sign != SignNotify("secret", "1700000000", body) {
+		t.Fatalf("SignNotify is not deterministic")
+	}
+	if sign == SignNotify("other", "1700000000", body) || sign == SignNotify("secret", "1700000001", body) {
+		t.Fatalf("SignNotify ignores secret or timestamp")
+	}
+}
+
+func TestValidateNotifyURL(t *testing.T) {
+	for _, u := range []string{"https://example.com/hook", "http://203.0.113.7:8080/hook"} {
+		if err := ValidateNotifyURL(u); err != nil {
+			t.Fatalf("ValidateNotifyURL(%q) = %v, want nil", u, err)
+		}
+	}
+	for _, u := range []string{"ftp://example.com", "http://", "http://localhost/hook",
+		"http://127.0.0.1/hook", "http://10.0.0.1/hook", "http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://[fe80::1]/hook"} {
+		if err := ValidateNotifyURL(u); err == nil {
+			t.Fatalf("ValidateNotifyURL(%q) = nil, want error", u)
+		}
+	}
+	if err := checkNotifyAddr("tcp", "172.16.0.1:443", nil); err == nil {
+		t.Fatalf("checkNotifyAddr accepted a private address")
+	}
+	if err := checkNotifyAddr("tcp", "203.0.113.7:443", nil); err != nil {
+		t.Fatalf("checkNotifyAddr rejected a public address: %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base, max := time.Second, time.Minute
+	if d := RetryBackoff(0, base, max, 0); d != 0 {
+		t.Fatalf("RetryBackoff(0) = %v, want 0", d)
+	}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 10: time.Minute, 100: time.Minute} {
+		if d := RetryBackoff(attempt, base, max, 0); d != want {
+			t.Fatalf("RetryBackoff(%d) = %v, want %v", attempt, d, want)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		d := RetryBackoff(3, base, max, 0.5)
+		if d < 2*time.Second || d >= 6*time.Second {
+			t.Fatalf("RetryBackoff(3) with jitter = %v, want within [2s, 6s)", d)
+		}
+		if d := RetryBackoff(20, base, max, 0.5); d > max {
+			t.Fatalf("RetryBackoff(20) with jitter = %v, exceeds max %v", d, max)
+		}
+	}
+}
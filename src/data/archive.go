@@ -0,0 +1,64 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// archiveRows 将table中指定状态、before之前最后更新的记录移入归档表，返回移动的条数
+// 复制和删除在同一个事务中，条件重复校验，避免移动期间状态变化的记录被删除
+func archiveRows(db *gorm.DB, table, historyTable, columns string,
+	statuses []int, before time.Time, limit int) (int64, error) {
+	var ids []int64
+	err := db.Table(table).
+		Where("status IN ?", statuses).
+		Where("modify_time < ?", before).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	var moved int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		insertSQL := fmt.Sprintf("INSERT INTO `%s` (%s) SELECT %s FROM `%s` WHERE id IN ? AND status IN ? AND modify_time < ?",
+			historyTable, columns, columns, table)
+		if err := tx.Exec(insertSQL, ids, statuses, before).Error; err != nil {
+			return err
+		}
+		deleteSQL := fmt.Sprintf("DELETE FROM `%s` WHERE id IN ? AND status IN ? AND modify_time < ?", table)
+		result := tx.Exec(deleteSQL, ids, statuses, before)
+		moved = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// TableRows 表的估算行数，取自information_schema，不扫描全表
+func TableRows(db *gorm.DB, table string) (int64, error) {
+	var rows int64
+	err := db.Raw("SELECT IFNULL(TABLE_ROWS, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		table).Scan(&rows).Error
+	return rows, err
+}
+
+// RotateTable 将表重命名为带时间后缀的表，并换上一张同结构的空表，返回重命名后的表名
+// 两次重命名在同一条RENAME TABLE语句中完成，期间的写入不会落到不存在的表上
+func RotateTable(db *gorm.DB, table string, now time.Time) (string, error) {
+	rotated := table + "_" + now.Format("20060102150405")
+	fresh := table + "_new"
+	if err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` LIKE `%s`", fresh, table)).Error; err != nil {
+		return "", err
+	}
+	err := db.Exec(fmt.Sprintf("RENAME TABLE `%s` TO `%s`, `%s` TO `%s`", table, rotated, fresh, table)).Error
+	if err != nil {
+		return "", err
+	}
+	return rotated, nil
+}
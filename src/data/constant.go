@@ -1,5 +1,7 @@
 package data
 
+import "strconv"
+
 type TaskEnum int
 
 const (
@@ -7,12 +9,16 @@ const (
 	TASK_STATUS_PROCESSING TaskEnum = 2
 	TASK_STATUS_SUCC       TaskEnum = 3
 	TASK_STATUS_FAILED     TaskEnum = 4
+	TASK_STATUS_EXPIRED    TaskEnum = 5
+	TASK_STATUS_CANCELLED  TaskEnum = 6
 )
 
 const (
-	MSG_STATUS_PENDING TaskEnum = 1
-	MSG_STATUS_SUCC    TaskEnum = 2
-	MSG_STATUS_FAILED  TaskEnum = 3
+	MSG_STATUS_PENDING   TaskEnum = 1
+	MSG_STATUS_SUCC      TaskEnum = 2
+	MSG_STATUS_FAILED    TaskEnum = 3
+	MSG_STATUS_EXPIRED   TaskEnum = 4 // 超过有效期未投递，已丢弃
+	MSG_STATUS_CANCELLED TaskEnum = 5 // 投递前被取消
 )
 
 const (
@@ -20,6 +26,28 @@ const (
 	TIMER_MSG_STATUS_PROCESSING TaskEnum = 2
 	TIMER_MSG_STATUS_SUCC       TaskEnum = 3
 	TIMER_MSG_STATUS_FAILED     TaskEnum = 4
+	TIMER_MSG_STATUS_CANCELLED  TaskEnum = 5
+)
+
+const (
+	OUTBOX_STATUS_PENDING TaskEnum = 1
+	OUTBOX_STATUS_SENT    TaskEnum = 2
+)
+
+const (
+	NOTIFY_TASK_STATUS_PENDING TaskEnum = 1
+	NOTIFY_TASK_STATUS_SUCC    TaskEnum = 2
+	NOTIFY_TASK_STATUS_FAILED  TaskEnum = 3
+)
+
+const (
+	ATTEMPT_STATUS_SUCC   TaskEnum = 1
+	ATTEMPT_STATUS_FAILED TaskEnum = 2
+)
+
+const (
+	DEAD_LETTER_STATUS_DEAD     TaskEnum = 1
+	DEAD_LETTER_STATUS_REPLAYED TaskEnum = 2
 )
 
 type ChannelEnum int
@@ -44,6 +72,7 @@ const (
 	PRIORITY_MIDDLE PriorityEnum = 2
 	PRIORITY_HIGH   PriorityEnum = 3
 	PRIORITY_RETRY  PriorityEnum = 4
+	PRIORITY_DEAD   PriorityEnum = 5 // 死信，只用于死信主题和死信表，不参与消费
 )
 
 func (p PriorityEnum) String() string {
@@ -56,8 +85,65 @@ const (
 	REDIS_KEY_RATE_LIMIT_COUNT_TIMER = "XMSG_rate_limit_count_timer"
 	REDIS_KEY_TEMPLATE               = "XMSG_template_"
 	REDIS_KEY_MES_RECORD             = "XMSG_msgrecord_"
+	REDIS_KEY_IDEMPOTENCY            = "XMSG_idempotency_"
+	REDIS_KEY_CANCEL_TOMBSTONE       = "XMSG_cancel_"
+	REDIS_KEY_RETRY_MSGS             = "XMSG_retry_msgs"       // 等待重试的消息，分数为下次尝试时间（Unix毫秒）
+	REDIS_KEY_PRIORITY_WEIGHTS       = "XMSG_priority_weights" // 管理接口调整后的各优先级调度权重，所有节点共用
 )
 
+const (
+	REDIS_CHANNEL_MSG_STATUS = "XMSG_msg_status" // 消息状态变化事件频道
+)
+
+// GetTaskStatusStr 队列中消息状态的名称
+func GetTaskStatusStr(status int) string {
+	switch TaskEnum(status) {
+	case TASK_STATUS_PENDING:
+		return "pending"
+	case TASK_STATUS_PROCESSING:
+		return "processing"
+	case TASK_STATUS_SUCC:
+		return "succeeded"
+	case TASK_STATUS_FAILED:
+		return "failed"
+	case TASK_STATUS_EXPIRED:
+		return "expired"
+	case TASK_STATUS_CANCELLED:
+		return "cancelled"
+	}
+	return strconv.Itoa(status)
+}
+
+// GetChannelStr 渠道的名称
+func GetChannelStr(channel int) string {
+	switch ChannelEnum(channel) {
+	case Channel_EMAIL:
+		return "email"
+	case Channel_SMS:
+		return "sms"
+	case Channel_LARK:
+		return "lark"
+	}
+	return strconv.Itoa(channel)
+}
+
+// GetMsgStatusStr 消息状态的名称
+func GetMsgStatusStr(status int) string {
+	switch TaskEnum(status) {
+	case MSG_STATUS_PENDING:
+		return "pending"
+	case MSG_STATUS_SUCC:
+		return "succeeded"
+	case MSG_STATUS_FAILED:
+		return "failed"
+	case MSG_STATUS_EXPIRED:
+		return "expired"
+	case MSG_STATUS_CANCELLED:
+		return "cancelled"
+	}
+	return ""
+}
+
 func GetPriorityStr(p PriorityEnum) string {
 	if p == PRIORITY_LOW {
 		return "low"
@@ -71,5 +157,8 @@ func GetPriorityStr(p PriorityEnum) string {
 	if p == PRIORITY_RETRY {
 		return "retry"
 	}
+	if p == PRIORITY_DEAD {
+		return "dead"
+	}
 	return ""
 }
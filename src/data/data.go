@@ -3,10 +3,12 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	conf "github.com/lvdashuaibi/MsgPushSystem/src/config"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/cache"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/gormcli"
@@ -78,6 +80,15 @@ func (p *Data) genTemplateCacheKey(templateID string) string {
 	return fmt.Sprintf("%s%s", REDIS_KEY_TEMPLATE, templateID)
 }
 
+// IsDuplicateEntry 判断错误是否为MySQL唯一键冲突
+func IsDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return err != nil && strings.Contains(err.Error(), "Duplicate entry")
+}
+
 func (p *Data) GetProducer(key PriorityEnum) mq.Producer {
 	return p.producers[key]
 }
@@ -118,6 +129,41 @@ func (p *Data) GetRetryMQConsumer() mq.Consumer {
 	return p.consumers[PRIORITY_RETRY]
 }
 
+func (p *Data) GetDeadMQProducer() mq.Producer {
+	return p.producers[PRIORITY_DEAD]
+}
+
+func (p *Data) GetDeadMQConsumer() mq.Consumer {
+	return p.consumers[PRIORITY_DEAD]
+}
+
+// Close 关闭消费者、生产者以及Redis和数据库连接池，退出前调用
+// 先关闭消费者提交已消费的位移，再关闭生产者，最后关闭连接池
+func (p *Data) Close() {
+	for priority, consumer := range p.consumers {
+		if err := consumer.Close(); err != nil {
+			log.Errorf("关闭%s消费者失败: %s", GetPriorityStr(priority), err.Error())
+		}
+	}
+	for priority, producer := range p.producers {
+		if err := producer.Close(); err != nil {
+			log.Errorf("关闭%s生产者失败: %s", GetPriorityStr(priority), err.Error())
+		}
+	}
+	kafkaCheckerMu.Lock()
+	if kafkaChecker != nil {
+		kafkaChecker.Close()
+		kafkaChecker = nil
+	}
+	kafkaCheckerMu.Unlock()
+	if err := p.rdb.Close(); err != nil {
+		log.Errorf("关闭Redis连接池失败: %s", err.Error())
+	}
+	if err := gormcli.Close(); err != nil {
+		log.Errorf("关闭数据库连接池失败: %s", err.Error())
+	}
+}
+
 // NewData
 //
 //	@Author <a href="https://bitoffer.cn">狂飙训练营</a>
@@ -155,6 +201,7 @@ func NewData(cf *conf.TomlConfig) (*Data, error) {
 		consumers: consumers,
 	}
 	data = dta
+	registerQueueCollector(cf)
 	fmt.Println("producer 2", data.GetLowMQProducer())
 	fmt.Printf("data is %+v\n", data)
 	fmt.Printf("data db is %+v\n", data.GetDB())
@@ -193,6 +240,7 @@ func generateConsumer(cf *conf.TomlConfig) map[PriorityEnum]mq.Consumer {
 			mq.WithTopic(topicConfig.Name),
 			mq.WithGroupID(topicConfig.GroupID),
 			mq.WithPartition(int32(topicConfig.Partition)),
+			mq.WithInitialOffset(topicConfig.StartOffset()),
 		}
 
 		// 如果配置了消费者组ID，则添加
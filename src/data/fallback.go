@@ -0,0 +1,92 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// FallbackPolicy 渠道降级策略，当前渠道重试耗尽或超时后按顺序尝试下一个渠道
+type FallbackPolicy struct {
+	Channels  []int          `json:"channels"`            // 按顺序尝试的降级渠道
+	Timeout   int            `json:"timeout"`             // 单个渠道的最长尝试时间（秒），0表示只在重试次数耗尽时降级
+	Templates map[int]string `json:"templates,omitempty"` // 降级渠道使用的模板，key为渠道，未指定时沿用原消息的模板或内容；短信渠道必须指定
+}
+
+// TemplateFor 降级到该渠道时使用的模板ID，为空表示沿用原消息
+func (fp *FallbackPolicy) TemplateFor(channel int) string {
+	return fp.Templates[channel]
+}
+
+// Value 实现 driver.Valuer 接口
+func (fp FallbackPolicy) Value() (driver.Value, error) {
+	if len(fp.Channels) == 0 {
+		return "", nil
+	}
+	return json.Marshal(fp)
+}
+
+// Scan 实现 sql.Scanner 接口
+func (fp *FallbackPolicy) Scan(value interface{}) error {
+	*fp = FallbackPolicy{}
+	bytes, err := scanBytes(value)
+	if err != nil || len(bytes) == 0 {
+		return err
+	}
+	return json.Unmarshal(bytes, fp)
+}
+
+// FallbackTarget 降级目标，发送时已按渠道解析好接收地址
+type FallbackTarget struct {
+	Channel    int    `json:"channel"`
+	To         string `json:"to"`
+	TemplateID string `json:"templateId,omitempty"` // 该渠道使用的模板，为空时沿用原消息的模板或内容
+}
+
+// FallbackState 消息在降级链路上的进度，随消息一起入队
+type FallbackState struct {
+	Targets  []FallbackTarget `json:"targets"`  // 剩余待尝试的降级目标
+	Timeout  int              `json:"timeout"`  // 单个渠道的最长尝试时间（秒）
+	Deadline int64            `json:"deadline"` // 当前渠道的截止时间（Unix秒），首次失败时设置，0表示未设置
+}
+
+// Next 取出下一个降级目标，返回剩余的降级进度
+func (fs *FallbackState) Next() (FallbackTarget, *FallbackState) {
+	next := fs.Targets[0]
+	rest := &FallbackState{
+		Targets: fs.Targets[1:],
+		Timeout: fs.Timeout,
+	}
+	return next, rest
+}
+
+// Value 实现 driver.Valuer 接口
+func (fs FallbackState) Value() (driver.Value, error) {
+	if len(fs.Targets) == 0 {
+		return "", nil
+	}
+	return json.Marshal(fs)
+}
+
+// Scan 实现 sql.Scanner 接口
+func (fs *FallbackState) Scan(value interface{}) error {
+	*fs = FallbackState{}
+	bytes, err := scanBytes(value)
+	if err != nil || len(bytes) == 0 {
+		return err
+	}
+	return json.Unmarshal(bytes, fs)
+}
+
+func scanBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.New("cannot scan into fallback field")
+	}
+}
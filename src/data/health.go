@@ -0,0 +1,43 @@
+package data
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	conf "github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/mq"
+)
+
+var (
+	kafkaCheckerMu sync.Mutex
+	kafkaChecker   *mq.BrokerChecker // 首次检查时创建，之后复用连接
+)
+
+// PingMySQL 检查MySQL连接是否可用
+func (p *Data) PingMySQL(ctx context.Context) error {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// PingRedis 检查Redis连接是否可用
+func (p *Data) PingRedis(ctx context.Context) error {
+	return p.rdb.Ping(ctx)
+}
+
+// PingKafka 拉取Kafka集群元数据，检查是否有可用的broker
+func (p *Data) PingKafka(timeout time.Duration) error {
+	kafkaCheckerMu.Lock()
+	defer kafkaCheckerMu.Unlock()
+	if kafkaChecker == nil {
+		checker, err := mq.NewBrokerChecker(conf.Conf.Kafka.Brokers, timeout)
+		if err != nil {
+			return err
+		}
+		kafkaChecker = checker
+	}
+	return kafkaChecker.Check()
+}
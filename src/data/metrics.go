@@ -0,0 +1,89 @@
+package data
+
+import (
+	"sync"
+
+	conf "github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/mq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueBacklogDesc = prometheus.NewDesc("msgpush_queue_backlog",
+		"Messages in t_msg_queue_* by priority and status, only reported when MySQL is used as the queue.",
+		[]string{"priority", "status"}, nil)
+	kafkaLagDesc = prometheus.NewDesc("msgpush_kafka_consumer_lag",
+		"Kafka consumer group lag by topic, only reported in Kafka mode.",
+		[]string{"topic", "group"}, nil)
+)
+
+// queueCollector 抓取时实时查询队列积压：MySQL作为消息队列时统计各队列表按状态的消息数，Kafka模式下查询各主题的消费积压
+type queueCollector struct {
+	cf *conf.TomlConfig
+
+	mu         sync.Mutex
+	lagMonitor *mq.LagMonitor
+}
+
+// Describe 实现 prometheus.Collector 接口
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueBacklogDesc
+	ch <- kafkaLagDesc
+}
+
+// Collect 实现 prometheus.Collector 接口，查询失败只记录日志，不影响其余指标
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.cf.Common.MySQLAsMq {
+		c.collectBacklog(ch)
+	} else {
+		c.collectLag(ch)
+	}
+}
+
+func (c *queueCollector) collectBacklog(ch chan<- prometheus.Metric) {
+	for _, priority := range []PriorityEnum{PRIORITY_LOW, PRIORITY_MIDDLE, PRIORITY_HIGH, PRIORITY_RETRY} {
+		priorityStr := GetPriorityStr(priority)
+		counts, err := MsgQueueNsp.CountByStatus(GetData().GetDB(), priorityStr)
+		if err != nil {
+			log.Errorf("统计%s优先级队列积压失败: %s", priorityStr, err.Error())
+			continue
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(queueBacklogDesc, prometheus.GaugeValue, float64(count),
+				priorityStr, GetTaskStatusStr(status))
+		}
+	}
+}
+
+func (c *queueCollector) collectLag(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lagMonitor == nil {
+		monitor, err := mq.NewLagMonitor(c.cf.Kafka.Brokers)
+		if err != nil {
+			log.Errorf("创建Kafka消费积压查询器失败: %s", err.Error())
+			return
+		}
+		c.lagMonitor = monitor
+	}
+	for _, topic := range c.cf.Kafka.Topics {
+		lag, err := c.lagMonitor.Lag(topic.Name, topic.GroupID)
+		if err != nil {
+			log.Errorf("查询主题 %s 的消费积压失败: %s", topic.Name, err.Error())
+			continue
+		}
+		group := topic.GroupID
+		if group == "" {
+			group = mq.DefaultGroupID
+		}
+		ch <- prometheus.MustNewConstMetric(kafkaLagDesc, prometheus.GaugeValue, float64(lag), topic.Name, group)
+	}
+}
+
+// registerQueueCollector 注册队列积压指标
+func registerQueueCollector(cf *conf.TomlConfig) {
+	if err := prometheus.Register(&queueCollector{cf: cf}); err != nil {
+		log.Errorf("注册队列积压指标失败: %s", err.Error())
+	}
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var MsgAttemptNsp MsgAttempt
+
+// MsgAttempt 单次投递尝试日志，每个渠道的每次发送记录一条
+type MsgAttempt struct {
+	ID            int64      `json:"id"`
+	MsgId         string     `json:"msgID"`
+	Attempt       int        `json:"attempt"` // 第几轮投递，从1开始
+	Channel       int        `json:"channel"`
+	Provider      string     `json:"provider"` // 渠道供应商，如smtp、aliyun_sms、lark
+	To            string     `json:"to"`
+	Status        int        `json:"status"`    // 1: 成功, 2: 失败
+	LatencyMs     int64      `json:"latencyMs"` // 调用渠道供应商的耗时（毫秒）
+	ErrorCategory string     `json:"errorCategory"`
+	ErrorCode     string     `json:"errorCode"`
+	Response      string     `json:"response"`      // 失败时为错误信息
+	ProviderMsgID string     `json:"providerMsgID"` // 成功时渠道供应商返回的消息ID，如短信BizId、邮件Message-ID
+	WorkerNode    string     `json:"workerNode"`    // 执行投递的节点
+	CreateTime    *time.Time `gorm:"column:create_time;default:null" json:"createTime"`
+}
+
+// TableName 表名
+func (p *MsgAttempt) TableName() string {
+	return "t_msg_attempt"
+}
+
+// Create 创建记录
+func (p *MsgAttempt) Create(db *gorm.DB, dt *MsgAttempt) error {
+	err := db.Create(dt).Error
+	return err
+}
+
+// ListByMsgID 按投递顺序查询消息的所有投递尝试
+func (p *MsgAttempt) ListByMsgID(db *gorm.DB, msgID string) ([]*MsgAttempt, error) {
+	var list = make([]*MsgAttempt, 0)
+	err := db.Where("msg_id = ?", msgID).Order("id").Find(&list).Error
+	return list, err
+}
+
+// ListByMsgIDs 按投递顺序批量查询多条消息的投递尝试
+func (p *MsgAttempt) ListByMsgIDs(db *gorm.DB, msgIDs []string) ([]*MsgAttempt, error) {
+	var list = make([]*MsgAttempt, 0)
+	err := db.Where("msg_id IN ?", msgIDs).Order("id").Find(&list).Error
+	return list, err
+}
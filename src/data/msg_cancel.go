@@ -0,0 +1,20 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// CANCEL_TOMBSTONE_EXPIRE 取消标记的保留时长，需覆盖消息在MQ中可能滞留的时间
+const CANCEL_TOMBSTONE_EXPIRE = 7 * 24 * time.Hour
+
+// SetCancelTombstone 记录消息已被取消，消费者据此跳过已在MQ中的消息
+func (p *Data) SetCancelTombstone(ctx context.Context, msgID string) error {
+	return p.GetCache().Set(ctx, REDIS_KEY_CANCEL_TOMBSTONE+msgID, "1", CANCEL_TOMBSTONE_EXPIRE)
+}
+
+// IsCancelled 判断消息是否已被取消
+func (p *Data) IsCancelled(ctx context.Context, msgID string) bool {
+	n, err := p.GetCache().Exists(ctx, REDIS_KEY_CANCEL_TOMBSTONE+msgID)
+	return err == nil && n > 0
+}
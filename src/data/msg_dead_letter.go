@@ -0,0 +1,191 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MAX_ATTEMPT_HISTORY 失败投递历史最多保留的条数
+const MAX_ATTEMPT_HISTORY = 50
+
+// AttemptInfo 一次失败的投递尝试
+type AttemptInfo struct {
+	Time     int64  `json:"time"` // 失败时间（Unix秒）
+	Channel  int    `json:"channel"`
+	To       string `json:"to"`
+	Error    string `json:"error"`
+	Category string `json:"category,omitempty"` // 错误分类
+	Code     string `json:"code,omitempty"`     // 原因码
+}
+
+// AttemptHistory 失败投递历史，按JSON存储
+type AttemptHistory []AttemptInfo
+
+// Append 追加一次失败记录，超出上限时丢弃最早的记录
+func (ah AttemptHistory) Append(info AttemptInfo) AttemptHistory {
+	ah = append(ah, info)
+	if len(ah) > MAX_ATTEMPT_HISTORY {
+		ah = ah[len(ah)-MAX_ATTEMPT_HISTORY:]
+	}
+	return ah
+}
+
+// Value 实现 driver.Valuer 接口
+func (ah AttemptHistory) Value() (driver.Value, error) {
+	if len(ah) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(ah)
+}
+
+// Scan 实现 sql.Scanner 接口
+func (ah *AttemptHistory) Scan(value interface{}) error {
+	*ah = AttemptHistory{}
+	bytes, err := scanBytes(value)
+	if err != nil || len(bytes) == 0 {
+		return err
+	}
+	return json.Unmarshal(bytes, ah)
+}
+
+var MsgDeadLetterNsp MsgDeadLetter
+
+// MsgDeadLetter 死信消息，达到最大重试次数仍未投递成功的消息
+type MsgDeadLetter struct {
+	ID             int64          `json:"id"`
+	MsgId          string         `json:"msgID"`
+	BatchID        string         `json:"batchID"`
+	To             string         `json:"to"`
+	Channel        int            `json:"channel"`
+	Priority       int            `json:"priority"`  // 消息优先级，重放时投递到该优先级队列
+	Req            string         `json:"req"`       // 消息请求(SendMsgReq)的JSON
+	LastError      string         `json:"lastError"` // 最后一次投递失败原因
+	AttemptHistory AttemptHistory `gorm:"column:attempt_history;type:text" json:"attemptHistory"`
+	RetryCount     int            `json:"retryCount"`
+	Status         int            `json:"status"`      // 1: 待处理, 2: 已重放
+	ReplayCount    int            `json:"replayCount"` // 重放次数
+	CreateTime     *time.Time     `gorm:"column:create_time;default:null" json:"createTime"`
+	ModifyTime     *time.Time     `gorm:"column:modify_time;default:null" json:"modifyTime"`
+}
+
+// TableName 表名
+func (p *MsgDeadLetter) TableName() string {
+	return "t_msg_queue_dead"
+}
+
+// Save 保存死信，同一条消息再次进入死信时覆盖之前的记录
+func (p *MsgDeadLetter) Save(db *gorm.DB, dt *MsgDeadLetter) error {
+	existing, err := p.FindByMsgID(db, dt.MsgId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(dt).Error
+	}
+	if err != nil {
+		return err
+	}
+	var dic = map[string]interface{}{
+		"batch_id":        dt.BatchID,
+		"to":              dt.To,
+		"channel":         dt.Channel,
+		"priority":        dt.Priority,
+		"req":             dt.Req,
+		"last_error":      dt.LastError,
+		"attempt_history": dt.AttemptHistory,
+		"retry_count":     dt.RetryCount,
+		"status":          dt.Status,
+	}
+	return db.Model(&MsgDeadLetter{}).Where("id = ?", existing.ID).UpdateColumns(dic).Error
+}
+
+// Find 按ID查找死信
+func (p *MsgDeadLetter) Find(db *gorm.DB, id int64) (*MsgDeadLetter, error) {
+	var data = &MsgDeadLetter{}
+	err := db.Where("id = ?", id).First(data).Error
+	return data, err
+}
+
+// FindByMsgID 按消息ID查找死信
+func (p *MsgDeadLetter) FindByMsgID(db *gorm.DB, msgID string) (*MsgDeadLetter, error) {
+	var data = &MsgDeadLetter{}
+	err := db.Where("msg_id = ?", msgID).First(data).Error
+	return data, err
+}
+
+// FindByIDs 按ID批量查找死信
+func (p *MsgDeadLetter) FindByIDs(db *gorm.DB, ids []int64) ([]*MsgDeadLetter, error) {
+	var list []*MsgDeadLetter
+	err := db.Where("id in (?)", ids).Order("id").Find(&list).Error
+	return list, err
+}
+
+// List 分页查询死信列表
+func (p *MsgDeadLetter) List(db *gorm.DB, offset, limit int, msgID string, channel, status int) ([]*MsgDeadLetter, int64, error) {
+	var list []*MsgDeadLetter
+	var total int64
+
+	query := db.Model(&MsgDeadLetter{})
+
+	// 添加过滤条件
+	if msgID != "" {
+		query = query.Where("msg_id = ?", msgID)
+	}
+	if channel > 0 {
+		query = query.Where("channel = ?", channel)
+	}
+	if status > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	// 查询总数
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 查询列表
+	err := query.Offset(offset).
+		Limit(limit).
+		Order("id DESC").
+		Find(&list).Error
+
+	return list, total, err
+}
+
+// ClaimReplay 仅当死信处于待处理状态时标记为已重放，返回是否标记成功，并发重放同一条死信时只有一个能成功
+func (p *MsgDeadLetter) ClaimReplay(db *gorm.DB, id int64) (bool, error) {
+	var dic = map[string]interface{}{
+		"status":       int(DEAD_LETTER_STATUS_REPLAYED),
+		"replay_count": gorm.Expr("replay_count + 1"),
+	}
+	result := db.Model(&MsgDeadLetter{}).
+		Where("id = ? AND status = ?", id, int(DEAD_LETTER_STATUS_DEAD)).UpdateColumns(dic)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseReplay 重放失败时撤销ClaimReplay，死信恢复为待处理
+func (p *MsgDeadLetter) ReleaseReplay(db *gorm.DB, id int64) error {
+	var dic = map[string]interface{}{
+		"status":       int(DEAD_LETTER_STATUS_DEAD),
+		"replay_count": gorm.Expr("replay_count - 1"),
+	}
+	return db.Model(&MsgDeadLetter{}).
+		Where("id = ? AND status = ?", id, int(DEAD_LETTER_STATUS_REPLAYED)).UpdateColumns(dic).Error
+}
+
+// Purge 删除死信，ids为空时按创建时间和状态删除，返回删除条数
+func (p *MsgDeadLetter) Purge(db *gorm.DB, ids []int64, before *time.Time, status int) (int64, error) {
+	query := db.Model(&MsgDeadLetter{})
+	if len(ids) > 0 {
+		query = query.Where("id in (?)", ids)
+	}
+	if before != nil {
+		query = query.Where("create_time < ?", *before)
+	}
+	if status > 0 {
+		query = query.Where("status = ?", status)
+	}
+	result := query.Delete(&MsgDeadLetter{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var MsgNotifyLogNsp MsgNotifyLog
+
+// MsgNotifyLog 投递回调记录，每次回调请求记录一条
+type MsgNotifyLog struct {
+	ID         int64
+	MsgId      string
+	NotifyURL  string
+	Status     int        // 回调通知的消息状态
+	Attempt    int        // 第几次回调
+	HttpCode   int        // 回调地址返回的HTTP状态码，请求未完成时为0
+	Error      string     // 回调失败原因
+	CreateTime *time.Time `gorm:"column:create_time;default:null"`
+}
+
+// TableName 表名
+func (p *MsgNotifyLog) TableName() string {
+	return "t_msg_notify_log"
+}
+
+// Create 创建记录
+func (p *MsgNotifyLog) Create(db *gorm.DB, dt *MsgNotifyLog) error {
+	err := db.Create(dt).Error
+	return err
+}
+
+// ListByMsgID 按回调顺序查询消息的回调记录
+func (p *MsgNotifyLog) ListByMsgID(db *gorm.DB, msgID string) ([]*MsgNotifyLog, error) {
+	var list = make([]*MsgNotifyLog, 0)
+	err := db.Where("msg_id = ?", msgID).Order("id").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var MsgNotifyTaskNsp MsgNotifyTask
+
+// MsgNotifyTask 待投递的回调，消息到达最终状态时写入，由回调中继投递，进程重启后继续投递
+type MsgNotifyTask struct {
+	ID            int64
+	MsgId         string
+	NotifyURL     string
+	MsgStatus     int    // 回调通知的消息状态
+	Payload       string // 回调请求体
+	Status        int
+	Attempt       int        // 已回调次数
+	NextAttemptAt int64      // 下次回调时间（Unix毫秒），0表示立即
+	LastError     string     // 最近一次回调失败原因
+	CreateTime    *time.Time `gorm:"column:create_time;default:null"`
+	ModifyTime    *time.Time `gorm:"column:modify_time;default:null"`
+}
+
+// TableName 表名
+func (p *MsgNotifyTask) TableName() string {
+	return "t_msg_notify_task"
+}
+
+// Create 创建记录
+func (p *MsgNotifyTask) Create(db *gorm.DB, dt *MsgNotifyTask) error {
+	err := db.Create(dt).Error
+	return err
+}
+
+// GetDueList 获取已到下次回调时间的待回调记录，按写入顺序返回
+func (p *MsgNotifyTask) GetDueList(db *gorm.DB, limit int) ([]*MsgNotifyTask, error) {
+	var list = make([]*MsgNotifyTask, 0)
+	err := db.
+		Where("status = ?", int(NOTIFY_TASK_STATUS_PENDING)).
+		Where("next_attempt_at <= ?", time.Now().UnixMilli()).
+		Order("id").
+		Limit(limit).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// MarkAttempt 记录一次回调结果，status为待回调时nextAttemptAt之前不再回调
+func (p *MsgNotifyTask) MarkAttempt(db *gorm.DB, id int64, status, attempt int, nextAttemptAt int64, errMsg string) error {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+	var dic = map[string]interface{}{
+		"status":          status,
+		"attempt":         attempt,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      errMsg,
+	}
+	err := db.Model(&MsgNotifyTask{}).Where("id = ?", id).UpdateColumns(dic).Error
+	return err
+}
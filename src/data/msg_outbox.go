@@ -0,0 +1,81 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var MsgOutboxNsp MsgOutbox
+
+// MsgOutbox 消息发件箱，与消息记录在同一个事务中写入，再由中继投递到Kafka
+type MsgOutbox struct {
+	ID            int64
+	MsgId         string
+	Priority      int    // 优先级，决定投递的Kafka主题
+	Payload       string // 投递到Kafka的消息体
+	TraceContext  string // 链路追踪上下文，投递时写入Kafka消息头
+	Status        int
+	RetryCount    int        // 投递失败次数
+	LastError     string     // 最近一次投递失败原因
+	NextAttemptAt int64      // 下次投递时间（Unix毫秒），0表示立即
+	CreateTime    *time.Time `gorm:"column:create_time;default:null"`
+	ModifyTime    *time.Time `gorm:"column:modify_time;default:null"`
+}
+
+// TableName 表名
+func (p *MsgOutbox) TableName() string {
+	return "t_msg_outbox"
+}
+
+// Create 创建记录
+func (p *MsgOutbox) Create(db *gorm.DB, dt *MsgOutbox) error {
+	err := db.Create(dt).Error
+	return err
+}
+
+// GetPendingList 获取创建时间早于before且已到下次投递时间的待投递消息，按写入顺序返回
+func (p *MsgOutbox) GetPendingList(db *gorm.DB, before time.Time, limit int) ([]*MsgOutbox, error) {
+	var list = make([]*MsgOutbox, 0)
+	err := db.
+		Where("status = ?", int(OUTBOX_STATUS_PENDING)).
+		Where("create_time <= ?", before).
+		Where("next_attempt_at <= ?", time.Now().UnixMilli()).
+		Order("id").
+		Limit(limit).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// MarkSent 标记为已投递
+func (p *MsgOutbox) MarkSent(db *gorm.DB, id int64) error {
+	err := db.Model(&MsgOutbox{}).Where("id = ?", id).
+		Update("status", int(OUTBOX_STATUS_SENT)).Error
+	return err
+}
+
+// MarkFailed 记录一次投递失败，nextAttemptAt之前中继不再投递该消息
+func (p *MsgOutbox) MarkFailed(db *gorm.DB, id int64, errMsg string, nextAttemptAt int64) error {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+	var dic = map[string]interface{}{
+		"retry_count":     gorm.Expr("retry_count + 1"),
+		"last_error":      errMsg,
+		"next_attempt_at": nextAttemptAt,
+	}
+	err := db.Model(&MsgOutbox{}).Where("id = ?", id).UpdateColumns(dic).Error
+	return err
+}
+
+// PurgeSent 删除创建时间早于before的已投递消息，每次最多删除limit条，返回删除条数
+func (p *MsgOutbox) PurgeSent(db *gorm.DB, before time.Time, limit int) (int64, error) {
+	result := db.Where("status = ?", int(OUTBOX_STATUS_SENT)).
+		Where("create_time < ?", before).
+		Limit(limit).
+		Delete(&MsgOutbox{})
+	return result.RowsAffected, result.Error
+}
@@ -4,22 +4,31 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var MsgQueueNsp MsgQueue
 
 type MsgQueue struct {
-	ID           int64
-	MsgId        string
-	To           string
-	Subject      string
-	Channel      int
-	TemplateID   string
-	TemplateData string
-	Priority     int
-	Status       int
-	CreateTime   *time.Time `gorm:"column:create_time;default:null"`
-	ModifyTime   *time.Time `gorm:"column:modify_time;default:null"`
+	ID             int64
+	MsgId          string
+	BatchID        string // 批次ID，同一次发送请求扇出的消息共用
+	To             string
+	Subject        string
+	Channel        int
+	TemplateID     string
+	TemplateData   string
+	Content        string         // 直接发送模式的消息内容
+	Fallback       *FallbackState // 渠道降级进度
+	ExpireAt       int64          // 过期时间（Unix秒），0表示不过期
+	NextAttemptAt  int64          // 下次尝试时间（Unix毫秒），到期前不会被消费，0表示立即
+	AttemptHistory AttemptHistory `gorm:"column:attempt_history;type:text"` // 失败投递历史
+	TraceContext   string         // 链路追踪上下文，消费时继续入队时的链路
+	Owner          string         // 最后认领该消息的节点
+	Priority       int
+	Status         int
+	CreateTime     *time.Time `gorm:"column:create_time;default:null"`
+	ModifyTime     *time.Time `gorm:"column:modify_time;default:null"`
 }
 
 // TableName 表名
@@ -27,10 +36,20 @@ func (p *MsgQueue) TableName() string {
 	return "t_msg_queue"
 }
 
+// HistoryTableName 归档表名，各优先级队列共用一张归档表，按priority区分
+func (p *MsgQueue) HistoryTableName() string {
+	return "t_msg_queue_history"
+}
+
+// msgQueueArchiveColumns 归档时从队列表复制到归档表的列，归档表使用自己的自增ID
+const msgQueueArchiveColumns = "`msg_id`, `batch_id`, `to`, `subject`, `priority`, `channel`, `template_id`, " +
+	"`template_data`, `content`, `fallback`, `expire_at`, `next_attempt_at`, `attempt_history`, `trace_context`, " +
+	"`status`, `create_time`, `modify_time`"
+
 // Find 查找记录
 func (p *MsgQueue) Find(db *gorm.DB, priorityStr string, msgID string) (*MsgQueue, error) {
 	var data = &MsgQueue{}
-	err := db.Table(p.TableName() + "_" + priorityStr).Where("msg_id= ?", msgID).First(data).Error
+	err := db.Table(p.TableName()+"_"+priorityStr).Where("msg_id= ?", msgID).First(data).Error
 	return data, err
 }
 
@@ -50,6 +69,7 @@ func (p *MsgQueue) GetMsgList(db *gorm.DB,
 	err := db.
 		Table(p.TableName()+"_"+priorityStr).
 		Where("status = ?", status).
+		Where("next_attempt_at <= ?", time.Now().UnixMilli()).
 		Order("create_time").
 		Limit(limit).
 		Find(&msgList).Error
@@ -59,6 +79,58 @@ func (p *MsgQueue) GetMsgList(db *gorm.DB,
 	return msgList, nil
 }
 
+// GetStuckList 获取在before之前置为处理中、之后一直没有更新的消息，这些消息的处理节点可能已经崩溃
+func (p *MsgQueue) GetStuckList(db *gorm.DB, priorityStr string, before time.Time, limit int) ([]*MsgQueue, error) {
+	var msgList = make([]*MsgQueue, 0)
+	err := db.
+		Table(p.TableName()+"_"+priorityStr).
+		Where("status = ?", TASK_STATUS_PROCESSING).
+		Where("modify_time < ?", before).
+		Order("modify_time").
+		Limit(limit).
+		Find(&msgList).Error
+	if err != nil {
+		return nil, err
+	}
+	return msgList, nil
+}
+
+// ClaimMsgList 认领最多limit条到期的待处理消息，置为处理中并记录认领节点
+// 使用SELECT ... FOR UPDATE SKIP LOCKED，多个节点同时认领时跳过彼此锁定的行，同一条消息只会被一个节点认领
+// 各优先级表按idx_status_create_time顺序扫描、重试表按idx_status_next_attempt扫描，只锁定取到的行
+func (p *MsgQueue) ClaimMsgList(db *gorm.DB, priorityStr string, owner string, limit int) ([]*MsgQueue, error) {
+	table := p.TableName() + "_" + priorityStr
+	var msgList = make([]*MsgQueue, 0)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(table).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", TASK_STATUS_PENDING).
+			Where("next_attempt_at <= ?", time.Now().UnixMilli()).
+			Order("create_time").
+			Limit(limit).
+			Find(&msgList).Error
+		if err != nil || len(msgList) == 0 {
+			return err
+		}
+		ids := make([]int64, len(msgList))
+		for i, msg := range msgList {
+			ids[i] = msg.ID
+		}
+		return tx.Table(table).Where("id IN ?", ids).UpdateColumns(map[string]interface{}{
+			"status": TASK_STATUS_PROCESSING,
+			"owner":  owner,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgList {
+		msg.Status = int(TASK_STATUS_PROCESSING)
+		msg.Owner = owner
+	}
+	return msgList, nil
+}
+
 // BatchSetStatus batch set
 func (p *MsgQueue) BatchSetStatus(db *gorm.DB, priorityStr string, msgIdList []string, status int) error {
 	var dic = map[string]interface{}{
@@ -85,3 +157,43 @@ func (p *MsgQueue) SetStatus(db *gorm.DB, priorityStr string, msgID string, stat
 	}
 	return nil
 }
+
+// CompareAndSetStatus 仅当消息处于from状态时更新为to状态，返回是否更新成功
+func (p *MsgQueue) CompareAndSetStatus(db *gorm.DB, priorityStr string, msgID string, from, to int) (bool, error) {
+	result := db.Table(p.TableName()+"_"+priorityStr).Where("msg_id = ? AND status = ?", msgID, from).
+		UpdateColumn("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Updates 更新消息的多个字段
+func (p *MsgQueue) Updates(db *gorm.DB, priorityStr string, msgID string, dic map[string]interface{}) error {
+	err := db.Table(p.TableName()+"_"+priorityStr).Where("msg_id = ?", msgID).
+		UpdateColumns(dic).Error
+	return err
+}
+
+// CountByStatus 按状态统计队列中的消息数
+func (p *MsgQueue) CountByStatus(db *gorm.DB, priorityStr string) (map[int]int64, error) {
+	var rows []struct {
+		Status int
+		Count  int64
+	}
+	err := db.Table(p.TableName() + "_" + priorityStr).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// Archive 将before之前结束的消息移入归档表，返回移动的条数
+func (p *MsgQueue) Archive(db *gorm.DB, priorityStr string, statuses []int, before time.Time, limit int) (int64, error) {
+	return archiveRows(db, p.TableName()+"_"+priorityStr, p.HistoryTableName(), msgQueueArchiveColumns,
+		statuses, before, limit)
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
@@ -10,18 +12,25 @@ import (
 var MsgRecordNsp MsgRecord
 
 type MsgRecord struct {
-	ID           int64
-	Subject      string
-	To           string
-	MsgId        string
-	TemplateID   string
-	TemplateData string
-	Channel      int
-	SourceID     string
-	Status       int        // 添加状态字段
-	RetryCount   int        // 重试次数，默认为0
-	CreateTime   *time.Time `gorm:"column:create_time;default:null"`
-	ModifyTime   *time.Time `gorm:"column:modify_time;default:null"`
+	ID               int64
+	Subject          string
+	To               string
+	MsgId            string
+	BatchID          string // 批次ID，同一次发送请求扇出的消息共用
+	TemplateID       string
+	TemplateData     string
+	Channel          int
+	DeliveredChannel int // 最终投递成功的渠道，降级后可能与Channel不同
+	SourceID         string
+	NotifyURL        string     // 最终状态回调地址
+	Status           int        // 添加状态字段
+	RetryCount       int        // 重试次数，默认为0
+	NextAttemptAt    int64      // 下次重试时间（Unix毫秒），0表示没有待重试
+	ErrorCategory    string     // 最近一次投递失败的错误分类
+	ErrorCode        string     // 最近一次投递失败的原因码
+	LastError        string     // 最近一次投递失败的错误信息
+	CreateTime       *time.Time `gorm:"column:create_time;default:null"`
+	ModifyTime       *time.Time `gorm:"column:modify_time;default:null"`
 }
 
 // TableName 表名
@@ -36,16 +45,117 @@ func (p *MsgRecord) Find(db *gorm.DB, msgID string) (*MsgRecord, error) {
 	return data, err
 }
 
-// Create 创建记录
+// FindByMsgIDs 批量查找记录
+func (p *MsgRecord) FindByMsgIDs(db *gorm.DB, msgIDs []string) ([]*MsgRecord, error) {
+	var records []*MsgRecord
+	err := db.Where("msg_id IN ?", msgIDs).Find(&records).Error
+	return records, err
+}
+
+// Create 创建记录，直接以最终状态创建的记录计入统计
 func (p *MsgRecord) Create(db *gorm.DB, dt *MsgRecord) error {
 	data := dt
 	err := db.Create(data).Error
+	if err == nil {
+		MsgStatsNsp.OnStatusChange(db, data, 0, data.Status)
+	}
 	return err
 }
 
-// UpdateStatus 更新消息记录状态
+// ErrMsgCancelled 消息记录已取消，投递结果不再覆盖取消状态
+var ErrMsgCancelled = errors.New("msg has been cancelled")
+
+// UpdateStatus 更新消息记录状态，状态发生变化时同步更新统计
+// 与取消互斥：记录已取消时保持取消状态并返回ErrMsgCancelled
 func (p *MsgRecord) UpdateStatus(db *gorm.DB, msgID string, status int) error {
-	err := db.Model(&MsgRecord{}).Where("msg_id = ?", msgID).Update("status", status).Error
+	err := p.updateStatusColumns(db, msgID, map[string]interface{}{"status": status}, true)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// CompareAndUpdateStatus 仅当记录处于from状态时更新为to状态，返回是否更新成功
+func (p *MsgRecord) CompareAndUpdateStatus(db *gorm.DB, msgID string, from, to int) (bool, error) {
+	result := db.Model(&MsgRecord{}).Where("msg_id = ? AND status = ?", msgID, from).Update("status", to)
+	if result.Error != nil || result.RowsAffected == 0 || from == to {
+		return result.RowsAffected > 0, result.Error
+	}
+	if record, err := p.Find(db, msgID); err == nil {
+		MsgStatsNsp.OnStatusChange(db, record, from, to)
+	}
+	return true, nil
+}
+
+// updateStatusColumns 更新包含状态的字段，仅当记录仍处于查询时的状态时更新，避免并发更新重复计入统计
+// 状态被并发修改时重新查询后重试，keepCancelled为true时不更新已取消的记录
+func (p *MsgRecord) updateStatusColumns(db *gorm.DB, msgID string, dic map[string]interface{}, keepCancelled bool) error {
+	to := dic["status"].(int)
+	for i := 0; i < 3; i++ {
+		record, err := p.Find(db, msgID)
+		if err != nil {
+			return err
+		}
+		if keepCancelled && record.Status == int(MSG_STATUS_CANCELLED) {
+			return ErrMsgCancelled
+		}
+		result := db.Model(&MsgRecord{}).Where("msg_id = ? AND status = ?", msgID, record.Status).UpdateColumns(dic)
+		if result.Error != nil {
+			return result.Error
+		}
+		// 状态未变化且其余字段也未变化时影响行数为0，无需重试
+		if result.RowsAffected > 0 || record.Status == to {
+			MsgStatsNsp.OnStatusChange(db, record, record.Status, to)
+			return nil
+		}
+	}
+	return fmt.Errorf("update status of msg %s conflicted", msgID)
+}
+
+// ListByBatchID 查询批次下的所有消息记录
+func (p *MsgRecord) ListByBatchID(db *gorm.DB, batchID string) ([]*MsgRecord, error) {
+	var records []*MsgRecord
+	err := db.Where("batch_id = ?", batchID).Find(&records).Error
+	return records, err
+}
+
+// UpdateDeliveredChannel 更新最终投递成功的渠道
+func (p *MsgRecord) UpdateDeliveredChannel(db *gorm.DB, msgID string, channel int) error {
+	err := db.Model(&MsgRecord{}).Where("msg_id = ?", msgID).Update("delivered_channel", channel).Error
+	return err
+}
+
+// ResetForReplay 重放死信前将消息记录重置为待处理，templateData非空时同时更新模板数据
+func (p *MsgRecord) ResetForReplay(db *gorm.DB, msgID string, templateData string) error {
+	var dic = map[string]interface{}{
+		"status":          int(MSG_STATUS_PENDING),
+		"retry_count":     0,
+		"next_attempt_at": 0,
+	}
+	if templateData != "" {
+		dic["template_data"] = templateData
+	}
+	// 死信重放的消息离开最终失败状态，从统计中扣减，重新投递后按新的最终状态计入
+	return p.updateStatusColumns(db, msgID, dic, false)
+}
+
+// UpdateErrorClass 更新最近一次投递失败的错误分类、原因码和错误信息
+func (p *MsgRecord) UpdateErrorClass(db *gorm.DB, msgID string, category, code, errMsg string) error {
+	if len(errMsg) > 1024 {
+		errMsg = errMsg[:1024]
+	}
+	var dic = map[string]interface{}{
+		"error_category": category,
+		"error_code":     code,
+		"last_error":     errMsg,
+	}
+	err := db.Model(&MsgRecord{}).Where("msg_id = ?", msgID).UpdateColumns(dic).Error
+	return err
+}
+
+// UpdateNextAttemptAt 更新消息记录的下次重试时间
+func (p *MsgRecord) UpdateNextAttemptAt(db *gorm.DB, msgID string, nextAttemptAt int64) error {
+	err := db.Model(&MsgRecord{}).Where("msg_id = ?", msgID).Update("next_attempt_at", nextAttemptAt).Error
 	return err
 }
 
@@ -76,7 +186,7 @@ func (p *MsgRecord) IncrementRetryCount(db *gorm.DB, msgID string) (int, error)
 }
 
 // List 分页查询消息记录列表
-func (p *MsgRecord) List(db *gorm.DB, offset, limit int, msgID, to string, status int, startTime, endTime string) ([]*MsgRecord, int64, error) {
+func (p *MsgRecord) List(db *gorm.DB, offset, limit int, msgID, batchID, to string, status int, startTime, endTime string) ([]*MsgRecord, int64, error) {
 	var records []*MsgRecord
 	var total int64
 
@@ -86,6 +196,9 @@ func (p *MsgRecord) List(db *gorm.DB, offset, limit int, msgID, to string, statu
 	if msgID != "" {
 		query = query.Where("msg_id LIKE ?", "%"+msgID+"%")
 	}
+	if batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
 	if to != "" {
 		query = query.Where("to LIKE ?", "%"+to+"%")
 	}
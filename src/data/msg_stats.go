@@ -0,0 +1,159 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"gorm.io/gorm"
+)
+
+var MsgStatsNsp MsgStats
+
+// 统计汇总的时间粒度，每个粒度一张汇总表
+const (
+	STATS_GRANULARITY_MINUTE = "minute"
+	STATS_GRANULARITY_HOUR   = "hour"
+	STATS_GRANULARITY_DAY    = "day"
+)
+
+// StatsGranularities 所有的统计时间粒度，消息状态变化时每个粒度的汇总表都会更新
+var StatsGranularities = []string{STATS_GRANULARITY_MINUTE, STATS_GRANULARITY_HOUR, STATS_GRANULARITY_DAY}
+
+// StatsGroupColumns 统计接口可用的分组维度及对应的列名
+var StatsGroupColumns = map[string]string{
+	"channel":    "channel",
+	"sourceID":   "source_id",
+	"templateID": "template_id",
+	"status":     "status",
+}
+
+// MsgStats 消息统计汇总，按消息创建时间分桶，记录每个(渠道, 业务ID, 模板ID, 最终状态)的消息数
+// 消息进入最终状态时累加，离开最终状态（如死信重放）时扣减，因此不包含投递中的消息
+type MsgStats struct {
+	ID         int64
+	BucketTime time.Time
+	Channel    int
+	SourceID   string
+	TemplateID string
+	Status     int
+	Count      int64
+	ModifyTime *time.Time `gorm:"column:modify_time;default:null"`
+}
+
+// MsgStatsRow 统计查询结果，未参与分组的维度为零值
+type MsgStatsRow struct {
+	BucketTime time.Time
+	Channel    int
+	SourceID   string
+	TemplateID string
+	Status     int
+	Total      int64
+	Succ       int64
+	Failed     int64
+	Expired    int64
+	Cancelled  int64
+}
+
+// TableName 表名
+func (p *MsgStats) TableName(granularity string) string {
+	return "t_msg_stats_" + granularity
+}
+
+// StatsBucket 时间所在的统计桶的起始时间
+func StatsBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case STATS_GRANULARITY_MINUTE:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	case STATS_GRANULARITY_HOUR:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// IsFinalMsgStatus 是否为消息的最终状态
+func IsFinalMsgStatus(status int) bool {
+	switch TaskEnum(status) {
+	case MSG_STATUS_SUCC, MSG_STATUS_FAILED, MSG_STATUS_EXPIRED, MSG_STATUS_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// Incr 按消息记录累加各粒度汇总表中对应状态的计数，delta为负数时扣减
+func (p *MsgStats) Incr(db *gorm.DB, record *MsgRecord, status int, delta int) error {
+	createTime := time.Now()
+	if record.CreateTime != nil {
+		createTime = *record.CreateTime
+	}
+	for _, granularity := range StatsGranularities {
+		sql := fmt.Sprintf("INSERT INTO %s (bucket_time, channel, source_id, template_id, status, count) "+
+			"VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE count = count + VALUES(count)", p.TableName(granularity))
+		err := db.Exec(sql, StatsBucket(createTime, granularity), record.Channel, record.SourceID,
+			record.TemplateID, status, delta).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnStatusChange 消息状态变化时更新统计汇总，离开最终状态时扣减，进入最终状态时累加
+// 统计只用于报表，更新失败只记录日志，不影响消息状态
+func (p *MsgStats) OnStatusChange(db *gorm.DB, record *MsgRecord, from, to int) {
+	if from == to {
+		return
+	}
+	if IsFinalMsgStatus(from) {
+		if err := p.Incr(db, record, from, -1); err != nil {
+			log.Errorf("扣减消息 %s 的统计失败: %s", record.MsgId, err.Error())
+		}
+	}
+	if IsFinalMsgStatus(to) {
+		if err := p.Incr(db, record, to, 1); err != nil {
+			log.Errorf("累加消息 %s 的统计失败: %s", record.MsgId, err.Error())
+		}
+	}
+}
+
+// Query 查询[start, end)内的统计，groupBy为StatsGroupColumns中的分组维度，按统计桶和分组维度排序
+func (p *MsgStats) Query(db *gorm.DB, granularity string, start, end time.Time, groupBy []string,
+	channel int, sourceID, templateID string) ([]*MsgStatsRow, error) {
+	columns := []string{"bucket_time"}
+	for _, dim := range groupBy {
+		column, ok := StatsGroupColumns[dim]
+		if !ok {
+			return nil, fmt.Errorf("unknown stats dimension %s", dim)
+		}
+		columns = append(columns, column)
+	}
+	selects := append([]string{}, columns...)
+	selects = append(selects,
+		"SUM(count) AS total",
+		fmt.Sprintf("SUM(CASE WHEN status = %d THEN count ELSE 0 END) AS succ", MSG_STATUS_SUCC),
+		fmt.Sprintf("SUM(CASE WHEN status = %d THEN count ELSE 0 END) AS failed", MSG_STATUS_FAILED),
+		fmt.Sprintf("SUM(CASE WHEN status = %d THEN count ELSE 0 END) AS expired", MSG_STATUS_EXPIRED),
+		fmt.Sprintf("SUM(CASE WHEN status = %d THEN count ELSE 0 END) AS cancelled", MSG_STATUS_CANCELLED),
+	)
+
+	query := db.Table(p.TableName(granularity)).
+		Select(strings.Join(selects, ", ")).
+		Where("bucket_time >= ? AND bucket_time < ?", start, end)
+	if channel > 0 {
+		query = query.Where("channel = ?", channel)
+	}
+	if sourceID != "" {
+		query = query.Where("source_id = ?", sourceID)
+	}
+	if templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+
+	var rows = make([]*MsgStatsRow, 0)
+	err := query.Group(strings.Join(columns, ", ")).
+		Order(strings.Join(columns, ", ")).
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+)
+
+// 消息状态事件，消息在生命周期中的每次状态变化都会发布到Redis频道
+const (
+	MSG_EVENT_PENDING    = "PENDING"
+	MSG_EVENT_PROCESSING = "PROCESSING"
+	MSG_EVENT_SUCC       = "SUCC"
+	MSG_EVENT_FAILED     = "FAILED"
+	MSG_EVENT_RETRYING   = "RETRYING"
+	MSG_EVENT_EXPIRED    = "EXPIRED"
+	MSG_EVENT_CANCELLED  = "CANCELLED"
+)
+
+// MsgStatusEvent 消息状态变化事件
+type MsgStatusEvent struct {
+	MsgID         string `json:"msgID"`
+	BatchID       string `json:"batchID"`
+	Status        string `json:"status"`
+	Channel       int    `json:"channel"`
+	RetryCount    int    `json:"retryCount,omitempty"`
+	NextAttemptAt int64  `json:"nextAttemptAt,omitempty"` // 下次重试时间（Unix毫秒），仅RETRYING事件有值
+	Error         string `json:"error,omitempty"`
+	Time          int64  `json:"time"` // 事件时间（Unix毫秒）
+}
+
+// GetMsgEventStatus 消息记录状态对应的事件状态
+func GetMsgEventStatus(status int) string {
+	switch TaskEnum(status) {
+	case MSG_STATUS_PENDING:
+		return MSG_EVENT_PENDING
+	case MSG_STATUS_SUCC:
+		return MSG_EVENT_SUCC
+	case MSG_STATUS_FAILED:
+		return MSG_EVENT_FAILED
+	case MSG_STATUS_EXPIRED:
+		return MSG_EVENT_EXPIRED
+	case MSG_STATUS_CANCELLED:
+		return MSG_EVENT_CANCELLED
+	}
+	return ""
+}
+
+// IsFinalMsgEvent 是否为最终状态事件，之后消息不会再有状态变化
+func IsFinalMsgEvent(status string) bool {
+	switch status {
+	case MSG_EVENT_SUCC, MSG_EVENT_FAILED, MSG_EVENT_EXPIRED, MSG_EVENT_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// PublishMsgStatus 发布消息状态变化事件，发布失败只记录日志，不影响投递
+func (p *Data) PublishMsgStatus(ctx context.Context, event *MsgStatusEvent) {
+	if event.Time == 0 {
+		event.Time = time.Now().UnixMilli()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("序列化消息 %s 的状态事件失败: %s", event.MsgID, err.Error())
+		return
+	}
+	if err := p.GetCache().Publish(ctx, REDIS_CHANNEL_MSG_STATUS, string(payload)); err != nil {
+		log.Errorf("发布消息 %s 的状态事件失败: %s", event.MsgID, err.Error())
+	}
+}
@@ -20,8 +20,9 @@ type MsgTemplate struct {
 	SignName      string
 	Status        int
 	Ext           string
-	CreateTime    *time.Time `gorm:"column:create_time;default:null"`
-	ModifyTime    *time.Time `gorm:"column:modify_time;default:null"`
+	Fallback      *FallbackPolicy // 渠道降级策略
+	CreateTime    *time.Time      `gorm:"column:create_time;default:null"`
+	ModifyTime    *time.Time      `gorm:"column:modify_time;default:null"`
 }
 
 // TableName 表名
@@ -11,7 +11,9 @@ var MsgTmpQueueTimerNsp MsgTmpQueueTimer
 type MsgTmpQueueTimer struct {
 	ID            int64
 	MsgId         string
+	BatchID       string // 批次ID，用于按批次取消
 	Req           string
+	TraceContext  string // 链路追踪上下文，到期投递时继续发送请求的链路
 	SendTimestamp int64
 	Status        int
 	CreateTime    *time.Time `gorm:"column:create_time;default:null"`
@@ -23,6 +25,15 @@ func (p *MsgTmpQueueTimer) TableName() string {
 	return "t_msg_tmp_queue_timer"
 }
 
+// HistoryTableName 归档表名
+func (p *MsgTmpQueueTimer) HistoryTableName() string {
+	return "t_msg_tmp_queue_timer_history"
+}
+
+// msgTmpQueueTimerArchiveColumns 归档时从定时队列表复制到归档表的列
+const msgTmpQueueTimerArchiveColumns = "`msg_id`, `batch_id`, `req`, `trace_context`, `send_timestamp`, " +
+	"`status`, `create_time`, `modify_time`"
+
 // Find 查找记录
 func (p *MsgTmpQueueTimer) Find(db *gorm.DB, msgID string) (*MsgTmpQueueTimer, error) {
 	var data = &MsgTmpQueueTimer{}
@@ -53,6 +64,22 @@ func (p *MsgTmpQueueTimer) GetOnTimeMsgList(db *gorm.DB, status int, now int64)
 	return msgList, nil
 }
 
+// GetStuckList 获取在before之前置为处理中、之后一直没有更新的定时消息
+func (p *MsgTmpQueueTimer) GetStuckList(db *gorm.DB, before time.Time, limit int) ([]*MsgTmpQueueTimer, error) {
+	var msgList = make([]*MsgTmpQueueTimer, 0)
+	err := db.
+		Table(p.TableName()).
+		Where("status = ?", TIMER_MSG_STATUS_PROCESSING).
+		Where("modify_time < ?", before).
+		Order("modify_time").
+		Limit(limit).
+		Find(&msgList).Error
+	if err != nil {
+		return nil, err
+	}
+	return msgList, nil
+}
+
 // BatchSetStatus batch set
 func (p *MsgTmpQueueTimer) BatchSetStatus(db *gorm.DB, msgIdList []string, status int) error {
 	var dic = map[string]interface{}{
@@ -79,3 +106,26 @@ func (p *MsgTmpQueueTimer) SetStatus(db *gorm.DB, msgID string, status int) erro
 	}
 	return nil
 }
+
+// CompareAndSetStatus 仅当消息处于from状态时更新为to状态，返回是否更新成功
+func (p *MsgTmpQueueTimer) CompareAndSetStatus(db *gorm.DB, msgID string, from, to int) (bool, error) {
+	result := db.Table(p.TableName()).Where("msg_id = ? AND status = ?", msgID, from).
+		UpdateColumn("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListByBatchID 查询批次下指定状态的定时消息
+func (p *MsgTmpQueueTimer) ListByBatchID(db *gorm.DB, batchID string, status int) ([]*MsgTmpQueueTimer, error) {
+	var msgList = make([]*MsgTmpQueueTimer, 0)
+	err := db.Table(p.TableName()).
+		Where("batch_id = ?", batchID).
+		Where("status = ?", status).
+		Find(&msgList).Error
+	return msgList, err
+}
+
+// Archive 将before之前结束的定时消息移入归档表，返回移动的条数
+func (p *MsgTmpQueueTimer) Archive(db *gorm.DB, statuses []int, before time.Time, limit int) (int64, error) {
+	return archiveRows(db, p.TableName(), p.HistoryTableName(), msgTmpQueueTimerArchiveColumns,
+		statuses, before, limit)
+}
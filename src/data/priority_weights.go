@@ -0,0 +1,58 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	conf "github.com/lvdashuaibi/MsgPushSystem/src/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// PriorityWeights MySQL队列各优先级的调度权重
+type PriorityWeights struct {
+	Weights  map[string]int `json:"weights"`  // 各优先级的权重，key为high、middle、low、retry
+	MinShare float64        `json:"minShare"` // 每个优先级每轮至少分得的发送份额，取值0~0.25
+}
+
+// Weight 优先级的权重，未配置时为0
+func (w *PriorityWeights) Weight(priority PriorityEnum) int {
+	return w.Weights[GetPriorityStr(priority)]
+}
+
+// DefaultPriorityWeights 配置文件中的调度权重
+func DefaultPriorityWeights() *PriorityWeights {
+	weights := make(map[string]int, len(conf.Conf.Common.PriorityWeights))
+	for k, v := range conf.Conf.Common.PriorityWeights {
+		weights[k] = v
+	}
+	return &PriorityWeights{
+		Weights:  weights,
+		MinShare: conf.Conf.Common.PriorityMinShare,
+	}
+}
+
+// GetPriorityWeights 获取当前的调度权重，没有通过管理接口调整过时使用配置文件中的权重
+func (p *Data) GetPriorityWeights(ctx context.Context) (*PriorityWeights, error) {
+	val, _, err := p.GetCache().Get(ctx, REDIS_KEY_PRIORITY_WEIGHTS)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return DefaultPriorityWeights(), nil
+	}
+	weights := new(PriorityWeights)
+	if err := json.Unmarshal([]byte(val), weights); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// SetPriorityWeights 保存调整后的调度权重，各节点的调度器定期读取
+func (p *Data) SetPriorityWeights(ctx context.Context, weights *PriorityWeights) error {
+	val, err := json.Marshal(weights)
+	if err != nil {
+		return err
+	}
+	return p.GetCache().Set(ctx, REDIS_KEY_PRIORITY_WEIGHTS, string(val), 0)
+}
@@ -4,8 +4,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/handler"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/msg"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/probe"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/scheduled"
+	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/stats"
 	"github.com/lvdashuaibi/MsgPushSystem/src/ctrl/user"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // RegisterRouter 注册路由
@@ -13,7 +16,11 @@ func RegisterRouter(router *gin.Engine, aiHandler *handler.AIPolishHandler) {
 	{
 		// 消息相关接口
 		router.POST("/msg/send_msg", msg.SendMsg)
+		router.POST("/msg/cancel", msg.CancelMsg)
 		router.GET("/msg/get_msg_record", msg.GetMsgRecord)
+		router.POST("/msg/get_msg_records", msg.GetMsgRecords)
+		router.GET("/msg/get_msg_attempts", msg.GetMsgAttempts)
+		router.GET("/msg/status/stream", msg.MsgStatusStream)
 		router.GET("/msg/list_msg_records", msg.ListMsgRecords)
 		router.POST("/msg/create_template", msg.CreateTemplate)
 		router.GET("/msg/get_template", msg.GetTemplate)
@@ -21,6 +28,26 @@ func RegisterRouter(router *gin.Engine, aiHandler *handler.AIPolishHandler) {
 		router.POST("/msg/update_template", msg.UpdateTemplate)
 		router.POST("/msg/del_template", msg.DelTemplate)
 
+		// 死信管理接口
+		router.GET("/admin/dlq/list", msg.ListDeadLetters)
+		router.GET("/admin/dlq/get", msg.GetDeadLetter)
+		router.POST("/admin/dlq/replay", msg.ReplayDeadLetters)
+		router.POST("/admin/dlq/purge", msg.PurgeDeadLetters)
+
+		// 优先级调度权重接口
+		router.GET("/admin/priority_weights/get", msg.GetPriorityWeights)
+		router.POST("/admin/priority_weights/update", msg.UpdatePriorityWeights)
+
+		// 统计接口
+		router.GET("/stats/messages", stats.MsgStats)
+
+		// 监控指标
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+		// 存活和就绪探针
+		router.GET("/healthz", probe.Healthz)
+		router.GET("/readyz", probe.Readyz)
+
 		// 用户管理接口
 		router.POST("/user/create", user.CreateUser)
 		router.GET("/user/get", user.GetUser)
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lvdashuaibi/MsgPushSystem/src/config"
@@ -13,14 +16,28 @@ import (
 	"github.com/lvdashuaibi/MsgPushSystem/src/data"
 	"github.com/lvdashuaibi/MsgPushSystem/src/initialize"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/ai"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
 	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/log"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/metrics"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
 	// 初始化配置
 	config.Init()
-	_, err := data.NewData(config.Conf)
+	// 初始化链路追踪，未配置上报地址时不上报
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "msgpush",
+		Endpoint:    config.Conf.Common.OtlpEndpoint,
+		Insecure:    config.Conf.Common.OtlpInsecure,
+		SampleRatio: config.Conf.Common.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Errorf("initialize tracing err %s", err.Error())
+		return
+	}
+	_, err = data.NewData(config.Conf)
 	if err != nil {
 		log.Errorf("initialize NewData err %s", err.Error())
 		return
@@ -31,13 +48,34 @@ func main() {
 	tmc.Consume()
 	consumer.InitMsgProc()
 
+	// 启动发件箱中继，补投未能即时投递到MQ的消息
+	var relay consumer.OutboxRelay
+	relay.Start()
+
+	// 启动回调中继，投递消息到达最终状态后的回调
+	var nr consumer.NotifyRelay
+	nr.Start()
+
+	// 启动重试调度器，按退避时间将失败消息投递到重试主题
+	var rs consumer.RetryScheduler
+	rs.Start()
+
+	// 启动死信主题消费，将死信写入死信表
+	var dlc consumer.DeadLetterConsume
+	dlc.Start()
+
+	// 启动处理中消息回收器，将崩溃节点遗留的处理中消息放回待处理
+	var reaper consumer.ProcessingReaper
+	reaper.Start()
+
+	// 启动队列表归档任务，将结束的消息移入归档表
+	var archiver consumer.QueueArchiver
+	archiver.Start()
+
 	// 启动定时消息调度器
 	smc := consumer.NewScheduledMessageConsumer()
 	smc.Start()
 
-	// 设置信号处理，确保在程序退出前释放分布式锁
-	setupSignalHandler(cs, &tmc)
-
 	// 创建一个web服务
 	router := gin.Default()
 
@@ -47,6 +85,12 @@ func main() {
 		c.Next()
 	})
 
+	// 为每个请求创建链路追踪span
+	router.Use(tracing.GinMiddleware())
+
+	// 统计接口请求数和耗时
+	router.Use(metrics.GinMiddleware())
+
 	// 初始化AI客户端和润色器
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
@@ -57,26 +101,77 @@ func main() {
 	// 这里跳进去就能看到有哪些接口
 	initialize.RegisterRouter(router, aiHandler)
 	fmt.Println("before router run")
-	// 启动web server，这一步之后这个主协程启动会阻塞在这里，请求可以通过gin的子协程进来
-	err = router.Run(fmt.Sprintf(":%d", config.Conf.Common.Port))
-	fmt.Println(err)
+	// 启动web server，请求可以通过gin的子协程进来
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Conf.Common.Port),
+		Handler: router,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	// 主协程阻塞到收到退出信号，然后按顺序停止各组件
+	workers := []stopper{cs, &tmc, smc, &relay, &rs, &dlc, &reaper, &archiver, &nr}
+	waitForShutdown(srv, serveErr, workers, shutdownTracing)
+}
+
+// stopper 退出时需要停止的后台任务
+type stopper interface {
+	Stop()
 }
 
-// setupSignalHandler 设置信号处理，确保在程序退出前释放锁
-func setupSignalHandler(cs *consumer.MsgConsume, tmc *consumer.TimerMsgConsume) {
+// waitForShutdown 等待退出信号后优雅退出：
+// 停止接收HTTP请求，停止拉取新消息，等待处理中的消息完成，
+// 将未处理完的消息放回待处理，最后关闭MQ、Redis和数据库连接
+func waitForShutdown(srv *http.Server, serveErr <-chan error, workers []stopper,
+	shutdownTracing func(context.Context) error) {
 	c := make(chan os.Signal, 1)
 	// 监听 SIGINT, SIGTERM, SIGQUIT 信号
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-	go func() {
-		sig := <-c
+	select {
+	case sig := <-c:
 		log.Infof("接收到系统信号: %v，准备优雅退出", sig)
+	case err := <-serveErr:
+		log.Errorf("web服务退出: %v，准备优雅退出", err)
+	}
+	// 就绪检查随即失败，负载均衡不再转发新请求
+	health.SetShuttingDown()
 
-		// 释放所有分布式锁
-		log.Info("释放所有分布式锁...")
-		cs.UnlockAll()
+	timeout := time.Duration(config.Conf.Common.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-		log.Info("锁释放完成，程序退出")
-		os.Exit(0)
-	}()
+	// 停止接收新的HTTP请求，等待处理中的请求完成
+	log.Info("停止web服务...")
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Errorf("停止web服务失败: %v", err)
+	}
+
+	// 停止MySQL轮询、定时消息扫描和各MQ消费者
+	log.Info("停止消息消费...")
+	for _, w := range workers {
+		w.Stop()
+	}
+
+	// 等待处理中的消息发送完成，超时后不再等待
+	if err := consumer.WaitInflight(ctx); err != nil {
+		log.Errorf("等待处理中的消息超时: %v", err)
+	}
+
+	// 未处理完的消息放回待处理，由其他节点或重启后继续消费
+	dt := data.GetData()
+	consumer.RequeueClaimed(dt.GetDB())
+
+	// 上报缓冲中的链路数据
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Errorf("关闭链路追踪失败: %v", err)
+	}
+	tracingCancel()
+
+	// 关闭MQ生产者、消费者以及Redis和数据库连接池
+	dt.Close()
+	log.Info("优雅退出完成，程序退出")
 }
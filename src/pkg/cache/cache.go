@@ -85,6 +85,11 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 	return c.rdb.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX 键不存在时设置键值对，返回是否设置成功
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.rdb.SetNX(ctx, key, value, expiration).Result()
+}
+
 // Get 获取值
 func (c *Client) Get(ctx context.Context, key string) (string, time.Duration, error) {
 	val, err := c.rdb.Get(ctx, key).Result()
@@ -155,3 +160,23 @@ func (c *Client) EvalResults(ctx context.Context, script string, keys []string,
 	// 如果不是切片，包装成切片返回
 	return []interface{}{result}, nil
 }
+
+// Publish 向频道发布消息
+func (c *Client) Publish(ctx context.Context, channel string, message interface{}) error {
+	return c.rdb.Publish(ctx, channel, message).Err()
+}
+
+// Ping 检查Redis连接是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+// Subscribe 订阅频道，使用完毕后需要调用Close
+func (c *Client) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return c.rdb.Subscribe(ctx, channels...)
+}
+
+// Close 关闭Redis连接池
+func (c *Client) Close() error {
+	return c.rdb.Close()
+}
@@ -124,3 +124,15 @@ func Init(opts ...Option) error {
 func GetDB() *gorm.DB {
 	return db
 }
+
+// Close 关闭数据库连接池
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	mu      sync.Mutex
+	workers = make(map[string]int) // 各后台工作者运行中的协程数
+
+	leaders      sync.Map // 各主节点锁是否由本节点持有
+	shuttingDown atomic.Bool
+)
+
+// WorkerStarted 记录一个后台工作协程开始运行，同名协程可以有多个
+func WorkerStarted(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	workers[name]++
+}
+
+// WorkerStopped 记录一个后台工作协程退出，全部退出后该工作者仍保留在列表中，运行数为0
+func WorkerStopped(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if workers[name] > 0 {
+		workers[name]--
+	}
+}
+
+// Workers 返回各后台工作者当前运行中的协程数
+func Workers() map[string]int {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make(map[string]int, len(workers))
+	for name, n := range workers {
+		result[name] = n
+	}
+	return result
+}
+
+// SetShuttingDown 标记进程开始优雅退出，之后就绪检查一律失败，负载均衡不再转发新请求
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// ShuttingDown 进程是否正在优雅退出
+func ShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// SetLeader 记录本节点是否持有某个主节点锁
+func SetLeader(lock string, held bool) {
+	leaders.Store(lock, held)
+}
+
+// LeaderLocks 返回本节点当前持有的主节点锁，按名称排序
+func LeaderLocks() []string {
+	locks := make([]string, 0)
+	leaders.Range(func(key, value any) bool {
+		if value.(bool) {
+			locks = append(locks, key.(string))
+		}
+		return true
+	})
+	sort.Strings(locks)
+	return locks
+}
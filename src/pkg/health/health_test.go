@@ -0,0 +1,33 @@
+package health
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	WorkerStarted("test_consumer")
+	WorkerStarted("test_consumer")
+	WorkerStopped("test_consumer")
+	if got := Workers()["test_consumer"]; got != 1 {
+		t.Fatalf("running workers = %d, want 1", got)
+	}
+
+	// 全部退出后仍保留在列表中，多余的退出不会变成负数
+	WorkerStopped("test_consumer")
+	WorkerStopped("test_consumer")
+	n, ok := Workers()["test_consumer"]
+	if !ok || n != 0 {
+		t.Fatalf("stopped worker = (%d, %v), want (0, true)", n, ok)
+	}
+}
+
+func TestLeaderLocks(t *testing.T) {
+	SetLeader("LOCK_B", true)
+	SetLeader("LOCK_A", true)
+	SetLeader("LOCK_C", true)
+	SetLeader("LOCK_C", false)
+	if got, want := LeaderLocks(), []string{"LOCK_A", "LOCK_B"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("LeaderLocks() = %v, want %v", got, want)
+	}
+}
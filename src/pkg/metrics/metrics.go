@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "msgpush"
+
+var (
+	// HTTPRequests 接口请求数，按路由和状态码统计
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	// HTTPDuration 接口耗时
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// MsgEnqueued 入队消息数，按优先级统计，定时消息写入定时队列时记为timer
+	MsgEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "msg_enqueued_total",
+		Help:      "Messages enqueued by priority.",
+	}, []string{"priority"})
+
+	// SendDuration 消费者调用渠道发送的耗时和结果，结果为success或错误分类
+	SendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_duration_seconds",
+		Help:      "Channel send latency by channel and outcome.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"channel", "outcome"})
+
+	// MsgRetries 安排重试的次数，按渠道和错误分类统计
+	MsgRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "msg_retries_total",
+		Help:      "Retries scheduled by channel and error category.",
+	}, []string{"channel", "category"})
+
+	// MsgDeadLetters 转入死信的消息数
+	MsgDeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "msg_dead_letters_total",
+		Help:      "Messages moved to the dead-letter store by channel.",
+	}, []string{"channel"})
+
+	// MsgReaped 长时间处于处理中、被放回待处理的消息数，按队列统计，定时队列记为timer
+	MsgReaped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "msg_reaped_total",
+		Help:      "Messages stuck in processing that were requeued by queue.",
+	}, []string{"queue"})
+
+	// MsgDispatched MySQL队列模式下调度器认领的消息数，按优先级统计，用于观察各优先级的实际份额
+	MsgDispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "msg_dispatched_total",
+		Help:      "Messages claimed from the MySQL queue by priority.",
+	}, []string{"priority"})
+
+	// RateLimitDenied 被限流拒绝的消息数
+	RateLimitDenied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_denied_total",
+		Help:      "Messages denied by the rate limiter by source and channel.",
+	}, []string{"source", "channel"})
+
+	// ChannelInflight Kafka模式下各渠道已交给发送协程池、尚未发送完的消息数
+	ChannelInflight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "channel_inflight",
+		Help:      "Messages handed to the channel worker pool and not yet sent, by channel.",
+	}, []string{"channel"})
+
+	// ChannelDeferred Kafka模式下因渠道积压达到上限停放到重试队列的消息数
+	ChannelDeferred = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "channel_deferred_total",
+		Help:      "Messages parked for later because their channel worker pool was saturated, by channel.",
+	}, []string{"channel"})
+
+	// KafkaAssignedPartitions 本节点在各主题上分到的分区数，分区重新分配时更新
+	KafkaAssignedPartitions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_assigned_partitions",
+		Help:      "Kafka partitions assigned to this node by topic.",
+	}, []string{"topic"})
+
+	// Leader 本节点是否持有主节点锁，1为持有
+	Leader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether this node holds the leader lock.",
+	}, []string{"lock"})
+)
+
+// SetLeader 记录本节点是否持有主节点锁，同时供就绪检查展示
+func SetLeader(lock string, leader bool) {
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	Leader.WithLabelValues(lock).Set(value)
+	health.SetLeader(lock, leader)
+}
+
+// GinMiddleware 统计接口的请求数和耗时，未匹配到路由的请求记为unmatched
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
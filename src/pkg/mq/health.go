@@ -0,0 +1,43 @@
+package mq
+
+import (
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// BrokerChecker 通过拉取集群元数据检查Kafka是否可用
+type BrokerChecker struct {
+	client sarama.Client
+}
+
+// NewBrokerChecker 创建Kafka可用性检查器，超时时间较短，避免探针长时间阻塞
+func NewBrokerChecker(brokers []string, timeout time.Duration) (*BrokerChecker, error) {
+	config := sarama.NewConfig()
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	config.Metadata.Retry.Max = 0
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &BrokerChecker{client: client}, nil
+}
+
+// Check 刷新集群元数据，没有可用的broker时返回错误
+func (c *BrokerChecker) Check() error {
+	if err := c.client.RefreshMetadata(); err != nil {
+		return err
+	}
+	if len(c.client.Brokers()) == 0 {
+		return errors.New("no available kafka broker")
+	}
+	return nil
+}
+
+// Close 关闭检查器
+func (c *BrokerChecker) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,61 @@
+package mq
+
+import (
+	"github.com/IBM/sarama"
+)
+
+// LagMonitor 查询消费者组在主题上的消费积压
+type LagMonitor struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewLagMonitor 创建消费积压查询器
+func NewLagMonitor(brokers []string) (*LagMonitor, error) {
+	client, err := sarama.NewClient(brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &LagMonitor{client: client, admin: admin}, nil
+}
+
+// Lag 消费者组在主题所有分区上的积压之和，消费者组在分区上没有提交过位移时该分区不计入
+func (m *LagMonitor) Lag(topic, groupID string) (int64, error) {
+	if groupID == "" {
+		groupID = DefaultGroupID
+	}
+	partitions, err := m.client.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+	offsets, err := m.admin.ListConsumerGroupOffsets(groupID, map[string][]int32{topic: partitions})
+	if err != nil {
+		return 0, err
+	}
+
+	var lag int64
+	for _, partition := range partitions {
+		block := offsets.GetBlock(topic, partition)
+		if block == nil || block.Offset < 0 {
+			continue
+		}
+		newest, err := m.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return 0, err
+		}
+		if newest > block.Offset {
+			lag += newest - block.Offset
+		}
+	}
+	return lag, nil
+}
+
+// Close 关闭查询器
+func (m *LagMonitor) Close() error {
+	return m.admin.Close()
+}
@@ -2,24 +2,56 @@ package mq
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/lvdashuaibi/MsgPushSystem/src/pkg/tracing"
 )
 
 // Producer 生产者接口
 type Producer interface {
-	SendMessage(topic string, message []byte) error
+	SendMessage(ctx context.Context, topic string, message []byte) error
 	Close() error
 }
 
 // Consumer 消费者接口
 type Consumer interface {
-	ConsumeMessages(ctx context.Context, handler func([]byte) error) error
+	ConsumeMessages(ctx context.Context, handler func(context.Context, []byte) error) error
+	ConsumeMessagesAsync(ctx context.Context, handler AsyncHandler) error
+	Pause()
+	Resume()
+	SetRebalanceHooks(hooks RebalanceHooks)
 	Close() error
 }
 
+// AsyncHandler 异步消息处理函数，处理完成后调用ack，可以在其他协程中调用
+// ack(nil)表示消息已处理或已转入重试、死信，ack(err)表示未处理，该消息及之后的位移都不再提交，结束本次会话后重新消费
+type AsyncHandler func(ctx context.Context, message []byte, ack func(error))
+
+// RebalanceHooks 分区重新分配时的回调，claims为本节点分到的主题和分区
+type RebalanceHooks struct {
+	Setup   func(claims map[string][]int32) // 新的分配开始消费前调用
+	Cleanup func(claims map[string][]int32) // 分配结束时调用，此时交出的消息都已处理完，之后提交位移
+}
+
+const (
+	// DefaultGroupID 未指定消费者组时使用的消费者组ID
+	DefaultGroupID = "default-group"
+
+	// OffsetNewest 消费者组在分区上没有提交过位移时从最新消息开始消费
+	OffsetNewest = sarama.OffsetNewest
+	// OffsetOldest 消费者组在分区上没有提交过位移时从最早的消息开始消费
+	OffsetOldest = sarama.OffsetOldest
+
+	// ConsumeRetryDelay 消息处理失败后等待该时长再结束会话，从未处理成功的消息重新消费
+	ConsumeRetryDelay = time.Second
+)
+
 // KafkaProducer Kafka生产者
 type KafkaProducer struct {
 	producer sarama.SyncProducer
@@ -27,10 +59,17 @@ type KafkaProducer struct {
 }
 
 // KafkaConsumer Kafka消费者
+// 只提交处理完的消息的位移，处理失败的消息及之后的消息在重新开始会话后重新消费，保证至少消费一次
 type KafkaConsumer struct {
-	consumer sarama.ConsumerGroup
-	topic    string
-	groupID  string
+	consumer      sarama.ConsumerGroup
+	client        sarama.Client
+	admin         sarama.ClusterAdmin // 查询已提交的位移，指定初始位移时才创建
+	topic         string
+	groupID       string
+	initialOffset int64
+
+	mu    sync.Mutex
+	hooks RebalanceHooks
 }
 
 // Config 配置
@@ -41,6 +80,9 @@ type Config struct {
 	partition int32
 	ack       int8
 	async     bool
+
+	initialOffset int64
+	hooks         RebalanceHooks
 }
 
 // Option 配置选项
@@ -81,6 +123,21 @@ func WithAck(ack int8) Option {
 	}
 }
 
+// WithInitialOffset 设置消费者组在分区上没有提交过位移时开始消费的位置
+// OffsetNewest从最新消息开始，OffsetOldest从最早的消息开始，大于等于0时从指定位移开始
+func WithInitialOffset(offset int64) Option {
+	return func(c *Config) {
+		c.initialOffset = offset
+	}
+}
+
+// WithRebalanceHooks 设置分区重新分配时的回调
+func WithRebalanceHooks(hooks RebalanceHooks) Option {
+	return func(c *Config) {
+		c.hooks = hooks
+	}
+}
+
 // WithAsync 设置异步模式
 func WithAsync() Option {
 	return func(c *Config) {
@@ -120,8 +177,9 @@ func NewKafkaProducer(opts ...Option) Producer {
 // NewKafkaConsumer 创建Kafka消费者
 func NewKafkaConsumer(opts ...Option) Consumer {
 	config := &Config{
-		brokers: []string{"localhost:9092"},
-		groupID: "default-group",
+		brokers:       []string{"localhost:9092"},
+		groupID:       DefaultGroupID,
+		initialOffset: OffsetNewest,
 	}
 
 	for _, opt := range opts {
@@ -131,22 +189,34 @@ func NewKafkaConsumer(opts ...Option) Consumer {
 	saramaConfig := sarama.NewConfig()
 	saramaConfig.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
 	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if config.initialOffset == OffsetOldest {
+		saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
 
-	consumer, err := sarama.NewConsumerGroup(config.brokers, config.groupID, saramaConfig)
+	client, err := sarama.NewClient(config.brokers, saramaConfig)
+	if err != nil {
+		log.Printf("Failed to create Kafka consumer: %v", err)
+		return nil
+	}
+	consumer, err := sarama.NewConsumerGroupFromClient(config.groupID, client)
 	if err != nil {
 		log.Printf("Failed to create Kafka consumer: %v", err)
+		client.Close()
 		return nil
 	}
 
 	return &KafkaConsumer{
-		consumer: consumer,
-		topic:    config.topic,
-		groupID:  config.groupID,
+		consumer:      consumer,
+		client:        client,
+		topic:         config.topic,
+		groupID:       config.groupID,
+		initialOffset: config.initialOffset,
+		hooks:         config.hooks,
 	}
 }
 
-// SendMessage 发送消息
-func (p *KafkaProducer) SendMessage(topic string, message []byte) error {
+// SendMessage 发送消息，ctx中的链路上下文写入消息头
+func (p *KafkaProducer) SendMessage(ctx context.Context, topic string, message []byte) error {
 	if topic == "" {
 		topic = p.topic
 	}
@@ -155,11 +225,38 @@ func (p *KafkaProducer) SendMessage(topic string, message []byte) error {
 		Topic: topic,
 		Value: sarama.ByteEncoder(message),
 	}
+	for k, v := range tracing.Inject(ctx) {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
 
 	_, _, err := p.producer.SendMessage(msg)
 	return err
 }
 
+// IsUnavailable 判断投递失败是否因为Kafka不可用（没有可用的broker、连接断开、生产者已关闭等），
+// 这类错误与具体消息无关，换一条消息投递也会失败
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		sarama.ErrOutOfBrokers,
+		sarama.ErrNotConnected,
+		sarama.ErrClosedClient,
+		sarama.ErrShuttingDown,
+		sarama.ErrBrokerNotAvailable,
+		sarama.ErrLeaderNotAvailable,
+		sarama.ErrNotLeaderForPartition,
+		sarama.ErrRequestTimedOut,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
 // Close 关闭生产者
 func (p *KafkaProducer) Close() error {
 	return p.producer.Close()
@@ -167,34 +264,167 @@ func (p *KafkaProducer) Close() error {
 
 // ConsumerGroupHandler 消费者组处理器
 type ConsumerGroupHandler struct {
-	handler func([]byte) error
+	consumer *KafkaConsumer
+	handler  func(context.Context, []byte) error
 }
 
-// Setup 设置
-func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
-	return nil
+// Setup 新的分配开始消费前调用
+func (h *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	return h.consumer.setup(session)
 }
 
-// Cleanup 清理
-func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
-	return nil
+// Cleanup 分配结束时调用
+func (h *ConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	return h.consumer.cleanup(session)
 }
 
-// ConsumeClaim 消费消息
+// ConsumeClaim 消费消息，处理成功后才标记位移
+// 处理失败时不再继续消费该分区，结束本次会话，之后从失败的消息重新消费
 func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for message := range claim.Messages() {
-		if err := h.handler(message.Value); err != nil {
-			log.Printf("Error processing message: %v", err)
-			continue
+		if err := h.handler(messageContext(session, message), message.Value); err != nil {
+			log.Printf("Error processing message at %s/%d offset %d, will be redelivered: %v",
+				message.Topic, message.Partition, message.Offset, err)
+			retryDelay(session.Context())
+			return nil
 		}
 		session.MarkMessage(message, "")
 	}
 	return nil
 }
 
+// messageContext 从消息头恢复生产者的链路上下文
+func messageContext(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) context.Context {
+	carrier := make(map[string]string, len(message.Headers))
+	for _, header := range message.Headers {
+		carrier[string(header.Key)] = string(header.Value)
+	}
+	return tracing.Extract(session.Context(), carrier)
+}
+
+// retryDelay 处理失败后稍等再重新消费，避免持续失败时反复重建会话，会话结束时立即返回
+func retryDelay(ctx context.Context) {
+	timer := time.NewTimer(ConsumeRetryDelay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// AsyncConsumerGroupHandler 异步消费者组处理器，消息交给处理函数后继续拉取下一条
+type AsyncConsumerGroupHandler struct {
+	consumer *KafkaConsumer
+	handler  AsyncHandler
+}
+
+// Setup 新的分配开始消费前调用
+func (h *AsyncConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	return h.consumer.setup(session)
+}
+
+// Cleanup 分配结束时调用，各分区交出的消息此时都已处理完
+func (h *AsyncConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	return h.consumer.cleanup(session)
+}
+
+// ConsumeClaim 消费消息，分区重新分配前等待已交出的消息全部处理完
+// 有消息处理失败时不再继续拉取，等已交出的消息处理完后结束本次会话，之后从失败的消息重新消费
+func (h *AsyncConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				tracker.wait()
+				return nil
+			}
+			h.handler(messageContext(session, message), message.Value, tracker.add(message.Offset))
+		case <-tracker.failed:
+			tracker.wait()
+			log.Printf("Error processing message in %s/%d, will be redelivered from the last committed offset",
+				claim.Topic(), claim.Partition())
+			retryDelay(session.Context())
+			return nil
+		}
+	}
+}
+
+// offsetTracker 跟踪一个分区中已交给处理函数的消息，按拉取顺序提交处理完的位移
+// 消息并发处理，先处理完的消息要等前面的消息都处理完才提交，崩溃后从最早未处理完的消息重新消费
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64        // 已交出、尚未提交的位移，按拉取顺序
+	done    map[int64]bool // 已处理完、但前面还有未处理完消息的位移
+	failed  chan struct{}  // 有消息未处理成功时关闭，之后不再提交
+	mark    func(offset int64)
+	wg      sync.WaitGroup
+}
+
+func newOffsetTracker(mark func(offset int64)) *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool), failed: make(chan struct{}), mark: mark}
+}
+
+// hasFailed 是否有消息未处理成功
+func (t *offsetTracker) hasFailed() bool {
+	select {
+	case <-t.failed:
+		return true
+	default:
+		return false
+	}
+}
+
+// add 登记一条交出的消息，返回该消息的ack，ack只生效一次
+func (t *offsetTracker) add(offset int64) func(error) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+	t.wg.Add(1)
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			defer t.wg.Done()
+			t.ack(offset, err)
+		})
+	}
+}
+
+func (t *offsetTracker) ack(offset int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hasFailed() {
+		return
+	}
+	if err != nil {
+		log.Printf("Error processing message at offset %d: %v", offset, err)
+		close(t.failed)
+		return
+	}
+	t.done[offset] = true
+	committed := int64(-1)
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		committed = t.pending[0]
+		delete(t.done, committed)
+		t.pending = t.pending[1:]
+	}
+	if committed >= 0 {
+		// 提交的是下一条要消费的位移
+		t.mark(committed + 1)
+	}
+}
+
+// wait 等待已交出的消息全部ack
+func (t *offsetTracker) wait() {
+	t.wg.Wait()
+}
+
 // ConsumeMessages 消费消息
-func (c *KafkaConsumer) ConsumeMessages(ctx context.Context, handler func([]byte) error) error {
-	h := &ConsumerGroupHandler{handler: handler}
+func (c *KafkaConsumer) ConsumeMessages(ctx context.Context, handler func(context.Context, []byte) error) error {
+	h := &ConsumerGroupHandler{consumer: c, handler: handler}
 	topics := []string{c.topic}
 
 	for {
@@ -213,7 +443,105 @@ func (c *KafkaConsumer) ConsumeMessages(ctx context.Context, handler func([]byte
 	}
 }
 
+// ConsumeMessagesAsync 异步消费消息，处理函数调用ack后按顺序提交位移
+func (c *KafkaConsumer) ConsumeMessagesAsync(ctx context.Context, handler AsyncHandler) error {
+	h := &AsyncConsumerGroupHandler{consumer: c, handler: handler}
+	topics := []string{c.topic}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			if err := c.consumer.Consume(ctx, topics, h); err != nil {
+				if strings.Contains(err.Error(), "context canceled") {
+					return nil
+				}
+				log.Printf("Error consuming messages: %v", err)
+				return err
+			}
+		}
+	}
+}
+
+// Pause 暂停拉取所有分区，已拉取的消息仍会交给处理函数
+func (c *KafkaConsumer) Pause() {
+	c.consumer.PauseAll()
+}
+
+// Resume 恢复拉取所有分区
+func (c *KafkaConsumer) Resume() {
+	c.consumer.ResumeAll()
+}
+
+// SetRebalanceHooks 设置分区重新分配时的回调，在下一次分配时生效
+func (c *KafkaConsumer) SetRebalanceHooks(hooks RebalanceHooks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = hooks
+}
+
+// setup 新的分配开始消费前应用初始位移并调用回调
+func (c *KafkaConsumer) setup(session sarama.ConsumerGroupSession) error {
+	if c.initialOffset >= 0 {
+		c.applyInitialOffset(session)
+	}
+	c.mu.Lock()
+	hook := c.hooks.Setup
+	c.mu.Unlock()
+	if hook != nil {
+		hook(session.Claims())
+	}
+	return nil
+}
+
+// cleanup 分配结束时调用回调并提交已标记的位移
+func (c *KafkaConsumer) cleanup(session sarama.ConsumerGroupSession) error {
+	c.mu.Lock()
+	hook := c.hooks.Cleanup
+	c.mu.Unlock()
+	if hook != nil {
+		hook(session.Claims())
+	}
+	session.Commit()
+	return nil
+}
+
+// applyInitialOffset 消费者组在分区上没有提交过位移时，从指定的初始位移开始消费
+// 已经提交过位移的分区继续从提交的位移消费，重启不会回到初始位移
+func (c *KafkaConsumer) applyInitialOffset(session sarama.ConsumerGroupSession) {
+	if c.admin == nil {
+		admin, err := sarama.NewClusterAdminFromClient(c.client)
+		if err != nil {
+			log.Printf("Failed to create Kafka admin, initial offset %d not applied: %v", c.initialOffset, err)
+			return
+		}
+		c.admin = admin
+	}
+	claims := session.Claims()
+	offsets, err := c.admin.ListConsumerGroupOffsets(c.groupID, claims)
+	if err != nil {
+		log.Printf("Failed to list committed offsets, initial offset %d not applied: %v", c.initialOffset, err)
+		return
+	}
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			if block := offsets.GetBlock(topic, partition); block != nil && block.Offset >= 0 {
+				continue
+			}
+			session.MarkOffset(topic, partition, c.initialOffset, "")
+		}
+	}
+}
+
 // Close 关闭消费者
 func (c *KafkaConsumer) Close() error {
-	return c.consumer.Close()
+	err := c.consumer.Close()
+	// 管理端关闭时一并关闭客户端
+	if c.admin != nil {
+		c.admin.Close()
+	} else {
+		c.client.Close()
+	}
+	return err
 }
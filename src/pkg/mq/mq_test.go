@@ -0,0 +1,52 @@
+package mq
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(offset int64) {
+		marked = append(marked, offset)
+	})
+	ack10 := tracker.add(10)
+	ack11 := tracker.add(11)
+	ack13 := tracker.add(13)
+
+	// 后面的消息先处理完，要等前面的消息处理完才提交
+	ack11(nil)
+	ack13(nil)
+	if len(marked) != 0 {
+		t.Fatalf("marked = %v before the first message is acked", marked)
+	}
+	ack10(nil)
+	ack10(nil)
+	tracker.wait()
+	if want := []int64{14}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked = %v, want %v", marked, want)
+	}
+}
+
+func TestOffsetTrackerFailed(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(offset int64) {
+		marked = append(marked, offset)
+	})
+	ack1 := tracker.add(1)
+	ack2 := tracker.add(2)
+	ack3 := tracker.add(3)
+
+	ack1(nil)
+	ack2(errors.New("send failed"))
+	ack3(nil)
+	tracker.wait()
+	// 处理失败的消息及之后的位移都不提交
+	if want := []int64{2}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked = %v, want %v", marked, want)
+	}
+	if !tracker.hasFailed() {
+		t.Error("tracker should stop the claim after a failed message")
+	}
+}
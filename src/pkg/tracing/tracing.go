@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName 本系统创建的span统一使用的tracer名称
+const tracerName = "github.com/lvdashuaibi/MsgPushSystem"
+
+// propagator 跨进程传递链路上下文使用W3C Trace Context格式
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{}, propagation.Baggage{})
+
+// Config 链路追踪配置
+type Config struct {
+	ServiceName string  // 上报的服务名
+	Endpoint    string  // OTLP/HTTP接收地址，如 localhost:4318，为空时不导出
+	Insecure    bool    // 是否使用http而不是https上报
+	SampleRatio float64 // 采样比例，取值0~1
+}
+
+// Init 按配置初始化全局TracerProvider，通过OTLP/HTTP导出span
+// 未配置接收地址时保持默认的no-op实现，返回的关闭函数用于退出前刷新未导出的span
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter failed: %w", err)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// SetExporter 使用指定的导出器替换全局TracerProvider，span结束时同步导出
+// 测试中可传入tracetest.NewInMemoryExporter()检查生成的span
+func SetExporter(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	otel.SetTextMapPropagator(propagator)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	return tp
+}
+
+// Start 创建一个子span，ctx中没有span时创建新的链路
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartConsumer 以消息携带的链路上下文为父span创建消费span
+func StartConsumer(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...))
+}
+
+// End 结束span，err不为空时记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 将ctx中的链路上下文写入carrier，用于Kafka消息头等键值对载体
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract 从carrier中恢复链路上下文
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Marshal 将ctx中的链路上下文序列化为字符串，用于存入数据库，没有链路时返回空字符串
+func Marshal(ctx context.Context) string {
+	carrier := Inject(ctx)
+	if len(carrier) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(carrier)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Unmarshal 从Marshal生成的字符串中恢复链路上下文，解析失败时返回原ctx
+func Unmarshal(ctx context.Context, s string) context.Context {
+	if s == "" {
+		return ctx
+	}
+	var carrier map[string]string
+	if err := json.Unmarshal([]byte(s), &carrier); err != nil {
+		return ctx
+	}
+	return Extract(ctx, carrier)
+}
+
+// GinMiddleware 为每个请求创建服务端span，并继续请求头中携带的链路
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := otel.Tracer(tracerName).Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("http status %d", status))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPropagateThroughMarshal(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := SetExporter(exporter)
+	defer tp.Shutdown(context.Background())
+
+	// 没有链路时不保存上下文
+	if s := Marshal(context.Background()); s != "" {
+		t.Fatalf("Marshal without span = %q, want empty", s)
+	}
+
+	ctx, parent := Start(context.Background(), "SendMsg")
+	stored := Marshal(ctx)
+	parent.End()
+	if stored == "" {
+		t.Fatal("Marshal with span returned empty string")
+	}
+
+	// 消费端从保存的上下文继续链路
+	_, child := StartConsumer(Unmarshal(context.Background(), stored), "msg.consume")
+	child.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[1].SpanContext.TraceID() != spans[0].SpanContext.TraceID() {
+		t.Errorf("consumer span trace id = %s, want %s",
+			spans[1].SpanContext.TraceID(), spans[0].SpanContext.TraceID())
+	}
+	if spans[1].Parent.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("consumer span parent = %s, want %s",
+			spans[1].Parent.SpanID(), spans[0].SpanContext.SpanID())
+	}
+
+	// 无法解析的上下文开始新的链路
+	if got := Unmarshal(context.Background(), "not json"); got != context.Background() {
+		t.Error("Unmarshal of invalid input should return the original context")
+	}
+}
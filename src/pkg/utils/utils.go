@@ -14,6 +14,11 @@ func GenerateUUID() string {
 	return uuid.New().String()
 }
 
+// GenerateNameUUID 根据名称生成确定性的UUID，相同名称总是得到相同结果
+func GenerateNameUUID(name string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String()
+}
+
 // GenerateID 生成唯一ID
 func GenerateID() string {
 	return GenerateUUID()